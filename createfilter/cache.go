@@ -0,0 +1,216 @@
+package createfilter
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exclusionsCacheVersion must be incremented whenever the format of cache files, or the rules
+// which exclude unités légales (e.g. the list of excluded categories juridiques), change.
+const exclusionsCacheVersion = 1
+
+// exclusionsCacheMagic starts every cache file.
+const exclusionsCacheMagic = "SFEX"
+
+// exclusionsCacheKey identifies the exclusions of a sireneUL file, from the checksum of its content
+// and the rules which apply to unités légales.
+func exclusionsCacheKey(path string, rules SireneRules) (string, error) {
+	file, err := os.Open(strings.TrimPrefix(path, "gzip:"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(hash, "\nversion=%d;cessees=%t;created_after=%s", exclusionsCacheVersion, rules.ExcludeCessees, formatCacheDate(rules))
+	return fmt.Sprintf("%x", hash.Sum(nil))[:32], nil
+}
+
+func formatCacheDate(rules SireneRules) string {
+	if rules.ExcludeCreatedAfter.IsZero() {
+		return ""
+	}
+	return rules.ExcludeCreatedAfter.UTC().Format("2006-01-02")
+}
+
+// exclusionsRuleSet names the optional rules which apply to unités légales, e.g. "base+cessees".
+// The key of the exclusions changes with the value of the rules (e.g. date_fin), not their rule set.
+func exclusionsRuleSet(rules SireneRules) string {
+	ruleSet := "base"
+	if rules.ExcludeCessees {
+		ruleSet += "+cessees"
+	}
+	if !rules.ExcludeCreatedAfter.IsZero() {
+		ruleSet += "+created_after"
+	}
+	return ruleSet
+}
+
+func exclusionsCacheFile(cacheDir string, rules SireneRules, key string) string {
+	return filepath.Join(cacheDir, "sireneUL-exclusions-"+exclusionsRuleSet(rules)+"-"+key+".bin")
+}
+
+// evictExclusionsCache removes the cache files of the same rule set as cacheFile, e.g. the exclusions of
+// a previous sireneUL file, or of a previous date_fin, so that the cache directory doesn't grow without bound.
+func evictExclusionsCache(cacheDir string, rules SireneRules, cacheFile string) error {
+	cacheFiles, err := filepath.Glob(filepath.Join(cacheDir, "sireneUL-exclusions-"+exclusionsRuleSet(rules)+"-*.bin"))
+	if err != nil {
+		return err
+	}
+	for _, file := range cacheFiles {
+		if file != cacheFile {
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readExcludedSirensCached returns the same exclusions as readExcludedSirens, from the cache directory
+// of rules if they were already computed for the same file and rules. Otherwise, the exclusions are
+// computed and stored into the cache directory, in place of the exclusions previously computed with the
+// same rule set. Without a cache directory, the cache is not used.
+func readExcludedSirensCached(path string, rules SireneRules) (map[string]string, error) {
+	if rules.CacheDir == "" {
+		return readExcludedSirens(path, rules)
+	}
+	key, err := exclusionsCacheKey(path, rules)
+	if err != nil {
+		return nil, err
+	}
+	cacheFile := exclusionsCacheFile(rules.CacheDir, rules, key)
+	if excludedSirens, err := readExclusionsCache(cacheFile, key); err == nil {
+		println("Info: using the cached exclusions of the sireneUL file: " + cacheFile)
+		return excludedSirens, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		println("Warning: ignoring the cached exclusions of the sireneUL file: " + err.Error())
+	}
+	excludedSirens, err := readExcludedSirens(path, rules)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeExclusionsCache(cacheFile, key, excludedSirens); err != nil {
+		println("Warning: could not cache the exclusions of the sireneUL file: " + err.Error())
+	} else if err := evictExclusionsCache(rules.CacheDir, rules, cacheFile); err != nil {
+		println("Warning: could not remove the previous exclusions of the sireneUL file from the cache: " + err.Error())
+	}
+	return excludedSirens, nil
+}
+
+// writeExclusionsCache stores the excluded sirens into a binary file: after a header made of
+// exclusionsCacheMagic, the version and the key, each rule is stored as its name, the number
+// of its sirens, and its sirens as a sorted array of uint32. Sirens that are not made of 9 digits
+// are not stored, since they can't match the perimeter.
+func writeExclusionsCache(cacheFile string, key string, excludedSirens map[string]string) error {
+	sirensPerRule := map[string][]uint32{}
+	for siren, rule := range excludedSirens {
+		if number, err := parseSiren(siren); err == nil {
+			sirensPerRule[rule] = append(sirensPerRule[rule], number)
+		}
+	}
+	rules := make([]string, 0, len(sirensPerRule))
+	for rule, sirens := range sirensPerRule {
+		sort.Slice(sirens, func(i, j int) bool { return sirens[i] < sirens[j] })
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(cacheFile), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name()) // no-op once renamed
+	w := bufio.NewWriter(tempFile)
+	w.WriteString(exclusionsCacheMagic)
+	w.WriteByte(exclusionsCacheVersion)
+	w.WriteString(key)
+	w.WriteByte(byte(len(rules)))
+	for _, rule := range rules {
+		w.WriteByte(byte(len(rule)))
+		w.WriteString(rule)
+		binary.Write(w, binary.LittleEndian, uint32(len(sirensPerRule[rule])))
+		binary.Write(w, binary.LittleEndian, sirensPerRule[rule])
+	}
+	if err := w.Flush(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), cacheFile)
+}
+
+// readExclusionsCache reads the excluded sirens stored by writeExclusionsCache, after checking
+// that the file matches the expected key.
+func readExclusionsCache(cacheFile string, key string) (map[string]string, error) {
+	file, err := os.Open(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(file)
+	header := make([]byte, len(exclusionsCacheMagic)+1+len(key)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%s: %w", cacheFile, err)
+	}
+	if string(header[:len(exclusionsCacheMagic)]) != exclusionsCacheMagic ||
+		header[len(exclusionsCacheMagic)] != exclusionsCacheVersion ||
+		string(header[len(exclusionsCacheMagic)+1:len(header)-1]) != key {
+		return nil, errors.New(cacheFile + ": unexpected header")
+	}
+	excludedSirens := map[string]string{}
+	for nbRules := int(header[len(header)-1]); nbRules > 0; nbRules-- {
+		nameLength, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cacheFile, err)
+		}
+		name := make([]byte, nameLength)
+		var count uint32
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("%s: %w", cacheFile, err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return nil, fmt.Errorf("%s: %w", cacheFile, err)
+		}
+		if int64(count)*4 > info.Size() {
+			return nil, errors.New(cacheFile + ": truncated file")
+		}
+		sirens := make([]uint32, count)
+		if err := binary.Read(r, binary.LittleEndian, sirens); err != nil {
+			return nil, fmt.Errorf("%s: %w", cacheFile, err)
+		}
+		rule := string(name)
+		for _, siren := range sirens {
+			excludedSirens[fmt.Sprintf("%09d", siren)] = rule
+		}
+	}
+	return excludedSirens, nil
+}
+
+func parseSiren(siren string) (uint32, error) {
+	if len(siren) != 9 {
+		return 0, errors.New("invalid siren: " + siren)
+	}
+	number, err := strconv.ParseUint(siren, 10, 32)
+	return uint32(number), err
+}
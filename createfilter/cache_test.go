@@ -0,0 +1,106 @@
+package createfilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExclusionsCache(t *testing.T) {
+	sireneULPath := makeSireneULFile(t, map[string][2]string{
+		"111111111": {"A", "2000-01-01"},
+		"222222222": {"A", "2000-01-01"},
+		"444444444": {"C", "2000-01-01"},
+		"666666666": {"A", "2000-01-01"},
+	})
+	expected := map[string]string{"222222222": RuleCategorieJuridique, "444444444": RuleCessee, "666666666": RuleActivite}
+
+	t.Run("stores and reuses the exclusions of a sireneUL file", func(t *testing.T) {
+		rules := SireneRules{UniteLegaleFile: sireneULPath, ExcludeCessees: true, CacheDir: t.TempDir()}
+		excludedSirens, err := readExcludedSirensCached(sireneULPath, rules)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, excludedSirens)
+		}
+		cacheFiles, _ := filepath.Glob(filepath.Join(rules.CacheDir, "*.bin"))
+		if !assert.Len(t, cacheFiles, 1) {
+			return
+		}
+		// the cache file is read instead of the sireneUL file
+		key, _ := exclusionsCacheKey(sireneULPath, rules)
+		assert.Equal(t, exclusionsCacheFile(rules.CacheDir, rules, key), cacheFiles[0])
+		assert.NoError(t, writeExclusionsCache(cacheFiles[0], key, map[string]string{"999999999": RuleActivite}))
+		cached, err := readExcludedSirensCached(sireneULPath, rules)
+		if assert.NoError(t, err) {
+			assert.Equal(t, map[string]string{"999999999": RuleActivite}, cached)
+		}
+	})
+
+	t.Run("replaces the exclusions previously computed with the same rule set", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		for _, dateFin := range []time.Time{time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)} {
+			rules := SireneRules{UniteLegaleFile: sireneULPath, ExcludeCreatedAfter: dateFin, CacheDir: cacheDir}
+			if _, err := readExcludedSirensCached(sireneULPath, rules); err != nil {
+				t.Fatal(err)
+			}
+		}
+		otherRuleSet := SireneRules{UniteLegaleFile: sireneULPath, CacheDir: cacheDir}
+		if _, err := readExcludedSirensCached(sireneULPath, otherRuleSet); err != nil {
+			t.Fatal(err)
+		}
+		lastRules := SireneRules{ExcludeCreatedAfter: time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)}
+		lastKey, _ := exclusionsCacheKey(sireneULPath, lastRules)
+		otherKey, _ := exclusionsCacheKey(sireneULPath, otherRuleSet)
+		cacheFiles, _ := filepath.Glob(filepath.Join(cacheDir, "*.bin"))
+		assert.ElementsMatch(t, []string{
+			exclusionsCacheFile(cacheDir, lastRules, lastKey),
+			exclusionsCacheFile(cacheDir, otherRuleSet, otherKey),
+		}, cacheFiles)
+	})
+
+	t.Run("the key changes with the content of the file and the rules", func(t *testing.T) {
+		rules := SireneRules{ExcludeCessees: true}
+		key, err := exclusionsCacheKey(sireneULPath, rules)
+		assert.NoError(t, err)
+		otherRules := SireneRules{ExcludeCessees: true, ExcludeCreatedAfter: time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)}
+		otherRulesKey, _ := exclusionsCacheKey(sireneULPath, otherRules)
+		assert.NotEqual(t, key, otherRulesKey)
+		sameRulesKey, _ := exclusionsCacheKey(sireneULPath, SireneRules{ExcludeCessees: true, CacheDir: "elsewhere"})
+		assert.Equal(t, key, sameRulesKey)
+
+		otherFile := makeSireneULFile(t, map[string][2]string{"111111111": {"A", "2000-01-01"}})
+		otherFileKey, _ := exclusionsCacheKey(otherFile, rules)
+		assert.NotEqual(t, key, otherFileKey)
+	})
+
+	t.Run("ignores a cache file which doesn't match the key", func(t *testing.T) {
+		cacheFile := filepath.Join(t.TempDir(), "cache.bin")
+		assert.NoError(t, writeExclusionsCache(cacheFile, "0123456789abcdef0123456789abcdef", expected))
+		_, err := readExclusionsCache(cacheFile, "fedcba9876543210fedcba9876543210")
+		assert.Error(t, err)
+	})
+
+	t.Run("ignores a truncated cache file", func(t *testing.T) {
+		key := "0123456789abcdef0123456789abcdef"
+		cacheFile := filepath.Join(t.TempDir(), "cache.bin")
+		assert.NoError(t, writeExclusionsCache(cacheFile, key, expected))
+		data, _ := os.ReadFile(cacheFile)
+		assert.NoError(t, os.WriteFile(cacheFile, data[:len(data)-2], 0644))
+		_, err := readExclusionsCache(cacheFile, key)
+		assert.Error(t, err)
+	})
+
+	t.Run("stores each siren in 4 bytes, and skips malformed sirens", func(t *testing.T) {
+		key := "0123456789abcdef0123456789abcdef"
+		cacheFile := filepath.Join(t.TempDir(), "cache.bin")
+		assert.NoError(t, writeExclusionsCache(cacheFile, key, map[string]string{"000000001": RuleActivite, "12345": RuleActivite}))
+		info, _ := os.Stat(cacheFile)
+		assert.Equal(t, int64(len(exclusionsCacheMagic)+1+len(key)+1+1+len(RuleActivite)+4+4), info.Size())
+		cached, err := readExclusionsCache(cacheFile, key)
+		if assert.NoError(t, err) {
+			assert.Equal(t, map[string]string{"000000001": RuleActivite}, cached)
+		}
+	})
+}
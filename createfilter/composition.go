@@ -0,0 +1,130 @@
+package createfilter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"prepare-import/siret"
+)
+
+// CompositionOperation tells how a list of sirens is combined with the perimeter.
+type CompositionOperation string
+
+const (
+	// Union adds the sirens of the list (e.g. a previous filter) to the perimeter.
+	Union CompositionOperation = "union"
+	// Intersection only keeps the sirens of the perimeter which belong to the list (e.g. a previous filter).
+	Intersection CompositionOperation = "intersection"
+	// Include adds the sirens of the list to the perimeter, whatever their effectif or the Sirene rules.
+	Include CompositionOperation = "include"
+	// Exclude removes the sirens of the list from the perimeter.
+	Exclude CompositionOperation = "exclude"
+)
+
+// CompositionStep combines the perimeter with a list of sirens, read from the "siren" column of a CSV file.
+type CompositionStep struct {
+	Operation CompositionOperation `json:"operation"`
+	File      string               `json:"file"`
+	Added     int                  `json:"added"`   // number of sirens added to the perimeter by this step
+	Removed   int                  `json:"removed"` // number of sirens removed from the perimeter by this step
+}
+
+// ReadCompositionLists reads the lists of sirens of the steps, in order, so that a malformed list or an
+// unknown operation is reported before the perimeter is evaluated, and before any filter is written.
+func ReadCompositionLists(steps []CompositionStep) ([]map[string]struct{}, error) {
+	lists := make([]map[string]struct{}, len(steps))
+	for i, step := range steps {
+		switch step.Operation {
+		case Union, Intersection, Include, Exclude:
+		default:
+			return nil, errors.New("opération de composition inconnue : " + string(step.Operation))
+		}
+		sirens, err := ReadSirenList(step.File)
+		if err != nil {
+			return nil, err
+		}
+		lists[i] = sirens
+	}
+	return lists, nil
+}
+
+// composePerimeter applies the steps to the perimeter, in order, with the lists of sirens read by
+// ReadCompositionLists, and counts the sirens they added or removed.
+func composePerimeter(perimeter map[string]struct{}, steps []CompositionStep, lists []map[string]struct{}) map[string]struct{} {
+	for i := range steps {
+		step, sirens := &steps[i], lists[i]
+		switch step.Operation {
+		case Union, Include:
+			for siren := range sirens {
+				if _, ok := perimeter[siren]; !ok {
+					perimeter[siren] = struct{}{}
+					step.Added++
+				}
+			}
+		case Intersection:
+			for siren := range perimeter {
+				if _, ok := sirens[siren]; !ok {
+					delete(perimeter, siren)
+					step.Removed++
+				}
+			}
+		case Exclude:
+			for siren := range sirens {
+				if _, ok := perimeter[siren]; ok {
+					delete(perimeter, siren)
+					step.Removed++
+				}
+			}
+		}
+	}
+	return perimeter
+}
+
+// ReadSirenList reads the sirens of the "siren" column of a CSV file, separated by "," or ";".
+// Malformed sirens make it fail, so that mistakes in lists maintained by hand are noticed.
+func ReadSirenList(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	firstBytes, _ := reader.Peek(1024) // shorter if the file is, the error is reported by r.Read()
+	r := csv.NewReader(reader)
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	if firstLine, _, _ := strings.Cut(string(firstBytes), "\n"); strings.Contains(firstLine, ";") {
+		r.Comma = ';'
+	}
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	col := findColumn(header, "siren")
+	if col < 0 {
+		return nil, fmt.Errorf("%s: colonne \"siren\" introuvable", path)
+	}
+	sirens := map[string]struct{}{}
+	for lineNumber := 2; ; lineNumber++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if col >= len(record) || strings.TrimSpace(record[col]) == "" {
+			continue
+		}
+		siren := strings.TrimSpace(record[col])
+		if siret.CheckSiren(siren) == siret.ErrFormat {
+			return nil, fmt.Errorf("%s: siren mal formé %q à la ligne %d", path, siren, lineNumber)
+		}
+		sirens[siren] = struct{}{}
+	}
+	return sirens, nil
+}
@@ -0,0 +1,88 @@
+package createfilter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComposePerimeter(t *testing.T) {
+	previousFilter := writeTempFile(t, "siren\n111111111\n333333333\n")
+	includeList := writeTempFile(t, "siren;commentaire\n444444444;suivi demandé\n111111111;déjà inclus\n")
+	excludeList := writeTempFile(t, "raison_sociale,siren\nENTREPRISE,333333333\nENTREPRISE,555555555\n")
+
+	testCases := []struct {
+		name     string
+		steps    []CompositionStep
+		expected map[string]struct{}
+		counts   [][2]int // added and removed sirens, for each step
+	}{
+		{
+			"union with a previous filter",
+			[]CompositionStep{{Operation: Union, File: previousFilter}},
+			map[string]struct{}{"111111111": {}, "222222222": {}, "333333333": {}},
+			[][2]int{{1, 0}},
+		},
+		{
+			"intersection with a previous filter",
+			[]CompositionStep{{Operation: Intersection, File: previousFilter}},
+			map[string]struct{}{"111111111": {}},
+			[][2]int{{0, 1}},
+		},
+		{
+			"steps are applied in order",
+			[]CompositionStep{{Operation: Union, File: previousFilter}, {Operation: Include, File: includeList}, {Operation: Exclude, File: excludeList}},
+			map[string]struct{}{"111111111": {}, "222222222": {}, "444444444": {}},
+			[][2]int{{1, 0}, {1, 0}, {0, 1}},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			perimeter := map[string]struct{}{"111111111": {}, "222222222": {}}
+			lists, err := ReadCompositionLists(testCase.steps)
+			if assert.NoError(t, err) {
+				actual := composePerimeter(perimeter, testCase.steps, lists)
+				assert.Equal(t, testCase.expected, actual)
+				for i, step := range testCase.steps {
+					assert.Equal(t, testCase.counts[i], [2]int{step.Added, step.Removed}, step.Operation)
+				}
+			}
+		})
+	}
+
+	t.Run("fails on an unknown operation", func(t *testing.T) {
+		_, err := ReadCompositionLists([]CompositionStep{{Operation: "xor", File: previousFilter}})
+		assert.EqualError(t, err, "opération de composition inconnue : xor")
+	})
+
+	t.Run("fails on a malformed list, before writing the filter", func(t *testing.T) {
+		malformedList := writeTempFile(t, "siren\n12AB\n")
+		var output bytes.Buffer
+		effectifFile := writeTempFile(t, "siret;eff201011\n11111111100015;40\n")
+		err := CreateFilter(&output, effectifFile, DefaultNbMois, DefaultMinEffectif, PerEtablissement, false, nil, []CompositionStep{{Operation: Include, File: malformedList}})
+		assert.EqualError(t, err, malformedList+": siren mal formé \"12AB\" à la ligne 2")
+		assert.Empty(t, output.String())
+	})
+}
+
+func TestReadSirenList(t *testing.T) {
+	t.Run("fails if a siren is malformed", func(t *testing.T) {
+		path := writeTempFile(t, "siren\n111111111\n11111111\n")
+		_, err := ReadSirenList(path)
+		assert.EqualError(t, err, path+": siren mal formé \"11111111\" à la ligne 3")
+	})
+
+	t.Run("fails if there is no siren column", func(t *testing.T) {
+		path := writeTempFile(t, "siret\n11111111100015\n")
+		_, err := ReadSirenList(path)
+		assert.EqualError(t, err, path+": colonne \"siren\" introuvable")
+	})
+
+	t.Run("skips empty values", func(t *testing.T) {
+		sirens, err := ReadSirenList(writeTempFile(t, "siren;commentaire\n;à compléter\n111111111;\n"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, map[string]struct{}{"111111111": {}}, sirens)
+		}
+	})
+}
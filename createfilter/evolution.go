@@ -0,0 +1,200 @@
+package createfilter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// reasons of the changes of the perimeter which are not due to a rule of SireneRules
+const (
+	ReasonAbsentEffectif    = "absent_effectif"     // the company is missing from the effectif file, or its effectif is unknown
+	ReasonEffectifSousSeuil = "effectif_sous_seuil" // the effectif of the company didn't reach the threshold
+	ReasonComposition       = "composition"         // the company was added or removed by a composition step
+	ReasonInexpliquee       = "inexpliquee"         // the filter doesn't match the evaluation of the perimeter
+)
+
+// FilterEvaluation tells why each company belongs, or not, to the perimeter of a filter.
+type FilterEvaluation struct {
+	KnownEffectif  map[string]struct{} // sirens which effectif is known for one of the nbMois most recent periods
+	AboveThreshold map[string]struct{} // sirens which effectif reached the threshold, before applying the Sirene rules
+	Excluded       map[string]string   // sirens of AboveThreshold excluded by a Sirene rule, with the name of the rule
+	Evaluated      map[string]struct{} // sirens of the perimeter, after applying the Sirene rules and the composition
+	// Perimeter lists the sirens of the filter. It is Evaluated, unless it is replaced by the content of an
+	// existing filter file.
+	Perimeter map[string]struct{}
+	// Unevaluated tells that the perimeter couldn't be evaluated, e.g. for lack of an effectif file:
+	// Perimeter is then the content of a filter file, and the changes are unexplained.
+	Unevaluated bool
+}
+
+// EvaluateFilter evaluates the perimeter of a filter like CreateFilter does, with the filters of rules,
+// but keeps the outcome of each step of the evaluation, so that changes of the perimeter can be explained.
+func EvaluateFilter(effectifFileName string, nbMois, minEffectif int, mode PerimeterMode, rejectInvalidSirets bool, rules SireneRules, composition []CompositionStep) (FilterEvaluation, error) {
+	evaluation := FilterEvaluation{Excluded: map[string]string{}}
+	lists, err := ReadCompositionLists(composition)
+	if err != nil {
+		return FilterEvaluation{}, err
+	}
+	// the known effectif, above the threshold, and without the closed establishments, in a single read
+	targets := []perimeterTarget{{0, nil}, {minEffectif, nil}}
+	if rules.EtablissementFile != "" && mode != FromEffectifEnt {
+		keepSiret, err := ClosedEtablissementsFilter(rules.EtablissementFile, nil)
+		if err != nil {
+			return FilterEvaluation{}, err
+		}
+		targets = append(targets, perimeterTarget{minEffectif, keepSiret})
+	}
+	perimeters, err := evaluatePerimeters(effectifFileName, nbMois, mode, rejectInvalidSirets, targets...)
+	if err != nil {
+		return FilterEvaluation{}, err
+	}
+	evaluation.KnownEffectif, evaluation.AboveThreshold = perimeters[0], perimeters[1]
+	if len(perimeters) > 2 {
+		withoutClosed := perimeters[2]
+		for siren := range evaluation.AboveThreshold {
+			if _, ok := withoutClosed[siren]; !ok {
+				evaluation.Excluded[siren] = RuleEtablissementFerme
+			}
+		}
+	}
+	if rules.UniteLegaleFile != "" {
+		excludedSirens, err := readExcludedSirensCached(rules.UniteLegaleFile, rules)
+		if err != nil {
+			return FilterEvaluation{}, err
+		}
+		for siren := range evaluation.AboveThreshold {
+			if rule, ok := excludedSirens[siren]; ok {
+				if _, alreadyExcluded := evaluation.Excluded[siren]; !alreadyExcluded {
+					evaluation.Excluded[siren] = rule
+				}
+			}
+		}
+	}
+	evaluation.Evaluated = composePerimeter(evaluation.kept(), composition, lists)
+	evaluation.Perimeter = evaluation.Evaluated
+	return evaluation, nil
+}
+
+// kept returns the sirens which effectif reached the threshold, and which were not excluded by a rule.
+func (evaluation FilterEvaluation) kept() map[string]struct{} {
+	kept := map[string]struct{}{}
+	for siren := range evaluation.AboveThreshold {
+		if _, excluded := evaluation.Excluded[siren]; !excluded {
+			kept[siren] = struct{}{}
+		}
+	}
+	return kept
+}
+
+// addedByComposition tells whether a company belongs to the perimeter only because of a composition step.
+func (evaluation FilterEvaluation) addedByComposition(siren string) bool {
+	_, evaluated := evaluation.Evaluated[siren]
+	_, aboveThreshold := evaluation.AboveThreshold[siren]
+	_, excluded := evaluation.Excluded[siren]
+	return evaluated && (!aboveThreshold || excluded)
+}
+
+// exclusionReason returns the reason why a company doesn't belong to the perimeter.
+func (evaluation FilterEvaluation) exclusionReason(siren string) string {
+	if _, ok := evaluation.Evaluated[siren]; ok || evaluation.Unevaluated {
+		return ReasonInexpliquee
+	}
+	if rule, ok := evaluation.Excluded[siren]; ok {
+		return rule
+	}
+	if _, ok := evaluation.AboveThreshold[siren]; ok {
+		return ReasonComposition
+	}
+	if _, ok := evaluation.KnownEffectif[siren]; !ok {
+		return ReasonAbsentEffectif
+	}
+	return ReasonEffectifSousSeuil
+}
+
+// Evolution tells whether a company entered or left the perimeter.
+type Evolution string
+
+const (
+	// Entered means that the company belongs to the new perimeter, but didn't belong to the previous one.
+	Entered Evolution = "entree"
+	// Left means that the company belonged to the previous perimeter, but doesn't belong to the new one.
+	Left Evolution = "sortie"
+)
+
+// FilterChange explains why a company entered or left the perimeter.
+// The reason is the name of a rule of SireneRules, or one of the Reason* constants. For a company
+// which left the perimeter, it tells why the company is now excluded; for a company which entered
+// the perimeter, it tells why the company was excluded from the previous perimeter.
+type FilterChange struct {
+	Siren     string    `json:"siren"`
+	Evolution Evolution `json:"evolution"`
+	Reason    string    `json:"raison"`
+}
+
+// FilterChanges lists the changes between two perimeters, ordered by siren.
+type FilterChanges []FilterChange
+
+// CompareFilterEvaluations lists the companies which entered or left the perimeter between two evaluations.
+func CompareFilterEvaluations(previous, current FilterEvaluation) FilterChanges {
+	changes := FilterChanges{}
+	for siren := range previous.Perimeter {
+		if _, ok := current.Perimeter[siren]; ok {
+			continue
+		}
+		reason := current.exclusionReason(siren)
+		if previous.addedByComposition(siren) {
+			reason = ReasonComposition
+		}
+		changes = append(changes, FilterChange{siren, Left, reason})
+	}
+	for siren := range current.Perimeter {
+		if _, ok := previous.Perimeter[siren]; ok {
+			continue
+		}
+		reason := previous.exclusionReason(siren)
+		if current.addedByComposition(siren) {
+			reason = ReasonComposition
+		}
+		changes = append(changes, FilterChange{siren, Entered, reason})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Siren < changes[j].Siren })
+	return changes
+}
+
+// Count returns the number of changes, for each evolution and reason.
+func (changes FilterChanges) Count() map[Evolution]map[string]int {
+	counts := map[Evolution]map[string]int{Entered: {}, Left: {}}
+	for _, change := range changes {
+		counts[change.Evolution][change.Reason]++
+	}
+	return counts
+}
+
+// Print prints the number of changes, for each evolution and reason.
+func (changes FilterChanges) Print() {
+	counts := changes.Count()
+	verbs := map[Evolution]string{Entered: "entered", Left: "left"}
+	for _, evolution := range []Evolution{Entered, Left} {
+		reasons := make([]string, 0, len(counts[evolution]))
+		for reason := range counts[evolution] {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			println(fmt.Sprintf("Info: %d sirens %s the perimeter, because of %q", counts[evolution][reason], verbs[evolution], reason))
+		}
+	}
+}
+
+// WriteCSV writes the changes as a CSV file, with the columns "siren", "evolution" and "raison".
+func (changes FilterChanges) WriteCSV(writer io.Writer) error {
+	w := csv.NewWriter(writer)
+	w.Write([]string{"siren", "evolution", "raison"})
+	for _, change := range changes {
+		w.Write([]string{change.Siren, string(change.Evolution), change.Reason})
+	}
+	w.Flush()
+	return w.Error()
+}
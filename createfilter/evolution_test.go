@@ -0,0 +1,98 @@
+package createfilter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeEffectifFile writes an effectif file with one establishment per siren, which effectif is
+// provided for the two last periods.
+func makeEffectifFile(t *testing.T, effectifPerSiren map[string][2]int) string {
+	t.Helper()
+	sirens := []string{}
+	for siren := range effectifPerSiren {
+		sirens = append(sirens, siren)
+	}
+	sort.Strings(sirens)
+	content := "siret;eff201811;eff201812\n"
+	for _, siren := range sirens {
+		content += fmt.Sprintf("%s00011;%d;%d\n", siren, effectifPerSiren[siren][0], effectifPerSiren[siren][1])
+	}
+	return writeTempFile(t, content)
+}
+
+func evaluateFilter(t *testing.T, effectifFile string, rules SireneRules, composition []CompositionStep) FilterEvaluation {
+	t.Helper()
+	evaluation, err := EvaluateFilter(effectifFile, DefaultNbMois, DefaultMinEffectif, PerEtablissement, false, rules, composition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return evaluation
+}
+
+func TestCompareFilterEvaluations(t *testing.T) {
+	previous := evaluateFilter(t, makeEffectifFile(t, map[string][2]int{
+		"111111111": {20, 20},
+		"121212121": {20, 20},
+		"222222222": {20, 20},
+		"333333333": {20, 20},
+		"444444444": {20, 20},
+		"555555555": {5, 5},
+		"666666666": {20, 20},
+		"999999999": {20, 20},
+	}), SireneRules{UniteLegaleFile: makeSireneULFile(t, map[string][2]string{"666666666": {"A", "2000-01-01"}})}, nil)
+
+	current := evaluateFilter(t, makeEffectifFile(t, map[string][2]int{
+		"111111111": {20, 5}, // the last effectif is below the threshold, but the previous one is not
+		"121212121": {20, 20},
+		"222222222": {20, 20},
+		"333333333": {20, 20},
+		"555555555": {5, 20},
+		"666666666": {20, 20},
+		"777777777": {20, 20},
+		"999999999": {20, 20},
+	}), SireneRules{
+		UniteLegaleFile:   makeSireneULFile(t, map[string][2]string{"222222222": {"A", "2000-01-01"}}),
+		EtablissementFile: makeEtablissementFile(t, map[string]string{"33333333300011": "F"}, false),
+	}, []CompositionStep{
+		{Operation: Include, File: writeTempFile(t, "siren\n123456789\n")},
+		{Operation: Exclude, File: writeTempFile(t, "siren\n999999999\n")},
+	})
+
+	t.Run("explains why each company entered or left the perimeter", func(t *testing.T) {
+		expected := FilterChanges{
+			{"123456789", Entered, ReasonComposition},
+			{"222222222", Left, RuleCategorieJuridique},
+			{"333333333", Left, RuleEtablissementFerme},
+			{"444444444", Left, ReasonAbsentEffectif},
+			{"555555555", Entered, ReasonEffectifSousSeuil},
+			{"666666666", Entered, RuleActivite},
+			{"777777777", Entered, ReasonAbsentEffectif},
+			{"999999999", Left, ReasonComposition},
+		}
+		assert.Equal(t, expected, CompareFilterEvaluations(previous, current))
+	})
+
+	t.Run("reports the companies of a filter which don't match the evaluation", func(t *testing.T) {
+		previousFilter := previous
+		previousFilter.Perimeter = map[string]struct{}{"111111111": {}, "555555555": {}}
+		changes := CompareFilterEvaluations(previousFilter, current)
+		assert.Contains(t, changes, FilterChange{"121212121", Entered, ReasonInexpliquee})
+		assert.NotContains(t, changes, FilterChange{"555555555", Entered, ReasonEffectifSousSeuil})
+	})
+
+	t.Run("counts and writes the changes", func(t *testing.T) {
+		changes := CompareFilterEvaluations(previous, current)
+		counts := changes.Count()
+		assert.Equal(t, map[string]int{ReasonComposition: 1, ReasonEffectifSousSeuil: 1, RuleActivite: 1, ReasonAbsentEffectif: 1}, counts[Entered])
+		assert.Equal(t, map[string]int{RuleCategorieJuridique: 1, RuleEtablissementFerme: 1, ReasonAbsentEffectif: 1, ReasonComposition: 1}, counts[Left])
+
+		var output bytes.Buffer
+		assert.NoError(t, FilterChanges{{"123456789", Entered, ReasonComposition}}.WriteCSV(&output))
+		assert.Equal(t, "siren,evolution,raison\n123456789,entree,composition\n", output.String())
+	})
+}
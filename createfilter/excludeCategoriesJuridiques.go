@@ -1,9 +1,10 @@
 package createfilter
 
 import (
-	"context"
-	"github.com/signaux-faibles/goSirene"
 	"strings"
+	"time"
+
+	"github.com/signaux-faibles/goSirene"
 )
 
 func isExcludedCategorieJuridique(categorieJuridique string) bool {
@@ -47,24 +48,31 @@ func isExcludedActivity(activity string) bool {
 	return false
 }
 
-func readExcludedSirens(path string) map[string]struct{} {
-	sireneUL := goSirene.SireneULParser(context.Background(), path)
-	var excludedSirens = make(map[string]struct{})
-	for s := range sireneUL {
-		if isExcludedCategorieJuridique(s.CategorieJuridiqueUniteLegale) {
-			excludedSirens[s.Siren] = struct{}{}
+// readExcludedSirens lists the sirens of the sireneUL file which are excluded from the perimeter,
+// with the name of the first rule that excludes them. The file may be a zip archive, or have a "gzip:" prefix.
+func readExcludedSirens(path string, rules SireneRules) (map[string]string, error) {
+	var excludedSirens = make(map[string]string)
+	columns := []string{"siren", "categorieJuridiqueUniteLegale", "activitePrincipaleUniteLegale", "etatAdministratifUniteLegale", "dateCreationUniteLegale"}
+	err := readSireneColumns(path, columns, func(values []string) {
+		uniteLegale := goSirene.SireneUL{
+			Siren:                         values[0],
+			CategorieJuridiqueUniteLegale: values[1],
+			ActivitePrincipaleUniteLegale: values[2],
+			EtatAdministratifUniteLegale:  values[3],
 		}
-		if isExcludedActivity(s.ActivitePrincipaleUniteLegale) {
-			excludedSirens[s.Siren] = struct{}{}
+		uniteLegale.DateCreationUniteLegale, _ = time.Parse("2006-01-02", values[4]) // as goSirene does
+		if rule := rules.excludingRule(uniteLegale); rule != "" {
+			excludedSirens[uniteLegale.Siren] = rule
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
-	return excludedSirens
+	return excludedSirens, nil
 }
 
-func CategorieJuridiqueFilter(path string) filter {
-	var excludedSirens = readExcludedSirens(path)
-	return func(siren string) bool {
-		_, ok := excludedSirens[siren]
-		return !ok
-	}
+// CategorieJuridiqueFilter excludes the companies which categorie juridique or main activity
+// is excluded from the perimeter, according to the sireneUL file.
+func CategorieJuridiqueFilter(path string) (filter, error) {
+	return SireneULFilter(SireneRules{UniteLegaleFile: path}, nil)
 }
@@ -13,7 +13,8 @@ func TestExclusionList(t *testing.T) {
 	sireneULPath := "./test_uniteLegale.csv"
 
 	// WHEN
-	excludedSirens := readExcludedSirens(sireneULPath)
+	excludedSirens, err := readExcludedSirens(sireneULPath, SireneRules{})
+	ass.NoError(err)
 	_, ok1 := excludedSirens["111111111"]
 	_, ok2 := excludedSirens["222222222"]
 	_, ok3 := excludedSirens["333333333"]
@@ -31,7 +32,8 @@ func TestCategorieJuridiqueFilter(t *testing.T) {
 
 	// GIVEN
 	sireneULPath := "./test_uniteLegale.csv"
-	testFilter := CategorieJuridiqueFilter(sireneULPath)
+	testFilter, err := CategorieJuridiqueFilter(sireneULPath)
+	ass.NoError(err)
 	initialPerimeter := map[string]struct{}{
 		"111111111": {},
 		"222222222": {},
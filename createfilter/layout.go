@@ -0,0 +1,125 @@
+package createfilter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"prepare-import/periode"
+)
+
+// EffectifLayout locates the columns of an effectif (or effectif_ent) file, from the names of its header.
+// Columns that are neither the identifier nor a period ("effYYYYQM") are ignored, whatever their position.
+type EffectifLayout struct {
+	IdentifierCol int         // index of the "siret" (or "siren") column
+	PeriodCols    []int       // indexes of the period columns, sorted by period
+	Periods       []time.Time // period of each column of PeriodCols
+}
+
+// DetectEffectifLayout locates the identifier column named identifierColName, and the period columns of a header.
+func DetectEffectifLayout(header []string, identifierColName string) (EffectifLayout, error) {
+	layout := EffectifLayout{IdentifierCol: -1}
+	type periodCol struct {
+		index  int
+		period time.Time
+	}
+	periodCols := []periodCol{}
+	for i, colName := range header {
+		colName = strings.TrimSpace(colName)
+		if strings.EqualFold(colName, identifierColName) {
+			layout.IdentifierCol = i
+		} else if period, err := periode.FromEffectifColName(colName); err == nil {
+			periodCols = append(periodCols, periodCol{i, period.Start})
+		}
+	}
+	if layout.IdentifierCol < 0 {
+		return layout, fmt.Errorf("en-tête non reconnu : colonne %q introuvable parmi %s", identifierColName, strings.Join(header, ";"))
+	}
+	if len(periodCols) == 0 {
+		return layout, errors.New("en-tête non reconnu : aucune colonne de période (effAAAAQM) parmi " + strings.Join(header, ";"))
+	}
+	sort.SliceStable(periodCols, func(i, j int) bool { return periodCols[i].period.Before(periodCols[j].period) })
+	for _, col := range periodCols {
+		layout.PeriodCols = append(layout.PeriodCols, col.index)
+		layout.Periods = append(layout.Periods, col.period)
+	}
+	return layout, nil
+}
+
+// identifier returns the value of the identifier column of a record.
+func (layout EffectifLayout) identifier(record []string) string {
+	if layout.IdentifierCol >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[layout.IdentifierCol])
+}
+
+// values returns the values of the period columns of a record, sorted by period.
+func (layout EffectifLayout) values(record []string) []string {
+	values := make([]string, len(layout.PeriodCols))
+	for i, col := range layout.PeriodCols {
+		if col < len(record) {
+			values[i] = strings.TrimSpace(record[col])
+		}
+	}
+	return values
+}
+
+// truncate removes the period columns that come after the given index.
+func (layout EffectifLayout) truncate(lastPeriod int) EffectifLayout {
+	layout.PeriodCols = layout.PeriodCols[:lastPeriod+1]
+	layout.Periods = layout.Periods[:lastPeriod+1]
+	return layout
+}
+
+// lastPeriodWithValue returns the index, in layout.Periods, of the most recent period
+// which has a value in at least one record, or -1 if no record has any value.
+func lastPeriodWithValue(r *csv.Reader, layout EffectifLayout) (int, error) {
+	last := -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return last, err
+		}
+		values := layout.values(record)
+		for i := len(values) - 1; i > last; i-- {
+			if values[i] != "" {
+				last = i
+				break
+			}
+		}
+	}
+	return last, nil
+}
+
+// readEffectifLayout detects the layout of an effectif (or effectif_ent) file, without the most
+// recent period columns that never have a value.
+func readEffectifLayout(path string, identifierColName string) (EffectifLayout, error) {
+	r, f, err := makeEffectifReaderFromFile(path)
+	if err != nil {
+		return EffectifLayout{}, err
+	}
+	defer f.Close()
+	header, err := r.Read() // en tête
+	if err != nil {
+		return EffectifLayout{}, err
+	}
+	layout, err := DetectEffectifLayout(header, identifierColName)
+	if err != nil {
+		return layout, fmt.Errorf("%s: %w", path, err)
+	}
+	last, err := lastPeriodWithValue(r, layout)
+	if err != nil {
+		return layout, err
+	}
+	if last < 0 {
+		return layout, errors.New("no effectif value found in " + path)
+	}
+	return layout.truncate(last), nil
+}
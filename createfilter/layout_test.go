@@ -0,0 +1,35 @@
+package createfilter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectEffectifLayout(t *testing.T) {
+	t.Run("should locate the columns by their name, whatever their position", func(t *testing.T) {
+		header := []string{"eff201012", "rais_soc", "SIRET", "eff201011", "effectif", "eff", "base", "eff201021"}
+		layout, err := DetectEffectifLayout(header, "siret")
+		if assert.NoError(t, err) {
+			assert.Equal(t, 2, layout.IdentifierCol)
+			assert.Equal(t, []int{3, 0, 7}, layout.PeriodCols)
+			assert.Equal(t, []time.Time{
+				time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2010, time.February, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2010, time.April, 1, 0, 0, 0, 0, time.UTC),
+			}, layout.Periods)
+			assert.Equal(t, []string{"4", "5", ""}, layout.values([]string{"5", "ENTREPRISE", "11111111100001", "4"}))
+		}
+	})
+
+	t.Run("should fail if the identifier column is missing", func(t *testing.T) {
+		_, err := DetectEffectifLayout([]string{"compte", "siren", "eff201011"}, "siret")
+		assert.EqualError(t, err, `en-tête non reconnu : colonne "siret" introuvable parmi compte;siren;eff201011`)
+	})
+
+	t.Run("should fail if there is no period column", func(t *testing.T) {
+		_, err := DetectEffectifLayout([]string{"compte", "siret", "effectif"}, "siret")
+		assert.EqualError(t, err, "en-tête non reconnu : aucune colonne de période (effAAAAQM) parmi compte;siret;effectif")
+	})
+}
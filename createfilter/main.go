@@ -4,15 +4,19 @@ import (
 	"bufio"
 	"compress/gzip"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"prepare-import/siret"
 )
 
 // Usage: $ ./create_filter --path test_data.csv
@@ -23,18 +27,12 @@ const DefaultNbMois = 100
 // DefaultMinEffectif is the default effectif threshold, expressed in number of employees.
 const DefaultMinEffectif = 10
 
-// DefaultNbIgnoredCols is the default number of rightmost columns that don't contain effectif data.
-const DefaultNbIgnoredCols = 2
-
-// NbLeadingColsToSkip is the number of leftmost columns that don't contain effectif data.
-const NbLeadingColsToSkip = 5 // column names: "compte", "siret", "rais_soc", "ape_ins" and "dep"
-
 type filter func(string) bool
 
 // Implementation of the create_filter command.
 func main() {
 
-	var path = flag.String("path", "", "Chemin d'accès au fichier effectif")
+	var path = flag.String("path", "", "Chemin d'accès au fichier effectif (ou effectif_ent)")
 	var nbMois = flag.Int(
 		"nbMois",
 		DefaultNbMois,
@@ -45,39 +43,124 @@ func main() {
 		DefaultMinEffectif,
 		"Si une entreprise atteint ou dépasse 'minEffectif' dans les 'nbMois' derniers mois, elle est inclue dans le périmètre du filtre.",
 	)
-	var nIgnoredCols = flag.Int(
-		"nIgnoredCols",
-		DefaultNbIgnoredCols,
-		"Nombre de colonnes à ignorer à la fin du fichier effectif",
+	var rejectInvalidSirets = flag.Bool(
+		"rejectInvalidSirets",
+		false,
+		"Exclure du périmètre les établissements dont la clé du siret est invalide",
+	)
+	var perimeterMode = flag.String(
+		"mode",
+		string(DefaultPerimeterMode),
+		"Évaluation de l'effectif d'une entreprise : \"etablissement\" (effectif de chaque établissement), "+
+			"\"siren\" (somme des effectifs de ses établissements) ou \"effectif_ent\" (effectif de l'entreprise, "+
+			"l'option -path désignant alors un fichier effectif_ent)",
 	)
 	flag.Parse()
 
-	err := CreateFilter(os.Stdout, *path, *nbMois, *minEffectif, *nIgnoredCols)
+	mode, err := ParsePerimeterMode(*perimeterMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = CreateFilter(os.Stdout, *path, *nbMois, *minEffectif, mode, *rejectInvalidSirets, nil, nil)
 	if err != nil {
 		log.Panic(err)
 	}
 }
 
-// CreateFilter generates a "filter" from an "effectif" file.
-// If the effectif file has a "gzip:" prefix, it will be decompressed on the fly.
-func CreateFilter(writer io.Writer, effectifFileName string, nbMois, minEffectif int, nIgnoredCols int, filters ...filter) error {
-	last := guessLastNMissing(effectifFileName, nIgnoredCols)
-	r, f, err := makeEffectifReaderFromFile(effectifFileName)
+// CreateFilter generates a "filter" from an "effectif" file, or from an "effectif_ent" file
+// if mode is FromEffectifEnt. The mode also tells how the effectif of a company is evaluated.
+// The columns of the file are located by their name, cf DetectEffectifLayout.
+// If the file has a "gzip:" prefix, it will be decompressed on the fly.
+// Malformed identifiers are always skipped; identifiers which key is invalid are skipped if rejectInvalidSirets is true.
+// Establishments rejected by keepSiret (if not nil) are ignored, except in the FromEffectifEnt mode.
+// Once filtered, the perimeter is combined with the lists of sirens of composition, in order; the number
+// of sirens added or removed by each step is reported in composition.
+func CreateFilter(writer io.Writer, effectifFileName string, nbMois, minEffectif int, mode PerimeterMode, rejectInvalidSirets bool, keepSiret SiretFilter, composition []CompositionStep, filters ...filter) error {
+	if mode == FromEffectifEnt && keepSiret != nil {
+		println("Warning: the state of establishments is not considered when the perimeter is evaluated from an effectif_ent file")
+	}
+	lists, err := ReadCompositionLists(composition)
+	if err != nil {
+		return err
+	}
+	perimeter, err := evaluatePerimeter(effectifFileName, nbMois, minEffectif, mode, rejectInvalidSirets, keepSiret)
 	if err != nil {
 		return err
 	}
-
-	perimeter := getInitialPerimeter(r, nbMois, minEffectif, nIgnoredCols+last)
 
 	for _, f := range filters {
 		perimeter = applyFilter(perimeter, f)
 	}
+	perimeter = composePerimeter(perimeter, composition, lists)
+
+	sirens := make([]string, 0, len(perimeter))
+	for siren := range perimeter {
+		sirens = append(sirens, siren)
+	}
+	sort.Strings(sirens) // for a deterministic output
 
 	fmt.Fprintln(writer, "siren")
-	for siren, _ := range perimeter {
+	for _, siren := range sirens {
 		fmt.Fprintln(writer, siren)
 	}
-	return f.Close()
+	return nil
+}
+
+// evaluatePerimeter returns the sirens of the companies which effectif reached minEffectif, according to
+// the effectif (or effectif_ent) file, before any filter is applied. Cf CreateFilter for the parameters.
+func evaluatePerimeter(effectifFileName string, nbMois, minEffectif int, mode PerimeterMode, rejectInvalidSirets bool, keepSiret SiretFilter) (map[string]struct{}, error) {
+	perimeters, err := evaluatePerimeters(effectifFileName, nbMois, mode, rejectInvalidSirets, perimeterTarget{minEffectif, keepSiret})
+	if err != nil {
+		return nil, err
+	}
+	return perimeters[0], nil
+}
+
+// perimeterTarget tells which companies belong to a perimeter: those which effectif reached minEffectif,
+// ignoring the establishments rejected by keepSiret (if not nil).
+type perimeterTarget struct {
+	minEffectif int
+	keepSiret   SiretFilter
+}
+
+func (target perimeterTarget) keeps(siret string) bool {
+	return target.keepSiret == nil || target.keepSiret(siret)
+}
+
+// evaluatePerimeters is like evaluatePerimeter, but returns the perimeter of each target, reading the
+// effectif (or effectif_ent) file once.
+func evaluatePerimeters(effectifFileName string, nbMois int, mode PerimeterMode, rejectInvalidSirets bool, targets ...perimeterTarget) ([]map[string]struct{}, error) {
+	layout, err := readEffectifLayout(effectifFileName, identifierColName(mode))
+	if err != nil {
+		return nil, err
+	}
+	r, f, err := makeEffectifReaderFromFile(effectifFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := r.Read(); err != nil { // en tête
+		return nil, err
+	}
+
+	switch mode {
+	case PerEtablissement:
+		return getInitialPerimeter(r, layout, nbMois, rejectInvalidSirets, targets...)
+	case PerSiren:
+		return getSummedPerimeter(r, layout, nbMois, rejectInvalidSirets, targets...)
+	case FromEffectifEnt:
+		return getEffectifEntPerimeter(r, layout, nbMois, rejectInvalidSirets, targets...)
+	}
+	return nil, errors.New("mode de périmètre inconnu : " + string(mode))
+}
+
+// identifierColName returns the name of the column which identifies the lines of the file read in a perimeter mode.
+func identifierColName(mode PerimeterMode) string {
+	if mode == FromEffectifEnt {
+		return "siren"
+	}
+	return "siret"
 }
 
 func applyFilter(perimeter map[string]struct{}, f filter) map[string]struct{} {
@@ -119,113 +202,112 @@ func initializeEffectifReader(reader io.Reader) *csv.Reader {
 	return r
 }
 
-func getInitialPerimeter(r *csv.Reader, nbMois, minEffectif, nIgnoredCols int) map[string]struct{} {
-	detectedSirens := map[string]struct{}{} // smaller memory footprint than map[string]bool
-	_, err := r.Read()                      // en tête
-	if err != nil {
-		log.Panic(err)
+// getInitialPerimeter returns, for each target, the sirens of companies which have an establishment which
+// effectif reached its minEffectif. The reader must be positioned after the header.
+// Lines with a malformed siret are skipped. Lines with a siret which key is invalid are
+// only reported, unless rejectInvalidSirets is true. Establishments rejected by the keepSiret of a target are ignored.
+func getInitialPerimeter(r *csv.Reader, layout EffectifLayout, nbMois int, rejectInvalidSirets bool, targets ...perimeterTarget) ([]map[string]struct{}, error) {
+	detectedSirens := make([]map[string]struct{}, len(targets)) // smaller memory footprint than map[string]bool
+	for i := range detectedSirens {
+		detectedSirens[i] = map[string]struct{}{}
 	}
-	lineNumber, skippedLines := 0, 0
-	for {
-		lineNumber++
+	stats := identifierStats{kind: "siret", reject: rejectInvalidSirets}
+	for lineNumber := 1; ; lineNumber++ {
 		record, err := r.Read()
 
 		// Stop at EOF.
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Panic(err)
+			return nil, err
+		}
+		siretNumber := layout.identifier(record)
+		if !stats.accept(siret.CheckSiret(siretNumber), siretNumber, lineNumber) {
+			continue
 		}
-		siret := record[1]
-		shouldKeep := len(siret) == 14 &&
-			isInsidePerimeter(record[NbLeadingColsToSkip:len(record)-nIgnoredCols], nbMois, minEffectif)
-
-		var siren string
-		if len(siret) >= 9 {
-			siren = siret[0:9] // trim siret into a siren
-			_, alreadyDetected := detectedSirens[siren]
-			if shouldKeep && !alreadyDetected {
-				detectedSirens[siren] = struct{}{}
+		for i, target := range targets {
+			if target.keeps(siretNumber) && isInsidePerimeter(layout.values(record), nbMois, target.minEffectif) {
+				detectedSirens[i][siretNumber[0:9]] = struct{}{} // trim siret into a siren
 			}
-		} else {
-			skippedLines++
-			fmt.Printf("%d digit siret encountered, skipping line %d \n", len(siret), lineNumber)
 		}
 	}
-	if skippedLines > 0 {
-		fmt.Printf("%d lines with bad siret/siren skipped :( \n", skippedLines)
+	stats.print()
+	return detectedSirens, nil
+}
+
+// identifierStats counts the invalid identifiers encountered while reading a file.
+type identifierStats struct {
+	kind             string // "siret" or "siren"
+	reject           bool   // whether identifiers which key is invalid are rejected
+	skippedLines     int
+	invalidChecksums int
+}
+
+// accept tells whether the line of an identifier, given the result of its validation, must be considered.
+func (stats *identifierStats) accept(err error, identifier string, lineNumber int) bool {
+	switch err {
+	case siret.ErrFormat:
+		stats.skippedLines++
+		fmt.Printf("malformed %s %q encountered, skipping line %d \n", stats.kind, identifier, lineNumber)
+		return false
+	case siret.ErrChecksum:
+		stats.invalidChecksums++
+		return !stats.reject
+	}
+	return true
+}
+
+func (stats identifierStats) print() {
+	if stats.skippedLines > 0 {
+		fmt.Printf("%d lines with bad siret/siren skipped :( \n", stats.skippedLines)
+	}
+	if stats.invalidChecksums > 0 && stats.reject {
+		fmt.Printf("%d lines with a %s which key is invalid skipped \n", stats.invalidChecksums, stats.kind)
+	} else if stats.invalidChecksums > 0 {
+		fmt.Printf("Warning: %d lines with a %s which key is invalid \n", stats.invalidChecksums, stats.kind)
 	}
-	return detectedSirens
 }
 
+var nonDigits = regexp.MustCompile("[^0-9]")
+
 func isInsidePerimeter(record []string, nbMois, minEffectif int) bool {
 	for i := len(record) - 1; i >= len(record)-nbMois && i >= 0; i-- {
 		if record[i] == "" {
 			continue
 		}
-		reg, err := regexp.Compile("[^0-9]")
-		if err != nil {
-			log.Fatal(err)
-		}
-		effectif, err := strconv.Atoi(reg.ReplaceAllString(record[i], ""))
-		if err != nil {
-			fmt.Println(record)
-			log.Panic(err)
-		}
-		if effectif >= minEffectif {
+		if parseEffectif(record[i], record) >= minEffectif {
 			return true
 		}
 	}
 	return false
 }
 
-// DetectDateFinEffectif determines DateFinEffectif by parsing the effectif file.
-func DetectDateFinEffectif(path string, nIgnoredCols int) (dateFinEffectif time.Time, err error) {
-	r, f, err := makeEffectifReaderFromFile(path)
-	if err != nil {
-		return time.Time{}, err
-	}
-	defer f.Close()
-	header, err := r.Read() // en tête
+// parseEffectif returns the number of employees of an effectif cell, ignoring any non-digit character.
+func parseEffectif(value string, record []string) int {
+	effectif, err := strconv.Atoi(nonDigits.ReplaceAllString(value, ""))
 	if err != nil {
-		return time.Time{}, err
+		fmt.Println(record)
+		log.Panic(err)
 	}
-	nbColsToExclude := guessLastNMissingFromReader(r, nIgnoredCols)
-	lastColWithValue := len(header) - 1 - nbColsToExclude - nIgnoredCols
-	lastPeriodWithValue := header[lastColWithValue]
-	return effectifColNameToDate(lastPeriodWithValue)
+	return effectif
 }
 
-func guessLastNMissing(path string, nIgnoredCols int) int {
-	r, f, err := makeEffectifReaderFromFile(path)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer f.Close()
-	if _, err = r.Read(); err != nil { // en tête
-		log.Panic(err)
-	}
-	return guessLastNMissingFromReader(r, nIgnoredCols)
+// DetectDateFinEffectif determines DateFinEffectif by parsing the effectif file, i.e.
+// the most recent period column which has a value in at least one row.
+func DetectDateFinEffectif(path string) (time.Time, error) {
+	return detectDateFinEffectif(path, "siret")
 }
 
-// guessLastNMissingFromReader returns the number of rightmost columns
-// (on top of nIgnoredCols columns) that never have a value.
-func guessLastNMissingFromReader(r *csv.Reader, nIgnoredCols int) int {
-	var lastConsideredCol int // index of the rightmost column of the last read row
-	lastColWithValue := -1    // index of the rightmost column which had a value at least once
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Panic(err)
-		}
-		lastConsideredCol = len(record) - 1 - nIgnoredCols
-		for i := lastConsideredCol; i > lastColWithValue; i-- {
-			if record[i] != "" {
-				lastColWithValue = i
-			}
-		}
+// DetectDateFinEffectifEnt determines DateFinEffectif by parsing an "effectif_ent" file, i.e.
+// the most recent period column which has a value in at least one row.
+func DetectDateFinEffectifEnt(path string) (time.Time, error) {
+	return detectDateFinEffectif(path, "siren")
+}
+
+func detectDateFinEffectif(path string, identifierColName string) (time.Time, error) {
+	layout, err := readEffectifLayout(path, identifierColName)
+	if err != nil {
+		return time.Time{}, err
 	}
-	return lastConsideredCol - lastColWithValue
+	return layout.Periods[len(layout.Periods)-1], nil
 }
@@ -6,6 +6,8 @@ import (
 	"encoding/csv"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -26,8 +28,9 @@ func TestCreateFilter(t *testing.T) {
 		var cmdOutput bytes.Buffer
 		var cmdError bytes.Buffer = *bytes.NewBufferString("") // default: no error
 
-		categorieJuridiqueFilter := CategorieJuridiqueFilter("./test_uniteLegale.csv")
-		err := CreateFilter(&cmdOutput, "test_data.csv", DefaultNbMois, DefaultMinEffectif, DefaultNbIgnoredCols, categorieJuridiqueFilter)
+		categorieJuridiqueFilter, err := CategorieJuridiqueFilter("./test_uniteLegale.csv")
+		assert.NoError(t, err)
+		err = CreateFilter(&cmdOutput, "test_data.csv", DefaultNbMois, DefaultMinEffectif, DefaultPerimeterMode, false, nil, nil, categorieJuridiqueFilter)
 		if err != nil {
 			cmdError = *bytes.NewBufferString(err.Error())
 		}
@@ -54,7 +57,6 @@ func TestOutputPerimeter(t *testing.T) {
 	t.Run("le département de l'entreprise n'est pas considéré comme une valeur d'effectif", func(t *testing.T) {
 		// setup conditions and expectations
 		minEffectif := 10
-		nbIgnoredCols := 2 // "base" and "UR_EMET"
 		expectedSirens := []string{"222222222", "333333333"}
 		csvLines := []string{
 			"compte;siret;rais_soc;ape_ins;dep;eff201011;eff201012;base;UR_EMET",
@@ -64,7 +66,7 @@ func TestOutputPerimeter(t *testing.T) {
 			"333333333333333333;33333333333333;ENTREPRISE;1234Z;92;14;14;116;075077", // ✅ siren retenu car 14 est bien un effectif ≥ 10
 		}
 		// test: run outputPerimeter() on csv lines
-		actualSirens := getOutputPerimeter(csvLines, DefaultNbMois, minEffectif, nbIgnoredCols)
+		actualSirens := getOutputPerimeter(csvLines, DefaultNbMois, minEffectif, false)
 		sort.Strings(actualSirens)
 
 		// assert
@@ -74,7 +76,6 @@ func TestOutputPerimeter(t *testing.T) {
 	t.Run("outputPerimeter ne doit pas contenir deux fois le même siren", func(t *testing.T) {
 		// setup conditions and expectations
 		minEffectif := 1
-		nbIgnoredCols := 0
 		expectedSirens := []string{"111111111", "333333333"}
 		csvLines := []string{
 			"compte;siret;rais_soc;ape_ins;dep;eff201011",
@@ -83,22 +84,43 @@ func TestOutputPerimeter(t *testing.T) {
 			"333333333333333333;33333333333333;ENTREPRISE;1234Z;92;1",
 		}
 		// test: run outputPerimeter() on csv lines
-		actualSirens := getOutputPerimeter(csvLines, DefaultNbMois, minEffectif, nbIgnoredCols)
+		actualSirens := getOutputPerimeter(csvLines, DefaultNbMois, minEffectif, false)
 		sort.Strings(actualSirens)
 		// assert
 		assert.Equal(t, expectedSirens, actualSirens)
 	})
+
+	t.Run("outputPerimeter ne doit pas contenir de siret mal formé, ni de siret dont la clé est invalide si demandé", func(t *testing.T) {
+		csvLines := []string{
+			"compte;siret;rais_soc;ape_ins;dep;eff201011",
+			"111111111111111111;73282932000074;ENTREPRISE;1234Z;53;1", // ✅ siret valide
+			"222222222222222222;3560000001234A;ENTREPRISE;1234Z;53;1", // ❌ siret mal formé
+			"333333333333333333;33333333333333;ENTREPRISE;1234Z;92;1", // clé invalide
+		}
+		actualSirens := getOutputPerimeter(csvLines, DefaultNbMois, 1, false)
+		sort.Strings(actualSirens)
+		assert.Equal(t, []string{"333333333", "732829320"}, actualSirens)
+		assert.Equal(t, []string{"732829320"}, getOutputPerimeter(csvLines, DefaultNbMois, 1, true))
+	})
 }
 
 // wrapper to run outputPerimeter() on a slice of csv lines
-func getOutputPerimeter(csvLines []string, nbMois, minEffectif, nbIgnoredCols int) (actualSirens []string) {
+func getOutputPerimeter(csvLines []string, nbMois, minEffectif int, rejectInvalidSirets bool) (actualSirens []string) {
 	effectifData := strings.Join(csvLines, "\n")
 	var output bytes.Buffer
 	reader := csv.NewReader(strings.NewReader(effectifData))
 	reader.Comma = ';'
 	writer := bufio.NewWriter(&output)
-	perimeter := getInitialPerimeter(reader, nbMois, minEffectif, nbIgnoredCols)
-	for siren, _ := range perimeter {
+	header, _ := reader.Read()
+	layout, err := DetectEffectifLayout(header, "siret")
+	if err != nil {
+		panic(err)
+	}
+	perimeters, err := getInitialPerimeter(reader, layout, nbMois, rejectInvalidSirets, perimeterTarget{minEffectif, nil})
+	if err != nil {
+		panic(err)
+	}
+	for siren, _ := range perimeters[0] {
 		fmt.Fprintln(writer, siren)
 	}
 	writer.Flush()
@@ -107,12 +129,36 @@ func getOutputPerimeter(csvLines []string, nbMois, minEffectif, nbIgnoredCols in
 
 func TestDetectDateFinEffectif(t *testing.T) {
 	expectedDate := time.Date(2020, time.Month(1), 1, 0, 0, 0, 0, time.UTC)
-	actualDate, err := DetectDateFinEffectif("test_data.csv", DefaultNbIgnoredCols) // => col name: "eff202011"
+	actualDate, err := DetectDateFinEffectif("test_data.csv") // => col name: "eff202011"
 	if assert.NoError(t, err) {
 		assert.Equal(t, expectedDate, actualDate)
 	}
 }
 
+func TestDetectDateFinEffectifEnt(t *testing.T) {
+	t.Run("should return the last period column with a value", func(t *testing.T) {
+		path := writeTempFile(t, "siren;rais_soc;eff201011;eff201012;eff201013\n111111111;ENTREPRISE;4;5;\n222222222;ENTREPRISE;4;;\n")
+		actualDate, err := DetectDateFinEffectifEnt(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, time.Date(2010, time.February, 1, 0, 0, 0, 0, time.UTC), actualDate)
+		}
+	})
+
+	t.Run("should fail if there is no period column", func(t *testing.T) {
+		path := writeTempFile(t, "siren;rais_soc\n111111111;ENTREPRISE\n")
+		_, err := DetectDateFinEffectifEnt(path)
+		assert.ErrorContains(t, err, "aucune colonne de période")
+	})
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
 func TestIsInsidePerimeter(t *testing.T) {
 	nbMois := 3 // => seules les valeurs d'effectif des 3 derniers mois vont être considérées
 	minEffectif := 10
@@ -136,46 +182,29 @@ func TestIsInsidePerimeter(t *testing.T) {
 	}
 }
 
-func TestGuessLastNonMissing(t *testing.T) {
+func TestLastPeriodWithValue(t *testing.T) {
 	testCases := []struct {
 		inputCsv string
 		expected int
 	}{
-		{"1,", 1},
-		{",1", 0},
-		{"1,1", 0},
-		{",", 2},
-		{",\n,1", 0},
-		{"1,\n,", 1},
-		{"1,\n1,", 1},
+		{"1,", 0},
+		{",1", 1},
+		{"1,1", 1},
+		{",", -1},
+		{",\n,1", 1},
+		{"1,\n,", 0},
+		{"1,\n1,", 0},
 	}
+	layout := EffectifLayout{PeriodCols: []int{1, 2}}
 
 	for i, tc := range testCases {
-		t.Run("Test case without ignored "+strconv.Itoa(i), func(t *testing.T) {
-			reader := csv.NewReader(strings.NewReader(tc.inputCsv))
-			lastNonMissing := guessLastNMissingFromReader(reader, 0)
-			assert.Equal(t, tc.expected, lastNonMissing)
-		})
-	}
-
-	testCasesIgnore := []struct {
-		inputCsv string
-		expected int
-	}{
-		{"1,,1", 1},
-		{",1,1", 0},
-		{"1,1,1", 0},
-		{",,1", 2},
-		{",,1\n,1,1", 0},
-		{"1,,1\n,,1", 1},
-		{"1,,1\n1,,1", 1},
-	}
-
-	for i, tc := range testCasesIgnore {
-		t.Run("Test case without ignored "+strconv.Itoa(i), func(t *testing.T) {
-			reader := csv.NewReader(strings.NewReader(tc.inputCsv))
-			lastNonMissing := guessLastNMissingFromReader(reader, 1)
-			assert.Equal(t, tc.expected, lastNonMissing)
+		t.Run("Test case "+strconv.Itoa(i), func(t *testing.T) {
+			// the first column contains the identifier
+			reader := csv.NewReader(strings.NewReader("siret," + strings.ReplaceAll(tc.inputCsv, "\n", "\nsiret,")))
+			last, err := lastPeriodWithValue(reader, layout)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expected, last)
+			}
 		})
 	}
 }
@@ -0,0 +1,147 @@
+package createfilter
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+
+	"prepare-import/siret"
+)
+
+// PerimeterMode tells how the effectif of a company is evaluated, to decide whether it belongs to the perimeter.
+type PerimeterMode string
+
+const (
+	// PerEtablissement keeps a company if one of its establishments reached the effectif threshold.
+	PerEtablissement PerimeterMode = "etablissement"
+	// PerSiren keeps a company if the sum of the effectifs of its establishments reached the threshold.
+	PerSiren PerimeterMode = "siren"
+	// FromEffectifEnt keeps a company if its effectif, provided by the effectif_ent file, reached the threshold.
+	FromEffectifEnt PerimeterMode = "effectif_ent"
+)
+
+// DefaultPerimeterMode is the default way of evaluating the effectif of a company.
+const DefaultPerimeterMode = PerEtablissement
+
+// ParsePerimeterMode validates the name of a perimeter mode.
+func ParsePerimeterMode(mode string) (PerimeterMode, error) {
+	for _, perimeterMode := range []PerimeterMode{PerEtablissement, PerSiren, FromEffectifEnt} {
+		if mode == string(perimeterMode) {
+			return perimeterMode, nil
+		}
+	}
+	return "", errors.New("mode de périmètre inconnu : " + mode)
+}
+
+// getSummedPerimeter returns, for each target, the sirens of companies which summed effectif of establishments
+// reached its minEffectif, for at least one of the nbMois most recent periods. The reader must be positioned
+// after the header. Establishments rejected by the keepSiret of a target are ignored.
+func getSummedPerimeter(r *csv.Reader, layout EffectifLayout, nbMois int, rejectInvalidSirets bool, targets ...perimeterTarget) ([]map[string]struct{}, error) {
+	nbPeriods := len(layout.PeriodCols)
+	if nbPeriods > nbMois {
+		nbPeriods = nbMois
+	}
+	// effectif of each siren, for each of the nbMois most recent periods (-1 if unknown), for each target;
+	// the targets which consider every establishment share the same sums
+	sums := make([]map[string][]int, len(targets))
+	var allSums map[string][]int
+	for i, target := range targets {
+		if target.keepSiret != nil {
+			sums[i] = map[string][]int{}
+			continue
+		}
+		if allSums == nil {
+			allSums = map[string][]int{}
+		}
+		sums[i] = allSums
+	}
+	stats := identifierStats{kind: "siret", reject: rejectInvalidSirets}
+	for lineNumber := 1; ; lineNumber++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		siretNumber := layout.identifier(record)
+		if !stats.accept(siret.CheckSiret(siretNumber), siretNumber, lineNumber) {
+			continue
+		}
+		values := layout.values(record)
+		values = values[len(values)-nbPeriods:]
+		siren := siretNumber[0:9]
+		if allSums != nil {
+			addEffectifs(allSums, siren, values, record)
+		}
+		for i, target := range targets {
+			if target.keepSiret != nil && target.keepSiret(siretNumber) {
+				addEffectifs(sums[i], siren, values, record)
+			}
+		}
+	}
+	stats.print()
+	detectedSirens := make([]map[string]struct{}, len(targets))
+	for i, target := range targets {
+		detectedSirens[i] = map[string]struct{}{}
+		for siren, sum := range sums[i] {
+			for _, effectif := range sum {
+				if effectif >= target.minEffectif {
+					detectedSirens[i][siren] = struct{}{}
+					break
+				}
+			}
+		}
+	}
+	return detectedSirens, nil
+}
+
+// addEffectifs adds the effectif values of an establishment to the sums of its siren.
+func addEffectifs(sums map[string][]int, siren string, values []string, record []string) {
+	sum, exists := sums[siren]
+	if !exists {
+		sum = make([]int, len(values))
+		for i := range sum {
+			sum[i] = -1
+		}
+		sums[siren] = sum
+	}
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		if sum[i] < 0 {
+			sum[i] = 0
+		}
+		sum[i] += parseEffectif(value, record)
+	}
+}
+
+// getEffectifEntPerimeter returns, for each target, the sirens of companies which effectif, provided by an
+// effectif_ent file, reached its minEffectif for at least one of the nbMois most recent periods. The reader must
+// be positioned after the header. The keepSiret of the targets are ignored, as establishments are not listed.
+func getEffectifEntPerimeter(r *csv.Reader, layout EffectifLayout, nbMois int, rejectInvalidSirens bool, targets ...perimeterTarget) ([]map[string]struct{}, error) {
+	detectedSirens := make([]map[string]struct{}, len(targets))
+	for i := range detectedSirens {
+		detectedSirens[i] = map[string]struct{}{}
+	}
+	stats := identifierStats{kind: "siren", reject: rejectInvalidSirens}
+	for lineNumber := 1; ; lineNumber++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		siren := layout.identifier(record)
+		if !stats.accept(siret.CheckSiren(siren), siren, lineNumber) {
+			continue
+		}
+		for i, target := range targets {
+			if isInsidePerimeter(layout.values(record), nbMois, target.minEffectif) {
+				detectedSirens[i][siren] = struct{}{}
+			}
+		}
+	}
+	stats.print()
+	return detectedSirens, nil
+}
@@ -0,0 +1,78 @@
+package createfilter
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummedPerimeter(t *testing.T) {
+	csvLines := []string{
+		"compte;siret;rais_soc;ape_ins;dep;eff201011;eff201012;base;UR_EMET",
+		"1;11111111100001;ENTREPRISE;1234Z;75;4;4;116;075077", // 3 établissements de 4 salariés : ✅ 12 ≥ 10
+		"2;11111111100002;ENTREPRISE;1234Z;75;4;4;116;075077",
+		"3;11111111100003;ENTREPRISE;1234Z;75;4;;116;075077",
+		"4;22222222200001;ENTREPRISE;1234Z;75;5;;116;075077", // ❌ 9 < 10, les périodes ne sont pas cumulées
+		"5;22222222200002;ENTREPRISE;1234Z;75;;4;116;075077",
+		"6;33333333300001;ENTREPRISE;1234Z;75;3;3;116;075077", // ❌ 3 < 10
+	}
+	reader, layout := readLayout(t, csvLines, "siret")
+	perimeters, err := getSummedPerimeter(reader, layout, DefaultNbMois, false, perimeterTarget{DefaultMinEffectif, nil})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []map[string]struct{}{{"111111111": {}}}, perimeters)
+	}
+
+	t.Run("evaluates several targets in a single read", func(t *testing.T) {
+		reader, layout := readLayout(t, csvLines, "siret")
+		keepSiret := func(siret string) bool { return siret != "11111111100003" }
+		perimeters, err := getSummedPerimeter(reader, layout, DefaultNbMois, false,
+			perimeterTarget{0, nil}, perimeterTarget{DefaultMinEffectif, nil}, perimeterTarget{DefaultMinEffectif, keepSiret})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []map[string]struct{}{
+				{"111111111": {}, "222222222": {}, "333333333": {}},
+				{"111111111": {}},
+				{}, // 8 < 10 without the establishment 11111111100003
+			}, perimeters)
+		}
+	})
+}
+
+func TestEffectifEntPerimeter(t *testing.T) {
+	csvLines := []string{
+		"siren;rais_soc;eff201011;eff201012;eff201013",
+		"111111111;ENTREPRISE;12;8;8", // ✅ 12 ≥ 10
+		"222222222;ENTREPRISE;4;;9",   // ❌ 9 < 10
+		"333333333;ENTREPRISE;;10;",   // ✅ 10 ≥ 10
+	}
+	reader, layout := readLayout(t, csvLines, "siren")
+	perimeters, err := getEffectifEntPerimeter(reader, layout, DefaultNbMois, false, perimeterTarget{DefaultMinEffectif, nil})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []map[string]struct{}{{"111111111": {}, "333333333": {}}}, perimeters)
+	}
+	reader, layout = readLayout(t, csvLines, "siren")
+	perimeters, _ = getEffectifEntPerimeter(reader, layout, 2, false, perimeterTarget{DefaultMinEffectif, nil})
+	assert.Equal(t, []map[string]struct{}{{"333333333": {}}}, perimeters)
+}
+
+func TestParsePerimeterMode(t *testing.T) {
+	mode, err := ParsePerimeterMode("effectif_ent")
+	if assert.NoError(t, err) {
+		assert.Equal(t, FromEffectifEnt, mode)
+	}
+	_, err = ParsePerimeterMode("entreprise")
+	assert.EqualError(t, err, "mode de périmètre inconnu : entreprise")
+}
+
+// readLayout returns a reader positioned after the header of csvLines, and the layout of this header.
+func readLayout(t *testing.T, csvLines []string, identifierColName string) (*csv.Reader, EffectifLayout) {
+	reader := csv.NewReader(strings.NewReader(strings.Join(csvLines, "\n")))
+	reader.Comma = ';'
+	header, _ := reader.Read()
+	layout, err := DetectEffectifLayout(header, identifierColName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader, layout
+}
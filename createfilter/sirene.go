@@ -0,0 +1,274 @@
+package createfilter
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signaux-faibles/goSirene"
+)
+
+// names of the rules which exclude companies (or establishments) from the perimeter
+const (
+	RuleCategorieJuridique = "categorie_juridique"
+	RuleActivite           = "activite"
+	RuleCessee             = "unite_legale_cessee"
+	RuleCreeeApresDateFin  = "creee_apres_date_fin"
+	RuleEtablissementFerme = "etablissement_ferme"
+)
+
+// SireneRules toggles the rules which exclude companies from the perimeter, using Sirene data.
+// The categorie juridique and main activity rules are applied whenever a sireneUL file is provided.
+type SireneRules struct {
+	// UniteLegaleFile is the sireneUL file which unités légales are excluded by the rules, if provided.
+	// It may have a "gzip:" prefix.
+	UniteLegaleFile     string
+	ExcludeCessees      bool      // exclude unités légales which etatAdministratifUniteLegale is "C" (cessée)
+	ExcludeCreatedAfter time.Time // if not zero, exclude unités légales created after this date (e.g. date_fin)
+	// CacheDir is the directory in which the exclusions of the sireneUL file are cached, if provided.
+	// The cache is reused as long as the content of the file and the rules don't change.
+	CacheDir string
+	// EtablissementFile is the StockEtablissement ("sirene") file which closed establishments are
+	// ignored when evaluating the perimeter, if provided. It may have a "gzip:" prefix.
+	EtablissementFile string
+}
+
+// Enabled lists the names of the rules that are applied, given the provided files.
+func (rules SireneRules) Enabled() []string {
+	enabled := []string{}
+	if rules.UniteLegaleFile != "" {
+		enabled = append(enabled, RuleCategorieJuridique, RuleActivite)
+		if rules.ExcludeCessees {
+			enabled = append(enabled, RuleCessee)
+		}
+		if !rules.ExcludeCreatedAfter.IsZero() {
+			enabled = append(enabled, RuleCreeeApresDateFin)
+		}
+	}
+	if rules.EtablissementFile != "" {
+		enabled = append(enabled, RuleEtablissementFerme)
+	}
+	return enabled
+}
+
+// excludingRule returns the name of the first rule which excludes an unité légale, or "" if it is kept.
+func (rules SireneRules) excludingRule(s goSirene.SireneUL) string {
+	switch {
+	case isExcludedCategorieJuridique(s.CategorieJuridiqueUniteLegale):
+		return RuleCategorieJuridique
+	case isExcludedActivity(s.ActivitePrincipaleUniteLegale):
+		return RuleActivite
+	case rules.ExcludeCessees && s.EtatAdministratifUniteLegale == "C":
+		return RuleCessee
+	case !rules.ExcludeCreatedAfter.IsZero() && s.DateCreationUniteLegale.After(rules.ExcludeCreatedAfter):
+		return RuleCreeeApresDateFin
+	}
+	return ""
+}
+
+// ExclusionReport counts, for each rule, the companies excluded from the perimeter,
+// or the establishments ignored for RuleEtablissementFerme.
+type ExclusionReport map[string]int
+
+// NewExclusionReport returns a report which lists the rules applied to the perimeter, without any exclusion yet.
+func NewExclusionReport(rules SireneRules) ExclusionReport {
+	report := ExclusionReport{}
+	for _, rule := range rules.Enabled() {
+		report[rule] = 0
+	}
+	return report
+}
+
+// Print prints the number of exclusions of each rule.
+func (report ExclusionReport) Print() {
+	rules := make([]string, 0, len(report))
+	for rule := range report {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		println(fmt.Sprintf("Info: %d exclusions by rule %q", report[rule], rule))
+	}
+}
+
+// NewSireneFilters returns the filters which apply the enabled rules: keepSiret ignores the closed establishments
+// (nil if no StockEtablissement file is provided), and filters exclude companies according to the sireneUL file.
+// Exclusions are counted in report, if not nil.
+func NewSireneFilters(rules SireneRules, report ExclusionReport) (keepSiret SiretFilter, filters []filter, err error) {
+	if rules.EtablissementFile != "" {
+		if keepSiret, err = ClosedEtablissementsFilter(rules.EtablissementFile, report); err != nil {
+			return nil, nil, err
+		}
+	}
+	if rules.UniteLegaleFile != "" {
+		sireneULFilter, err := SireneULFilter(rules, report)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, sireneULFilter)
+	}
+	return keepSiret, filters, nil
+}
+
+// SireneULFilter excludes the companies of the sireneUL file that match the categorie juridique and
+// activity rules, and the optional rules enabled in rules. Exclusions are counted in report, if not nil.
+func SireneULFilter(rules SireneRules, report ExclusionReport) (filter, error) {
+	excludedSirens, err := readExcludedSirensCached(rules.UniteLegaleFile, rules)
+	if err != nil {
+		return nil, err
+	}
+	return func(siren string) bool {
+		rule, excluded := excludedSirens[siren]
+		if excluded && report != nil {
+			report[rule]++
+		}
+		return !excluded
+	}, nil
+}
+
+// SiretFilter tells whether an establishment must be considered when evaluating the perimeter.
+type SiretFilter func(siret string) bool
+
+// ClosedEtablissementsFilter ignores the establishments which are closed (etatAdministratifEtablissement "F")
+// according to a StockEtablissement file. The file may have a "gzip:" prefix.
+// Ignored establishments are counted in report, if not nil.
+func ClosedEtablissementsFilter(path string, report ExclusionReport) (SiretFilter, error) {
+	closedSirets, err := readClosedSirets(path)
+	if err != nil {
+		return nil, err
+	}
+	return func(siret string) bool {
+		closed := closedSirets.contains(siret)
+		if closed && report != nil {
+			report[RuleEtablissementFerme]++
+		}
+		return !closed
+	}, nil
+}
+
+// siretSet is a sorted set of sirets, stored as numbers: the national StockEtablissement
+// file lists tens of millions of closed establishments, which a map of strings would hardly hold.
+type siretSet []uint64
+
+func (set siretSet) contains(siret string) bool {
+	n, ok := siretNumber(siret)
+	if !ok {
+		return false
+	}
+	i := sort.Search(len(set), func(i int) bool { return set[i] >= n })
+	return i < len(set) && set[i] == n
+}
+
+// siretNumber converts a siret of 14 digits to a number, or returns false if it is malformed.
+func siretNumber(siret string) (uint64, bool) {
+	if len(siret) != 14 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(siret, 10, 64)
+	return n, err == nil
+}
+
+func readClosedSirets(path string) (siretSet, error) {
+	closedSirets := siretSet{}
+	err := readSireneColumns(path, []string{"siret", "etatAdministratifEtablissement"}, func(values []string) {
+		if n, ok := siretNumber(values[0]); ok && values[1] == "F" {
+			closedSirets = append(closedSirets, n)
+		}
+	})
+	sort.Slice(closedSirets, func(i, j int) bool { return closedSirets[i] < closedSirets[j] })
+	return closedSirets, err
+}
+
+// readSireneColumns calls handle with the values of the given columns, located by their name, for each row
+// of a Sirene file (sireneUL or StockEtablissement). The file may be a zip archive, or have a "gzip:" prefix:
+// it is then decompressed on the fly, while it is read.
+func readSireneColumns(path string, columns []string, handle func(values []string)) error {
+	file, err := openSireneFile(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := csv.NewReader(bufio.NewReader(file))
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		if indexes[i] = indexOf(header, column); indexes[i] < 0 {
+			return fmt.Errorf("%s: en-tête non reconnu : colonne %q introuvable", path, column)
+		}
+	}
+	values := make([]string, len(columns))
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for i, index := range indexes {
+			values[i] = record[index]
+		}
+		handle(values)
+	}
+}
+
+// openSireneFile opens a Sirene file for reading, and decompresses it on the fly if it is a zip archive
+// (of a single csv file) or if its path has a "gzip:" prefix.
+func openSireneFile(path string) (io.ReadCloser, error) {
+	if strings.HasSuffix(path, ".zip") {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(archive.File) != 1 {
+			archive.Close()
+			return nil, fmt.Errorf("%s: the archive should contain one file, found %d", path, len(archive.File))
+		}
+		entry, err := archive.File[0].Open()
+		if err != nil {
+			archive.Close()
+			return nil, err
+		}
+		return readCloser{entry, archive}, nil
+	}
+	file, err := os.Open(strings.TrimPrefix(path, "gzip:"))
+	if err != nil || !strings.HasPrefix(path, "gzip:") {
+		return file, err
+	}
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return readCloser{zr, file}, nil
+}
+
+// readCloser reads from a decompressed stream, and closes the underlying file.
+type readCloser struct {
+	io.Reader
+	file io.Closer
+}
+
+func (r readCloser) Close() error {
+	return r.file.Close()
+}
+
+func indexOf(header []string, column string) int {
+	for i, name := range header {
+		if strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) == column {
+			return i
+		}
+	}
+	return -1
+}
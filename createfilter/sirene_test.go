@@ -0,0 +1,190 @@
+package createfilter
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signaux-faibles/goSirene"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeSireneULFile writes a sireneUL file, from the rows of test_uniteLegale.csv which siren are provided,
+// with the given etatAdministratifUniteLegale and dateCreationUniteLegale.
+func makeSireneULFile(t *testing.T, unitesLegales map[string][2]string) string {
+	t.Helper()
+	data, err := os.ReadFile("./test_uniteLegale.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	output := []string{lines[0]}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, ",")
+		if values, ok := unitesLegales[fields[0]]; ok {
+			fields[20], fields[3] = values[0], values[1]
+			output = append(output, strings.Join(fields, ","))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "sireneUL.csv")
+	if err := os.WriteFile(path, []byte(strings.Join(output, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// makeEtablissementFile writes a StockEtablissement file, with the etatAdministratifEtablissement of each siret.
+func makeEtablissementFile(t *testing.T, etatPerSiret map[string]string, compressed bool) string {
+	t.Helper()
+	lines := []string{strings.Join(goSirene.GeoSireneHeaders, ",")}
+	for siret, etat := range etatPerSiret {
+		row := make([]string, len(goSirene.GeoSireneHeaders))
+		row[goSirene.GeoSireneMap["siren"]] = siret[0:9]
+		row[goSirene.GeoSireneMap["siret"]] = siret
+		row[goSirene.GeoSireneMap["etatAdministratifEtablissement"]] = etat
+		lines = append(lines, strings.Join(row, ","))
+	}
+	data := []byte(strings.Join(lines, "\n") + "\n")
+	path := filepath.Join(t.TempDir(), "StockEtablissement_utf8_geo.csv")
+	if compressed {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		data = buf.Bytes()
+		path += ".gz"
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if compressed {
+		return "gzip:" + path
+	}
+	return path
+}
+
+func makeSireneULFilter(t *testing.T, rules SireneRules, report ExclusionReport) filter {
+	t.Helper()
+	sireneULFilter, err := SireneULFilter(rules, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sireneULFilter
+}
+
+func TestSireneULFilter(t *testing.T) {
+	sireneULPath := makeSireneULFile(t, map[string][2]string{
+		"111111111": {"A", "2000-01-01"},
+		"222222222": {"A", "2000-01-01"}, // excluded by its categorie juridique
+		"444444444": {"C", "2018-03-01"},
+		"666666666": {"A", "2018-03-01"}, // excluded by its activity, before its date of creation
+	})
+	perimeter := map[string]struct{}{"111111111": {}, "222222222": {}, "444444444": {}, "666666666": {}, "999999999": {}}
+
+	t.Run("only excludes by categorie juridique and activity, by default", func(t *testing.T) {
+		rules := SireneRules{UniteLegaleFile: sireneULPath}
+		report := NewExclusionReport(rules)
+		actual := applyFilter(perimeter, makeSireneULFilter(t, rules, report))
+		assert.Equal(t, map[string]struct{}{"111111111": {}, "444444444": {}, "999999999": {}}, actual)
+		assert.Equal(t, ExclusionReport{RuleCategorieJuridique: 1, RuleActivite: 1}, report)
+	})
+
+	t.Run("excludes unités légales cessées", func(t *testing.T) {
+		rules := SireneRules{UniteLegaleFile: sireneULPath, ExcludeCessees: true}
+		report := NewExclusionReport(rules)
+		actual := applyFilter(perimeter, makeSireneULFilter(t, rules, report))
+		assert.Equal(t, map[string]struct{}{"111111111": {}, "999999999": {}}, actual)
+		assert.Equal(t, ExclusionReport{RuleCategorieJuridique: 1, RuleActivite: 1, RuleCessee: 1}, report)
+	})
+
+	t.Run("excludes unités légales created after a date", func(t *testing.T) {
+		rules := SireneRules{UniteLegaleFile: sireneULPath, ExcludeCreatedAfter: time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)}
+		report := NewExclusionReport(rules)
+		actual := applyFilter(perimeter, makeSireneULFilter(t, rules, report))
+		assert.Equal(t, map[string]struct{}{"111111111": {}, "999999999": {}}, actual)
+		assert.Equal(t, ExclusionReport{RuleCategorieJuridique: 1, RuleActivite: 1, RuleCreeeApresDateFin: 1}, report)
+	})
+
+	t.Run("reads gzipped sireneUL files", func(t *testing.T) {
+		data, _ := os.ReadFile(sireneULPath)
+		gzippedPath := filepath.Join(t.TempDir(), "sireneUL.csv.gz")
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		if err := os.WriteFile(gzippedPath, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		actual := applyFilter(perimeter, makeSireneULFilter(t, SireneRules{UniteLegaleFile: "gzip:" + gzippedPath}, nil))
+		assert.Equal(t, map[string]struct{}{"111111111": {}, "444444444": {}, "999999999": {}}, actual)
+	})
+
+	t.Run("reads zipped sireneUL files", func(t *testing.T) {
+		data, _ := os.ReadFile(sireneULPath)
+		zippedPath := filepath.Join(t.TempDir(), "StockUniteLegale_utf8.zip")
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		entry, _ := zw.Create("StockUniteLegale_utf8.csv")
+		_, _ = entry.Write(data)
+		_ = zw.Close()
+		if err := os.WriteFile(zippedPath, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		actual := applyFilter(perimeter, makeSireneULFilter(t, SireneRules{UniteLegaleFile: zippedPath}, nil))
+		assert.Equal(t, map[string]struct{}{"111111111": {}, "444444444": {}, "999999999": {}}, actual)
+	})
+
+	t.Run("fails if a column is missing", func(t *testing.T) {
+		path := writeTempFile(t, "siren,categorieJuridiqueUniteLegale\n111111111,1000\n")
+		_, err := SireneULFilter(SireneRules{UniteLegaleFile: path}, nil)
+		assert.ErrorContains(t, err, `colonne "activitePrincipaleUniteLegale" introuvable`)
+	})
+
+	t.Run("fails if the file can't be read", func(t *testing.T) {
+		_, err := SireneULFilter(SireneRules{UniteLegaleFile: filepath.Join(t.TempDir(), "sireneUL.csv")}, nil)
+		assert.Error(t, err)
+		_, err = SireneULFilter(SireneRules{UniteLegaleFile: sireneULPath + ".txt"}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestClosedEtablissementsFilter(t *testing.T) {
+	etatPerSiret := map[string]string{"11111111100015": "A", "11111111100023": "F", "00000000100015": "F"}
+	for _, compressed := range []bool{false, true} {
+		path := makeEtablissementFile(t, etatPerSiret, compressed)
+		report := ExclusionReport{}
+		keepSiret, err := ClosedEtablissementsFilter(path, report)
+		if assert.NoError(t, err, path) {
+			assert.True(t, keepSiret("11111111100015"))
+			assert.False(t, keepSiret("11111111100023"))
+			assert.True(t, keepSiret("22222222200017")) // unknown establishments are kept
+			assert.True(t, keepSiret("1111111110002"))  // malformed sirets are kept
+			assert.True(t, keepSiret("00000000200015"))
+			assert.False(t, keepSiret("00000000100015"))
+			assert.Equal(t, ExclusionReport{RuleEtablissementFerme: 2}, report)
+		}
+	}
+
+	t.Run("closed establishments are ignored when evaluating the perimeter", func(t *testing.T) {
+		keepSiret, err := ClosedEtablissementsFilter(makeEtablissementFile(t, etatPerSiret, false), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var output bytes.Buffer
+		effectifFile := writeTempFile(t, "siret;eff201011\n11111111100015;4\n11111111100023;40\n22222222200017;12\n")
+		err = CreateFilter(&output, effectifFile, DefaultNbMois, DefaultMinEffectif, PerEtablissement, false, keepSiret, nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "siren\n222222222\n", output.String())
+		}
+	})
+
+	t.Run("fails if the file does not exist", func(t *testing.T) {
+		_, err := ClosedEtablissementsFilter(filepath.Join(t.TempDir(), "missing.csv"), nil)
+		assert.Error(t, err)
+	})
+}
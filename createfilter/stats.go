@@ -0,0 +1,232 @@
+package createfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultStatsMaxRows is the default number of départements and APE codes listed in the Markdown summary.
+const DefaultStatsMaxRows = 20
+
+// effectif classes, by lower bound
+var effectifClasses = []struct {
+	name string
+	min  int
+}{
+	{"250+", 250},
+	{"50-249", 50},
+	{"20-49", 20},
+	{"10-19", 10},
+	{"1-9", 1},
+	{"0", 0},
+}
+
+// unknownEffectifClass is the class of establishments which effectif is never provided.
+const unknownEffectifClass = "inconnu"
+
+// PeriodStats reports the ratio of establishments which effectif is missing, for a period column.
+type PeriodStats struct {
+	Column       string  `json:"column"`
+	MissingRatio float64 `json:"missing_ratio"`
+}
+
+// EffectifStats describes the content of an effectif file, for the review of a monthly import.
+type EffectifStats struct {
+	Etablissements int `json:"etablissements"`
+	Entreprises    int `json:"entreprises"`
+	// EffectifClasses counts the establishments by class of their most recent effectif.
+	EffectifClasses map[string]int `json:"effectif_classes"`
+	Periods         []PeriodStats  `json:"periods"`
+	Departements    map[string]int `json:"departements,omitempty"`
+	Ape             map[string]int `json:"ape,omitempty"`
+	// TrailingEmptyColumns lists the most recent period columns that never have a value.
+	TrailingEmptyColumns []string `json:"trailing_empty_columns"`
+}
+
+// ComputeEffectifStats reads an effectif file, and computes its statistics.
+// Non-numeric effectif values are counted as missing.
+// If the file has a "gzip:" prefix, it will be decompressed on the fly.
+func ComputeEffectifStats(effectifFileName string) (EffectifStats, error) {
+	r, f, err := makeEffectifReaderFromFile(effectifFileName)
+	if err != nil {
+		return EffectifStats{}, err
+	}
+	defer f.Close()
+	header, err := r.Read() // en tête
+	if err != nil {
+		return EffectifStats{}, err
+	}
+	layout, err := DetectEffectifLayout(header, "siret")
+	if err != nil {
+		return EffectifStats{}, fmt.Errorf("%s: %w", effectifFileName, err)
+	}
+	depCol, apeCol := findColumn(header, "dep"), findColumn(header, "ape_ins")
+
+	stats := EffectifStats{EffectifClasses: map[string]int{}, TrailingEmptyColumns: []string{}}
+	if depCol >= 0 {
+		stats.Departements = map[string]int{}
+	}
+	if apeCol >= 0 {
+		stats.Ape = map[string]int{}
+	}
+	sirens := map[string]struct{}{}
+	missing := make([]int, len(layout.PeriodCols))
+	lastPeriodWithValue := -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, err
+		}
+		stats.Etablissements++
+		if siretNumber := layout.identifier(record); len(siretNumber) >= 9 {
+			sirens[siretNumber[0:9]] = struct{}{}
+		}
+		if depCol >= 0 && depCol < len(record) {
+			stats.Departements[record[depCol]]++
+		}
+		if apeCol >= 0 && apeCol < len(record) {
+			stats.Ape[record[apeCol]]++
+		}
+		class := unknownEffectifClass
+		for i, value := range layout.values(record) {
+			effectif, err := strconv.Atoi(nonDigits.ReplaceAllString(value, ""))
+			if err != nil { // e.g. an empty or "NC" value
+				missing[i]++
+				continue
+			}
+			class = effectifClass(effectif)
+			if i > lastPeriodWithValue {
+				lastPeriodWithValue = i
+			}
+		}
+		stats.EffectifClasses[class]++
+	}
+	stats.Entreprises = len(sirens)
+	for i, col := range layout.PeriodCols {
+		periodStats := PeriodStats{Column: header[col]}
+		if stats.Etablissements > 0 {
+			periodStats.MissingRatio = float64(missing[i]) / float64(stats.Etablissements)
+		}
+		stats.Periods = append(stats.Periods, periodStats)
+		if i > lastPeriodWithValue {
+			stats.TrailingEmptyColumns = append(stats.TrailingEmptyColumns, header[col])
+		}
+	}
+	return stats, nil
+}
+
+func effectifClass(effectif int) string {
+	for _, class := range effectifClasses {
+		if effectif >= class.min {
+			return class.name
+		}
+	}
+	return unknownEffectifClass
+}
+
+func findColumn(header []string, colName string) int {
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), colName) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SaveEffectifStats computes the statistics of an effectif file, and writes them as JSON into jsonFile,
+// and as a Markdown summary into a file with the same name and a ".md" extension.
+func SaveEffectifStats(effectifFileName string, jsonFile string) error {
+	stats, err := ComputeEffectifStats(effectifFileName)
+	if err != nil {
+		return err
+	}
+	markdownFile := strings.TrimSuffix(jsonFile, filepath.Ext(jsonFile)) + ".md"
+	for filePath, write := range map[string]func(io.Writer) error{
+		jsonFile:     stats.WriteJSON,
+		markdownFile: func(w io.Writer) error { return stats.WriteMarkdown(w, DefaultStatsMaxRows) },
+	} {
+		file, err := os.Create(filePath)
+		if err != nil {
+			return err
+		}
+		if err := write(file); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the statistics as JSON.
+func (stats EffectifStats) WriteJSON(writer io.Writer) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(data, '\n'))
+	return err
+}
+
+// WriteMarkdown writes a summary of the statistics, for the review of the import.
+// Only the maxRows most frequent départements and APE codes are listed.
+func (stats EffectifStats) WriteMarkdown(writer io.Writer, maxRows int) error {
+	var b strings.Builder
+	b.WriteString("# Statistiques du fichier effectif\n\n")
+	fmt.Fprintf(&b, "- Établissements : %d\n", stats.Etablissements)
+	fmt.Fprintf(&b, "- Entreprises : %d\n", stats.Entreprises)
+	if len(stats.TrailingEmptyColumns) > 0 {
+		fmt.Fprintf(&b, "- Colonnes de période vides en fin de fichier : %s\n", strings.Join(stats.TrailingEmptyColumns, ", "))
+	} else {
+		b.WriteString("- Colonnes de période vides en fin de fichier : aucune\n")
+	}
+
+	b.WriteString("\n## Classes d'effectif (dernier effectif connu)\n\n| Classe | Établissements |\n| --- | --- |\n")
+	for _, class := range effectifClasses {
+		fmt.Fprintf(&b, "| %s | %d |\n", class.name, stats.EffectifClasses[class.name])
+	}
+	fmt.Fprintf(&b, "| %s | %d |\n", unknownEffectifClass, stats.EffectifClasses[unknownEffectifClass])
+
+	b.WriteString("\n## Valeurs manquantes par période\n\n| Période | Manquantes |\n| --- | --- |\n")
+	for _, period := range stats.Periods {
+		fmt.Fprintf(&b, "| %s | %.1f %% |\n", period.Column, 100*period.MissingRatio)
+	}
+
+	writeTopCounts(&b, "Départements", "Département", stats.Departements, maxRows)
+	writeTopCounts(&b, "Codes APE", "APE", stats.Ape, maxRows)
+	_, err := io.WriteString(writer, b.String())
+	return err
+}
+
+func writeTopCounts(b *strings.Builder, title string, column string, counts map[string]int, maxRows int) {
+	if counts == nil {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if maxRows > 0 && len(keys) > maxRows {
+		keys = keys[:maxRows]
+	}
+	fmt.Fprintf(b, "\n## %s\n\n| %s | Établissements |\n| --- | --- |\n", title, column)
+	for _, key := range keys {
+		fmt.Fprintf(b, "| %s | %d |\n", key, counts[key])
+	}
+}
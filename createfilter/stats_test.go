@@ -0,0 +1,63 @@
+package createfilter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeEffectifStats(t *testing.T) {
+	path := writeTempFile(t, "compte;siret;rais_soc;ape_ins;dep;eff201011;eff201012;eff201013;base\n"+
+		"1;11111111100001;ENTREPRISE;1234Z;75;4;12;;116\n"+
+		"2;11111111100002;ENTREPRISE;1234Z;75;300;;;116\n"+
+		"3;22222222200001;ENTREPRISE;5678Z;92;;;;116\n"+
+		"4;33333333300001;ENTREPRISE;1234Z;53;0;0;;116\n")
+
+	stats, err := ComputeEffectifStats(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, EffectifStats{
+			Etablissements:  4,
+			Entreprises:     3,
+			EffectifClasses: map[string]int{"10-19": 1, "250+": 1, "inconnu": 1, "0": 1},
+			Periods: []PeriodStats{
+				{"eff201011", 0.25},
+				{"eff201012", 0.5},
+				{"eff201013", 1},
+			},
+			Departements:         map[string]int{"75": 2, "92": 1, "53": 1},
+			Ape:                  map[string]int{"1234Z": 3, "5678Z": 1},
+			TrailingEmptyColumns: []string{"eff201013"},
+		}, stats)
+	}
+
+	var markdown bytes.Buffer
+	if assert.NoError(t, stats.WriteMarkdown(&markdown, 1)) {
+		assert.Contains(t, markdown.String(), "- Colonnes de période vides en fin de fichier : eff201013\n")
+		assert.Contains(t, markdown.String(), "| eff201012 | 50.0 % |\n")
+		assert.Contains(t, markdown.String(), "| Département | Établissements |\n| --- | --- |\n| 75 | 2 |\n\n")
+	}
+}
+
+func TestComputeEffectifStatsNonNumeric(t *testing.T) {
+	path := writeTempFile(t, "compte;siret;rais_soc;ape_ins;dep;eff201011;eff201012;base\n"+
+		"1;11111111100001;ENTREPRISE;1234Z;75;NC;12;116\n"+
+		"2;22222222200001;ENTREPRISE;5678Z;92;NC;NC;116\n")
+
+	stats, err := ComputeEffectifStats(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]int{"10-19": 1, "inconnu": 1}, stats.EffectifClasses)
+		assert.Equal(t, []PeriodStats{{"eff201011", 1}, {"eff201012", 0.5}}, stats.Periods)
+	}
+}
+
+func TestSaveEffectifStats(t *testing.T) {
+	jsonFile := filepath.Join(t.TempDir(), "effectif_stats.json")
+	if assert.NoError(t, SaveEffectifStats("test_data.csv", jsonFile)) {
+		assert.FileExists(t, jsonFile)
+		markdown, _ := os.ReadFile(filepath.Join(filepath.Dir(jsonFile), "effectif_stats.md"))
+		assert.Contains(t, string(markdown), "# Statistiques du fichier effectif")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"prepare-import/createfilter"
+	"prepare-import/prepareimport"
+)
+
+// Implementation of the "filter-evolution" sub-command: prepare-import filter-evolution -path /data -batch 1802
+func filterEvolution(args []string) {
+	flags := flag.NewFlagSet("filter-evolution", flag.ExitOnError)
+	var path = flags.String("path", ".", "Chemin d'accès au répertoire des batches")
+	var batchKey = flags.String("batch", "", "Clé du batch dont le filtre est comparé à celui du batch précédent, au format AAMM")
+	var previousKey = flags.String("previous", "", "Clé du batch précédent (par défaut: le dernier batch trouvé avant -batch dans le répertoire des batches)")
+	var output = flags.String("output", "", "Chemin du fichier CSV où sont écrites les entrées et sorties du périmètre (par défaut: sortie standard)")
+	var perimeterMode = flags.String("perimeter-mode", string(createfilter.DefaultPerimeterMode), "Évaluation de l'effectif des entreprises, comme pour la génération du filtre")
+	var rejectInvalidIdentifiers = flags.Bool("reject-invalid-identifiers", false, "Exclut du périmètre les siret dont la clé est invalide, comme pour la génération du filtre")
+	var sireneULCache = flags.String("sireneUL-cache", "", sireneULCacheUsage)
+	var excludeCessees = flags.Bool("exclude-cessees", false, "Exclut du périmètre les unités légales cessées, d'après le fichier sireneUL")
+	var excludeCreatedAfterDateFin = flags.Bool("exclude-created-after-date-fin", false, "Exclut du périmètre les unités légales créées après la date de fin de chaque batch, d'après le fichier sireneUL")
+	var ignoreClosedEtablissements = flags.Bool("ignore-closed-etablissements", false, "Ignore les établissements fermés du fichier sirene (StockEtablissement) lors de l'évaluation du périmètre")
+	_ = flags.Parse(args)
+
+	current, err := prepareimport.NewBatchKey(*batchKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	previous, found := prepareimport.FindPreviousBatch(*path, current)
+	if *previousKey != "" {
+		if previous, err = prepareimport.NewBatchKey(*previousKey); err != nil {
+			log.Fatal(err)
+		}
+	} else if !found {
+		log.Fatal("aucun batch précédent n'a été trouvé dans " + *path)
+	}
+	mode, err := createfilter.ParsePerimeterMode(*perimeterMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := []prepareimport.Option{
+		prepareimport.WithPerimeterMode(mode),
+		prepareimport.WithSireneRules(prepareimport.SireneRuleOptions{
+			ExcludeCessees:             *excludeCessees,
+			ExcludeCreatedAfterDateFin: *excludeCreatedAfterDateFin,
+			IgnoreClosedEtablissements: *ignoreClosedEtablissements,
+		}),
+	}
+	if *rejectInvalidIdentifiers {
+		opts = append(opts, prepareimport.WithIdentifierValidation(true))
+	}
+	if *sireneULCache != "" {
+		opts = append(opts, prepareimport.WithSireneULCache(*sireneULCache))
+	}
+
+	changes, err := prepareimport.ExplainFilterEvolution(*path, previous, current, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	changes.Print()
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		writer = file
+	}
+	if err := changes.WriteCSV(writer); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,22 +1,50 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"prepare-import/createfilter"
 	"prepare-import/prepareimport"
 )
 
+// help of the -sireneUL-cache option of the command and its sub-commands
+const sireneULCacheUsage = "Répertoire où sont conservées les exclusions calculées à partir du fichier sireneUL, pour les réutiliser lors des exécutions suivantes (désactivé par défaut)\n" +
+	"Seules les exclusions du dernier fichier sireneUL sont conservées pour un même ensemble de règles"
+
 // Implementation of the prepare-import command.
+// The "serve" sub-command exposes the same features through an HTTP API,
+// the "watch" sub-command prepares batches as soon as their deliveries are complete,
+// and the "filter-evolution" sub-command explains the changes of the filter since the previous batch.
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "watch":
+			watch(os.Args[2:])
+			return
+		case "filter-evolution":
+			filterEvolution(os.Args[2:])
+			return
+		}
+	}
 	var path = flag.String("path", ".", "Chemin d'accès au répertoire des batches")
 	var batchKey = flag.String(
 		"batch",
 		"",
 		"Clé du batch à importer au format AAMM (année + mois + suffixe optionnel)\n"+
-			"Exemple: 1802_1",
+			"Exemple: 1802_01",
 	)
 	var dateFinEffectif = flag.String(
 		"date-fin-effectif",
@@ -24,24 +52,124 @@ func main() {
 		"Date de fin des données \"effectif\" fournies, au format AAAA-MM-JJ (année + mois + jour)\n"+
 			"Exemple: 2014-01-01",
 	)
+	var strictDateFinEffectif = flag.Bool(
+		"strict-date-fin-effectif",
+		false,
+		"Échoue si les différentes sources de date_fin_effectif (paramètre, fichiers effectif, batch précédent) sont incohérentes",
+	)
+	var coverageInParam = flag.Bool("coverage-in-param", false, "Ajoute à la propriété \"param\" la période couverte par chaque fichier de séries temporelles")
+	var coverageReport = flag.String("coverageReport", "", "Chemin du fichier JSON où est écrite la période couverte par chaque fichier de séries temporelles\n"+
+		"Exemple: ./coverage.json")
+	var effectifStats = flag.String("effectif-stats", "", "Chemin du fichier JSON où sont écrites les statistiques du fichier effectif, accompagné d'un résumé au format Markdown (.md)\n"+
+		"Exemple: ./effectif_stats.json")
+	var comparePrevious = flag.Bool("compare-previous", false, "Compare le batch avec le batch précédent, et signale les régressions (types manquants, fichiers ou filtre plus petits)")
+	var previousAdmin = flag.String("previousAdmin", "", "Chemin de l'objet Admin du batch précédent (par défaut: recherché dans le répertoire des batches)")
+	var maxSizeDrop = flag.Float64("max-size-drop", prepareimport.DefaultPreviousBatchComparison.MaxSizeDrop, "Baisse maximale de la taille des fichiers d'un type par rapport au batch précédent (ex: 0.3 pour 30%)")
+	var maxFilterDrop = flag.Float64("max-filter-drop", prepareimport.DefaultPreviousBatchComparison.MaxFilterDrop, "Baisse maximale du nombre de sirens du filtre par rapport au batch précédent (ex: 0.1 pour 10%)")
+	var policyFile = flag.String("policy", "", "Chemin d'un fichier JSON listant les types de fichiers requis, optionnels et interdits\n"+
+		"Exemple: ./policy.json")
+	var allowIncomplete = flag.Bool("allow-incomplete", false, "Prépare le batch même si des types de fichiers requis par la politique sont manquants")
+	var validateIdentifiers = flag.Bool("validate-identifiers", false, "Compte les siren et siret invalides (format, clé de contrôle) dans les fichiers du batch")
+	var rejectInvalidIdentifiers = flag.Bool("reject-invalid-identifiers", false, "Échoue si des fichiers contiennent des siren ou siret invalides, et exclut du filtre les siret dont la clé est invalide")
+	var perimeterMode = flag.String("perimeter-mode", string(createfilter.DefaultPerimeterMode), "Évaluation de l'effectif des entreprises lors de la génération du filtre :\n"+
+		"\"etablissement\" (effectif de chaque établissement), \"siren\" (somme des effectifs des établissements) ou \"effectif_ent\" (fichier effectif_ent)")
+	var requireSireneUL = flag.Bool("require-sireneUL", false, "Échoue si le filtre doit être généré et qu'aucun fichier sireneUL n'est trouvé dans le batch (ou son batch parent)")
+	var sireneULCache = flag.String("sireneUL-cache", "", sireneULCacheUsage)
+	var excludeCessees = flag.Bool("exclude-cessees", false, "Exclut du filtre généré les unités légales cessées, d'après le fichier sireneUL")
+	var excludeCreatedAfterDateFin = flag.Bool("exclude-created-after-date-fin", false, "Exclut du filtre généré les unités légales créées après date_fin, d'après le fichier sireneUL")
+	var ignoreClosedEtablissements = flag.Bool("ignore-closed-etablissements", false, "Ignore les établissements fermés du fichier sirene (StockEtablissement) lors de la génération du filtre")
+	var canonicalNames = flag.Bool("canonical-names", false, "Référence les fichiers du batch par un nom canonique par type (ex: debit_1802.csv.gz), via des liens symboliques\n"+
+		"Les noms d'origine sont conservés dans le fichier "+prepareimport.ManifestFilename+" du batch")
+	var interactive = flag.Bool("interactive", false, "Propose, pour chaque fichier non supporté, de lui assigner un type ou de l'ignorer\n"+
+		"Les décisions sont enregistrées dans le fichier "+prepareimport.OverridesFilename+" du batch")
 	var configFile = flag.String("configFile", "./batch.toml", "Chemin du fichier où est écrit la configuration\n"+
 		"Exemple: ./batch.toml")
+	var paramsFile = flag.String("paramsFile", "", "Chemin d'un fichier JSON de paramètres du batch (date_debut, date_fin, nb_mois, param)\n"+
+		"Exemple: ./params.json")
+	var dateDebut = flag.String("date-debut", "", "Date de début des données, au format AAAA-MM-JJ (par défaut: 2016-01-01)")
+	var dateFin = flag.String("date-fin", "", "Date de fin des données, au format AAAA-MM-JJ (par défaut: premier jour du mois du batch)")
+	var nbMois = flag.Int("nb-mois", 0, "Si renseigné, la date de début est fixée à 'nb-mois' mois avant la date de fin")
+	var extraParams = extraParamsFlag{}
+	flag.Var(&extraParams, "param", "Paramètre supplémentaire à ajouter à la propriété \"param\", au format clé=valeur (répétable)\n"+
+		"Exemple: -param commentaire=reconstruction")
 
 	flag.Parse()
-	adminObject, err := prepare(*path, *batchKey, *dateFinEffectif)
+	prepareimport.IgnoreConfigFile(*configFile)
+	params, err := readParamOptions(*paramsFile, *dateDebut, *dateFin, *nbMois, extraParams)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := []prepareimport.Option{prepareimport.WithParams(params)}
+	if *strictDateFinEffectif {
+		opts = append(opts, prepareimport.WithStrictDateFinEffectif())
+	}
+	if *coverageInParam {
+		opts = append(opts, prepareimport.WithCoverageInParam())
+	}
+	if *comparePrevious || *previousAdmin != "" {
+		opts = append(opts, prepareimport.WithPreviousBatchComparison(prepareimport.PreviousBatchComparison{
+			AdminObjectFile: *previousAdmin,
+			MaxSizeDrop:     *maxSizeDrop,
+			MaxFilterDrop:   *maxFilterDrop,
+		}))
+	}
+	if *policyFile != "" {
+		policy, err := prepareimport.ReadBatchPolicy(*policyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, prepareimport.WithPolicy(policy))
+	}
+	if *allowIncomplete {
+		opts = append(opts, prepareimport.WithAllowIncomplete())
+	}
+	mode, err := createfilter.ParsePerimeterMode(*perimeterMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts = append(opts, prepareimport.WithPerimeterMode(mode))
+	opts = append(opts, prepareimport.WithSireneRules(prepareimport.SireneRuleOptions{
+		ExcludeCessees:             *excludeCessees,
+		ExcludeCreatedAfterDateFin: *excludeCreatedAfterDateFin,
+		IgnoreClosedEtablissements: *ignoreClosedEtablissements,
+	}))
+	if *requireSireneUL {
+		opts = append(opts, prepareimport.WithRequiredSireneUL())
+	}
+	if *sireneULCache != "" {
+		opts = append(opts, prepareimport.WithSireneULCache(*sireneULCache))
+	}
+	if *validateIdentifiers || *rejectInvalidIdentifiers {
+		opts = append(opts, prepareimport.WithIdentifierValidation(*rejectInvalidIdentifiers))
+	}
+	if *canonicalNames {
+		opts = append(opts, prepareimport.WithCanonicalNames())
+	}
+	if *interactive && isTerminal(os.Stdin) {
+		if err := resolveUnsupportedFiles(*path, *batchKey, os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	adminObject, err := prepare(*path, *batchKey, *dateFinEffectif, opts...)
 	if err != nil {
 		panic(err)
 	}
 	saveAdminObject(adminObject, *configFile)
+	if *coverageReport != "" {
+		saveCoverageReport(*path, adminObject, *coverageReport)
+	}
+	if *effectifStats != "" {
+		saveEffectifStats(*path, adminObject, *effectifStats)
+	}
 	println("Caution: please make sure that files listed in complete_types were correctly recognized as complete.")
 }
 
-func prepare(path, batchKey, dateFinEffectif string) (prepareimport.AdminObject, error) {
+func prepare(path, batchKey, dateFinEffectif string, opts ...prepareimport.Option) (prepareimport.AdminObject, error) {
 	validBatchKey, err := prepareimport.NewBatchKey(batchKey)
 	if err != nil {
 		return prepareimport.AdminObject{}, errors.Wrap(err, "erreur lors de la création de la clé de batch")
 	}
-	adminObject, err := prepareimport.PrepareImport(path, validBatchKey, dateFinEffectif)
+	adminObject, err := prepareimport.PrepareImport(path, validBatchKey, dateFinEffectif, opts...)
 	if _, ok := err.(prepareimport.UnsupportedFilesError); ok {
 		return adminObject, err
 	} else if err != nil {
@@ -50,6 +178,57 @@ func prepare(path, batchKey, dateFinEffectif string) (prepareimport.AdminObject,
 	return adminObject, nil
 }
 
+// resolveUnsupportedFiles asks the operator how to handle the unsupported files of the batch before it is prepared,
+// so that a misnamed effectif or filter file is taken into account when generating the filter and checking the policy.
+func resolveUnsupportedFiles(path, batchKey string, in io.Reader, out io.Writer) error {
+	validBatchKey, err := prepareimport.NewBatchKey(batchKey)
+	if err != nil {
+		return errors.Wrap(err, "erreur lors de la création de la clé de batch")
+	}
+	_, unsupportedFiles, err := prepareimport.PopulateFilesProperty(path, validBatchKey)
+	if err != nil || len(unsupportedFiles) == 0 {
+		return err
+	}
+	return prepareimport.ResolveUnsupportedFiles(path, validBatchKey, unsupportedFiles, in, out)
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// saveCoverageReport reuses the coverage of the "param" property, if -coverage-in-param already detected it.
+func saveCoverageReport(path string, adminObject prepareimport.AdminObject, reportFile string) {
+	report := adminObject.Param.Coverage
+	if report == nil {
+		report = prepareimport.DetectBatchCoverage(path, adminObject.ID.Key, adminObject.Param.DateFin)
+		report.Print()
+	}
+	jsonData, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(reportFile, jsonData, 0644)
+	}
+	if err != nil {
+		log.Fatal("Erreur inattendue pendant la sauvegarde du rapport de couverture : ", err)
+	}
+}
+
+func saveEffectifStats(path string, adminObject prepareimport.AdminObject, statsFile string) {
+	effectifFiles := adminObject.Files["effectif"]
+	if len(effectifFiles) != 1 {
+		println("Warning: no statistics were computed, as the batch doesn't include one effectif file")
+		return
+	}
+	effectifFile := effectifFiles[0]
+	var prefix string
+	if strings.HasPrefix(effectifFile, "gzip:") {
+		prefix, effectifFile = "gzip:", strings.TrimPrefix(effectifFile, "gzip:")
+	}
+	if err := createfilter.SaveEffectifStats(prefix+filepath.Join(path, effectifFile), statsFile); err != nil {
+		log.Fatal("Erreur inattendue pendant la sauvegarde des statistiques du fichier effectif : ", err)
+	}
+}
+
 func saveAdminObject(toSave prepareimport.AdminObject, configFile string) {
 	err := prepareimport.SaveToFile(toSave, configFile)
 
@@ -57,3 +236,59 @@ func saveAdminObject(toSave prepareimport.AdminObject, configFile string) {
 		log.Fatal("Erreur inattendue pendant la sauvegarde de l'import : ", err)
 	}
 }
+
+// readParamOptions combines the parameters of the command line with the ones of the parameters file.
+// Parameters of the command line take precedence.
+func readParamOptions(paramsFile, dateDebut, dateFin string, nbMois int, extraParams extraParamsFlag) (prepareimport.ParamOptions, error) {
+	if nbMois < 0 {
+		return prepareimport.ParamOptions{}, errors.Errorf("nb-mois doit être positif, trouvé : %d", nbMois)
+	}
+	fromFile := prepareimport.ParamOptions{}
+	if paramsFile != "" {
+		var err error
+		if fromFile, err = prepareimport.ReadParamOptions(paramsFile); err != nil {
+			return prepareimport.ParamOptions{}, err
+		}
+	}
+	fromFlags := prepareimport.ParamOptions{NbMois: nbMois}
+	if len(extraParams) > 0 {
+		fromFlags.Extra = map[string]interface{}{}
+		for key, value := range extraParams {
+			fromFlags.Extra[key] = value
+		}
+	}
+	var err error
+	if fromFlags.DateDebut, err = prepareimport.ParseOptionalDate(dateDebut); err != nil {
+		return prepareimport.ParamOptions{}, errors.Wrap(err, "date-debut invalide")
+	}
+	if fromFlags.DateFin, err = prepareimport.ParseOptionalDate(dateFin); err != nil {
+		return prepareimport.ParamOptions{}, errors.Wrap(err, "date-fin invalide")
+	}
+	if fromFlags.DateDebut.IsZero() && nbMois == 0 {
+		// keep the rolling window or date_debut of the file
+		return fromFlags.Merge(fromFile), nil
+	}
+	// date_debut and nb_mois of the command line replace both values of the file
+	fromFile.DateDebut, fromFile.NbMois = time.Time{}, 0
+	return fromFlags.Merge(fromFile), nil
+}
+
+// extraParamsFlag collects the repeated "-param clé=valeur" flags.
+type extraParamsFlag map[string]string
+
+func (f extraParamsFlag) String() string {
+	pairs := []string{}
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f extraParamsFlag) Set(value string) error {
+	key, val, found := strings.Cut(value, "=")
+	if !found || key == "" {
+		return fmt.Errorf("format attendu: clé=valeur, trouvé: %s", value)
+	}
+	f[key] = val
+	return nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -66,6 +68,28 @@ func Test_prepare(t *testing.T) {
 	}
 }
 
+func Test_resolveUnsupportedFiles(t *testing.T) {
+	batchKey, _ := prepareimport.NewBatchKey("1802")
+	dir := prepareimport.CreateTempFilesWithContent(t, batchKey, map[string][]byte{
+		"salaries_fevrier.csv": ReadFileData(t, "createfilter/test_data.csv"),
+	})
+	var out bytes.Buffer
+	err := resolveUnsupportedFiles(dir, "1802", strings.NewReader("\n"), &out) // accept the proposed type
+	if assert.NoError(t, err) {
+		assert.Contains(t, out.String(), "Type proposé : effectif")
+	}
+	adminObject, err := prepare(dir, "1802", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"/1802/salaries_fevrier.csv"}, adminObject.Files["effectif"])
+		assert.Equal(t, []string{"/1802/filter_siren_1802.csv"}, adminObject.Files["filter"])
+	}
+}
+
+func Test_readParamOptions(t *testing.T) {
+	_, err := readParamOptions("", "", "", -12, nil)
+	assert.EqualError(t, err, "nb-mois doit être positif, trouvé : -12")
+}
+
 func ReadFileData(t *testing.T, filePath string) []byte {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -0,0 +1,176 @@
+// Package periode manipule les périodes au format URSSAF : YYQM ou YYYYQM, où Q est le trimestre
+// et M le mois dans le trimestre (0 pour le trimestre entier). QM vaut 62 pour une année entière.
+package periode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Periode est un type temporel avec un début et une fin employé dans les types et
+// fonctions opensignauxfaibles manipulant des périodes temporelles. La date de fin
+// est exclue de la période.
+type Periode struct {
+	Start time.Time `json:"start" bson:"start"`
+	End   time.Time `json:"end" bson:"end"`
+}
+
+// ErrInvalid est retournée pour un code de période URSSAF invalide.
+var ErrInvalid = errors.New("valeur non autorisée")
+
+// Month retourne la période d'un mois.
+func Month(year int, month time.Month) Periode {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return Periode{start, start.AddDate(0, 1, 0)}
+}
+
+// Quarter retourne la période d'un trimestre, de 1 à 4.
+func Quarter(year int, quarter int) Periode {
+	start := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.UTC)
+	return Periode{start, start.AddDate(0, 3, 0)}
+}
+
+// Year retourne la période d'une année.
+func Year(year int) Periode {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return Periode{start, start.AddDate(1, 0, 0)}
+}
+
+// Parse convertit le format de période urssaf en type Periode. On trouve ces
+// périodes formatées en 4 ou 6 caractère (YYQM ou YYYYQM).
+// si YY < 50 alors YYYY = 20YY sinon YYYY = 19YY.
+// si QM == 62 alors période annuelle sur YYYY.
+// si M == 0 alors période trimestrielle sur le trimestre Q de YYYY.
+// si 0 < M < 4 alors mois M du trimestre Q.
+// Tout autre trimestre ou mois est refusé.
+func Parse(urssaf string) (Periode, error) {
+	for _, c := range urssaf {
+		if c < '0' || c > '9' {
+			return Periode{}, ErrInvalid
+		}
+	}
+	if len(urssaf) == 4 {
+		if urssaf[0:2] < "50" {
+			urssaf = "20" + urssaf
+		} else {
+			urssaf = "19" + urssaf
+		}
+	}
+	if len(urssaf) != 6 {
+		return Periode{}, ErrInvalid
+	}
+	year, _ := strconv.Atoi(urssaf[0:4])
+	if urssaf[4:6] == "62" {
+		return Year(year), nil
+	}
+	quarter := int(urssaf[4] - '0')
+	monthOfQuarter := int(urssaf[5] - '0')
+	if quarter < 1 || quarter > 4 || monthOfQuarter > 3 {
+		return Periode{}, ErrInvalid
+	}
+	if monthOfQuarter == 0 {
+		return Quarter(year, quarter), nil
+	}
+	return Month(year, time.Month((quarter-1)*3+monthOfQuarter)), nil
+}
+
+// FromEffectifColName retourne la période d'une colonne de fichier effectif, ex : "eff201811".
+func FromEffectifColName(colName string) (Periode, error) {
+	if len(colName) < 9 || colName[0:3] != "eff" {
+		return Periode{}, errors.New("this column is not a valid period: " + colName)
+	}
+	return Parse(colName[3:9])
+}
+
+// Format retourne le code URSSAF de la période, au format YYYYQM.
+// Seuls les mois, trimestres et années civils ont un code.
+func (periode Periode) Format() (string, error) {
+	year, month, _ := periode.Start.Date()
+	quarter := (int(month)-1)/3 + 1
+	switch {
+	case periode.IsYear():
+		return fmt.Sprintf("%04d62", year), nil
+	case periode.IsQuarter():
+		return fmt.Sprintf("%04d%d0", year, quarter), nil
+	case periode.IsMonth():
+		return fmt.Sprintf("%04d%d%d", year, quarter, (int(month)-1)%3+1), nil
+	}
+	return "", fmt.Errorf("la période du %s au %s n'a pas de code URSSAF", periode.Start.Format("2006-01-02"), periode.End.Format("2006-01-02"))
+}
+
+// FormatShort retourne le code URSSAF de la période, au format YYQM.
+// Seules les années de 1950 à 2049 sont représentables.
+func (periode Periode) FormatShort() (string, error) {
+	code, err := periode.Format()
+	if err != nil {
+		return "", err
+	}
+	if year := periode.Start.Year(); year < 1950 || year > 2049 {
+		return "", fmt.Errorf("l'année %d n'est pas représentable au format YYQM", year)
+	}
+	return code[2:], nil
+}
+
+// IsMonth indique si la période est un mois civil.
+func (periode Periode) IsMonth() bool {
+	return isFirstDayOfMonth(periode.Start) && periode.End.Equal(periode.Start.AddDate(0, 1, 0))
+}
+
+// IsQuarter indique si la période est un trimestre civil.
+func (periode Periode) IsQuarter() bool {
+	return isFirstDayOfMonth(periode.Start) && (periode.Start.Month()-1)%3 == 0 && periode.End.Equal(periode.Start.AddDate(0, 3, 0))
+}
+
+// IsYear indique si la période est une année civile.
+func (periode Periode) IsYear() bool {
+	return isFirstDayOfMonth(periode.Start) && periode.Start.Month() == time.January && periode.End.Equal(periode.Start.AddDate(1, 0, 0))
+}
+
+func isFirstDayOfMonth(date time.Time) bool {
+	return date.Day() == 1 && date.Hour() == 0 && date.Minute() == 0 && date.Second() == 0 && date.Nanosecond() == 0
+}
+
+// ContainsDate indique si la date appartient à la période.
+func (periode Periode) ContainsDate(date time.Time) bool {
+	return !date.Before(periode.Start) && date.Before(periode.End)
+}
+
+// Contains indique si la période other est entièrement comprise dans la période.
+func (periode Periode) Contains(other Periode) bool {
+	return !other.Start.Before(periode.Start) && !other.End.After(periode.End)
+}
+
+// Overlaps indique si les deux périodes ont au moins un instant en commun.
+func (periode Periode) Overlaps(other Periode) bool {
+	return periode.Start.Before(other.End) && other.Start.Before(periode.End)
+}
+
+// Months retourne les mois civils qui chevauchent la période.
+func (periode Periode) Months() []Periode {
+	return Months(periode.Start, periode.End)
+}
+
+// Quarters retourne les trimestres civils qui chevauchent la période.
+func (periode Periode) Quarters() []Periode {
+	return Quarters(periode.Start, periode.End)
+}
+
+// Months retourne les mois civils qui chevauchent l'intervalle [from, to).
+func Months(from, to time.Time) []Periode {
+	months := []Periode{}
+	for current := Month(from.Year(), from.Month()); current.Start.Before(to); current = Month(current.End.Year(), current.End.Month()) {
+		months = append(months, current)
+	}
+	return months
+}
+
+// Quarters retourne les trimestres civils qui chevauchent l'intervalle [from, to).
+func Quarters(from, to time.Time) []Periode {
+	quarters := []Periode{}
+	for current := Quarter(from.Year(), (int(from.Month())-1)/3+1); current.Start.Before(to); current = Quarter(current.End.Year(), (int(current.End.Month())-1)/3+1) {
+		quarters = append(quarters, current)
+	}
+	return quarters
+}
@@ -0,0 +1,138 @@
+package periode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(year int, month time.Month) time.Time {
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		urssaf   string
+		expected Periode
+	}{
+		{"1811", Month(2018, time.January)},
+		{"1843", Month(2018, time.December)},
+		{"201822", Month(2018, time.May)},
+		{"1740", Quarter(2017, 4)},
+		{"9962", Year(1999)},
+		{"4962", Year(2049)},
+		{"5011", Month(1950, time.January)},
+	}
+	for _, testCase := range cases {
+		actual, err := Parse(testCase.urssaf)
+		if assert.NoError(t, err, testCase.urssaf) {
+			assert.Equal(t, testCase.expected, actual, testCase.urssaf)
+		}
+	}
+
+	for _, invalid := range []string{"", "181", "18111", "1801", "1851", "1814", "1870", "18 1", "-811", "２０１８", "18a1"} {
+		_, err := Parse(invalid)
+		assert.Equal(t, ErrInvalid, err, invalid)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		periode  Periode
+		expected string
+	}{
+		{Month(2018, time.January), "201811"},
+		{Month(2018, time.December), "201843"},
+		{Quarter(2017, 4), "201740"},
+		{Year(1999), "199962"},
+	}
+	for _, testCase := range cases {
+		actual, err := testCase.periode.Format()
+		if assert.NoError(t, err) {
+			assert.Equal(t, testCase.expected, actual)
+		}
+		short, err := testCase.periode.FormatShort()
+		if assert.NoError(t, err) {
+			assert.Equal(t, testCase.expected[2:], short)
+		}
+	}
+
+	_, err := Periode{date(2018, time.February), date(2018, time.May)}.Format()
+	assert.EqualError(t, err, "la période du 2018-02-01 au 2018-05-01 n'a pas de code URSSAF")
+	_, err = Month(2050, time.January).FormatShort()
+	assert.EqualError(t, err, "l'année 2050 n'est pas représentable au format YYQM")
+}
+
+func TestFromEffectifColName(t *testing.T) {
+	actual, err := FromEffectifColName("eff201811")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Month(2018, time.January), actual)
+	}
+	for _, invalid := range []string{"", "eff", "eff2018", "effectif", "abc201811"} {
+		_, err := FromEffectifColName(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	assert.Equal(t, []Periode{Month(2017, time.November), Month(2017, time.December), Month(2018, time.January)},
+		Months(time.Date(2017, time.November, 15, 0, 0, 0, 0, time.UTC), date(2018, time.February)))
+	assert.Equal(t, []Periode{Quarter(2017, 4), Quarter(2018, 1)}, Quarters(date(2017, time.December), date(2018, time.February)))
+	assert.Len(t, Year(2018).Months(), 12)
+	assert.Equal(t, []Periode{Quarter(2018, 1), Quarter(2018, 2), Quarter(2018, 3), Quarter(2018, 4)}, Year(2018).Quarters())
+	assert.Empty(t, Months(date(2018, time.February), date(2018, time.February)))
+}
+
+func TestOverlapsAndContains(t *testing.T) {
+	q1 := Quarter(2018, 1)
+	assert.True(t, q1.Contains(Month(2018, time.March)))
+	assert.False(t, q1.Contains(Month(2018, time.April)))
+	assert.True(t, Year(2018).Contains(q1))
+	assert.False(t, q1.Contains(Year(2018)))
+	assert.True(t, q1.Overlaps(Year(2018)))
+	assert.True(t, q1.Overlaps(Periode{date(2018, time.March), date(2018, time.June)}))
+	assert.False(t, q1.Overlaps(Quarter(2018, 2))) // the end of a period is excluded
+	assert.True(t, q1.ContainsDate(date(2018, time.January)))
+	assert.False(t, q1.ContainsDate(date(2018, time.April)))
+}
+
+// The code of a parsed period can be parsed back to the same period.
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{"1811", "1740", "9962", "201822", "1801", "1870", "eff", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, urssaf string) {
+		parsed, err := Parse(urssaf)
+		if err != nil {
+			return
+		}
+		code, err := parsed.Format()
+		if err != nil {
+			t.Fatalf("%q was parsed, but can't be formatted: %v", urssaf, err)
+		}
+		if len(urssaf) == 6 && code != urssaf {
+			t.Fatalf("%q was formatted as %q", urssaf, code)
+		}
+		short, err := parsed.FormatShort()
+		if len(urssaf) == 4 && (err != nil || short != urssaf) {
+			t.Fatalf("%q was formatted as %q (%v)", urssaf, short, err)
+		}
+		reparsed, err := Parse(code)
+		if err != nil || reparsed != parsed {
+			t.Fatalf("%q was parsed as %v, then as %v from %q", urssaf, parsed, reparsed, code)
+		}
+	})
+}
+
+// Column names never make FromEffectifColName panic.
+func FuzzFromEffectifColName(f *testing.F) {
+	for _, seed := range []string{"eff201811", "eff", "effectif", "", "eff20181"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, colName string) {
+		if p, err := FromEffectifColName(colName); err == nil && !p.IsMonth() && !p.IsQuarter() && !p.IsYear() {
+			t.Fatalf("%q was parsed as an invalid period: %v", colName, p)
+		}
+	})
+}
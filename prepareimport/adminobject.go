@@ -1,12 +1,15 @@
 package prepareimport
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
 	"prepare-import/core"
+	"prepare-import/createfilter"
 )
 
 // AdminObject represents a document going to be stored in the Admin db collection.
@@ -15,11 +18,13 @@ type AdminObject struct {
 	CompleteTypes []ValidFileType            `json:"complete_types,omitempty"`
 	Files         map[ValidFileType][]string `json:"files,omitempty"`
 	Param         ParamProperty              `json:"param,omitempty"`
+	// Overrides reports the manual decisions applied to the batch, if any.
+	Overrides *BatchOverrides `json:"overrides,omitempty"`
 }
 
 // IDProperty represents the "_id" property of an Admin object.
 type IDProperty struct {
-	Key  BatchKey `json:"key,omitempty"`
+	Key  BatchKey `json:"key"`
 	Type string   `json:"type,omitempty"`
 }
 
@@ -28,6 +33,47 @@ type ParamProperty struct {
 	DateDebut       time.Time `json:"date_debut"`
 	DateFin         time.Time `json:"date_fin"`
 	DateFinEffectif time.Time `json:"date_fin_effectif"`
+	// DateFinEffectifSource tells where the value of DateFinEffectif comes from.
+	DateFinEffectifSource DateFinEffectifSource `json:"date_fin_effectif_source,omitempty"`
+	// PerimeterMode tells how the effectif of companies was evaluated, if the filter was generated.
+	PerimeterMode createfilter.PerimeterMode `json:"perimeter_mode,omitempty"`
+	// FilterExclusions counts the exclusions of each rule applied to the perimeter, if the filter was generated.
+	FilterExclusions createfilter.ExclusionReport `json:"filter_exclusions,omitempty"`
+	// FilterComposition lists the lists of sirens combined with the perimeter, in order, if the filter was generated.
+	FilterComposition []createfilter.CompositionStep `json:"filter_composition,omitempty"`
+	// Coverage lists the range of periods covered by each time-series file, if requested.
+	Coverage CoverageReport `json:"coverage,omitempty"`
+	// Extra contains additional entries, serialized after the other properties.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON serializes the properties, followed by the Extra entries.
+func (param ParamProperty) MarshalJSON() ([]byte, error) {
+	type plainParamProperty ParamProperty
+	data, err := json.Marshal(plainParamProperty(param))
+	if err != nil || len(param.Extra) == 0 {
+		return data, err
+	}
+	keys := make([]string, 0, len(param.Extra))
+	for key := range param.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1]) // without the closing brace
+	for _, key := range keys {
+		serializedKey, _ := json.Marshal(key)
+		serializedValue, err := json.Marshal(param.Extra[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(serializedKey)
+		buf.WriteByte(':')
+		buf.Write(serializedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
 }
 
 // UnsupportedFilesError is an Error object that lists files that were not supported.
@@ -40,11 +86,9 @@ func (err UnsupportedFilesError) Error() string {
 }
 
 func populateParamProperty(batchKey BatchKey, dateFinEffectif DateFinEffectif) ParamProperty {
-	year, _ := strconv.Atoi("20" + batchKey.String()[0:2])
-	month, _ := strconv.Atoi(batchKey.String()[2:4])
 	return ParamProperty{
 		DateDebut:       time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
-		DateFin:         time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC),
+		DateFin:         batchKey.Date(),
 		DateFinEffectif: dateFinEffectif.Date(),
 	}
 }
@@ -56,8 +100,9 @@ func populateCompleteTypesProperty(filesProperty FilesProperty) []ValidFileType
 			completeTypes = append(completeTypes, typeName)
 		}
 	}
-	for typeName, thresholdInBytes := range thresholdPerGzippedFileType {
-		if files, ok := filesProperty[typeName]; ok {
+	for _, typeName := range allFileTypes { // rather than the map, for a deterministic order
+		thresholdInBytes, hasThreshold := thresholdPerGzippedFileType[typeName]
+		if files, ok := filesProperty[typeName]; ok && hasThreshold {
 			if len(files) != 1 {
 				panic(fmt.Errorf("'complete' file detection can only work if there is only 1 file per type, found %v for type %v", len(files), typeName))
 			}
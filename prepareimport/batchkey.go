@@ -2,38 +2,154 @@ package prepareimport
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
+	"time"
 )
 
-type BatchKey string
+// BatchKey identifies a batch by its year, its month and, for sub-batches, its number.
+// Its textual form is "AAMM" for a batch, and "AAMM_NN" for a sub-batch.
+type BatchKey struct {
+	year     int
+	month    time.Month
+	subBatch int // 0 for a main batch
+}
 
-// NewBatchKey constructs a valid batch key.
+// NewBatchKey constructs a valid batch key, from a key formatted as "AAMM" or "AAMM_NN".
 func NewBatchKey(key string) (BatchKey, error) {
-	if !validBatchKey.MatchString(key) {
-		return "", errors.New("la clé du batch doit respecter le format requis AAMM")
+	matches := validBatchKey.FindStringSubmatch(key)
+	if matches == nil {
+		return BatchKey{}, errors.New("la clé du batch doit respecter le format requis AAMM")
+	}
+	year, _ := strconv.Atoi(matches[1])
+	month, _ := strconv.Atoi(matches[2])
+	if month < 1 || month > 12 {
+		return BatchKey{}, fmt.Errorf("le mois de la clé du batch doit être compris entre 01 et 12, trouvé : %s", matches[2])
+	}
+	var subBatch int
+	if matches[3] != "" {
+		subBatch, _ = strconv.Atoi(matches[3])
+		if subBatch == 0 {
+			return BatchKey{}, errors.New("le numéro de sous-batch doit être compris entre 01 et 99")
+		}
 	}
-	return BatchKey(key), nil
+	return BatchKey{year: 2000 + year, month: time.Month(month), subBatch: subBatch}, nil
+}
+
+var validBatchKey = regexp.MustCompile(`^([0-9]{2})([0-9]{2})(?:_([0-9]{2}))?$`)
+
+// Year returns the year of the batch, e.g. 2018 for "1802".
+func (b BatchKey) Year() int {
+	return b.year
 }
 
-var validBatchKey = regexp.MustCompile(`^[0-9]{4}`)
+// Month returns the month of the batch, e.g. time.February for "1802".
+func (b BatchKey) Month() time.Month {
+	return b.month
+}
 
-var validSubBatchKey = regexp.MustCompile(`^([0-9]{4})_([0-9]{2})$`)
+// SubBatch returns the number of the sub-batch, or 0 for a main batch.
+func (b BatchKey) SubBatch() int {
+	return b.subBatch
+}
+
+// Date returns the first day of the month of the batch.
+func (b BatchKey) Date() time.Time {
+	return time.Date(b.year, b.month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// IsZero reports whether the key is the zero value, i.e. was not parsed from a valid key.
+func (b BatchKey) IsZero() bool {
+	return b == BatchKey{}
+}
 
 func (b BatchKey) String() string {
-	return string(b)
+	if b.IsZero() {
+		return ""
+	}
+	key := fmt.Sprintf("%02d%02d", b.year%100, int(b.month))
+	if b.IsSubBatch() {
+		key += fmt.Sprintf("_%02d", b.subBatch)
+	}
+	return key
 }
 
 func (b BatchKey) Path() string {
-	return "/" + string(b) + "/"
+	return "/" + b.String() + "/"
 }
 
 func (b BatchKey) IsSubBatch() bool {
-	return validSubBatchKey.MatchString(string(b))
+	return b.subBatch > 0
+}
+
+// Parent returns the main batch of a sub-batch, or the batch itself.
+func (b BatchKey) Parent() BatchKey {
+	return BatchKey{year: b.year, month: b.month}
 }
 
 func (b BatchKey) GetParentBatch() string {
-	if b.IsSubBatch() {
-		return validSubBatchKey.FindStringSubmatch(string(b))[1]
+	return b.Parent().String()
+}
+
+// Next returns the main batch of the following month.
+func (b BatchKey) Next() BatchKey {
+	return batchKeyFromDate(b.Date().AddDate(0, 1, 0))
+}
+
+// Previous returns the main batch of the preceding month.
+func (b BatchKey) Previous() BatchKey {
+	return batchKeyFromDate(b.Date().AddDate(0, -1, 0))
+}
+
+// Compare returns -1, 0 or +1 depending on whether b comes before, is equal to, or comes after other.
+// A sub-batch comes after its parent batch.
+func (b BatchKey) Compare(other BatchKey) int {
+	switch {
+	case b.year != other.year:
+		return sign(b.year - other.year)
+	case b.month != other.month:
+		return sign(int(b.month) - int(other.month))
+	default:
+		return sign(b.subBatch - other.subBatch)
+	}
+}
+
+// Before reports whether b comes before other.
+func (b BatchKey) Before(other BatchKey) bool {
+	return b.Compare(other) < 0
+}
+
+// MarshalText is called when serializing the key, e.g. in the AdminObject.
+func (b BatchKey) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText parses and validates a serialized key.
+func (b *BatchKey) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*b = BatchKey{}
+		return nil
+	}
+	key, err := NewBatchKey(string(text))
+	if err != nil {
+		return err
+	}
+	*b = key
+	return nil
+}
+
+func batchKeyFromDate(date time.Time) BatchKey {
+	return BatchKey{year: date.Year(), month: date.Month()}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
 	}
-	return b.String()
 }
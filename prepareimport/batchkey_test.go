@@ -1,7 +1,9 @@
 package prepareimport
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -27,4 +29,59 @@ func TestBatchKey(t *testing.T) {
 		batchKey, _ := NewBatchKey("1802_01")
 		assert.Equal(t, "1802", batchKey.GetParentBatch())
 	})
+
+	t.Run("Should fail if batch key has trailing characters", func(t *testing.T) {
+		_, err := NewBatchKey("9999garbage")
+		assert.EqualError(t, err, "la clé du batch doit respecter le format requis AAMM")
+	})
+
+	t.Run("Should fail if the month is invalid", func(t *testing.T) {
+		for _, key := range []string{"1800", "1813", "1813_01"} {
+			_, err := NewBatchKey(key)
+			assert.ErrorContains(t, err, "le mois de la clé du batch doit être compris entre 01 et 12", key)
+		}
+	})
+
+	t.Run("Should fail if the sub-batch number is 00", func(t *testing.T) {
+		_, err := NewBatchKey("1802_00")
+		assert.Error(t, err)
+	})
+
+	t.Run("Should parse year, month and sub-batch number", func(t *testing.T) {
+		batchKey, err := NewBatchKey("1912_03")
+		if assert.NoError(t, err) {
+			assert.Equal(t, 2019, batchKey.Year())
+			assert.Equal(t, time.December, batchKey.Month())
+			assert.Equal(t, 3, batchKey.SubBatch())
+			assert.True(t, batchKey.IsSubBatch())
+			assert.Equal(t, "1912_03", batchKey.String())
+			assert.Equal(t, makeDayDate(2019, 12, 1), batchKey.Date())
+		}
+	})
+
+	t.Run("Should navigate to the next and previous batches", func(t *testing.T) {
+		assert.Equal(t, "1901", newSafeBatchKey("1812").Next().String())
+		assert.Equal(t, "1812", newSafeBatchKey("1901").Previous().String())
+		assert.Equal(t, "1803", newSafeBatchKey("1802_02").Next().String())
+	})
+
+	t.Run("Should compare batch keys", func(t *testing.T) {
+		assert.Equal(t, 0, newSafeBatchKey("1802").Compare(newSafeBatchKey("1802")))
+		assert.True(t, newSafeBatchKey("1802").Before(newSafeBatchKey("1803")))
+		assert.True(t, newSafeBatchKey("1812").Before(newSafeBatchKey("1901")))
+		assert.True(t, newSafeBatchKey("1802").Before(newSafeBatchKey("1802_01")))
+		assert.False(t, newSafeBatchKey("1802_02").Before(newSafeBatchKey("1802_01")))
+	})
+
+	t.Run("Should be serialized and parsed as a JSON string", func(t *testing.T) {
+		serialized, err := json.Marshal(IDProperty{newSafeBatchKey("1802_01"), "batch"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, `{"key":"1802_01","type":"batch"}`, string(serialized))
+		}
+		var parsed IDProperty
+		if assert.NoError(t, json.Unmarshal(serialized, &parsed)) {
+			assert.Equal(t, newSafeBatchKey("1802_01"), parsed.Key)
+		}
+		assert.Error(t, json.Unmarshal([]byte(`{"key":"1813"}`), &parsed))
+	})
 }
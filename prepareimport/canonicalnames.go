@@ -0,0 +1,180 @@
+package prepareimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestFilename is the name of the file, inside a batch directory, that maps the canonical name
+// of its files to their original name.
+const ManifestFilename = "canonical-names.json"
+
+// CanonicalNames maps the canonical name of the files of a batch (e.g. "debit_1802.csv.gz")
+// to their original name, as delivered by the provider (e.g. "sigfaible_debits.csv.gz").
+type CanonicalNames map[string]string
+
+// ReadCanonicalNames reads the manifest of a batch directory, if any.
+func ReadCanonicalNames(batchDir string) (CanonicalNames, error) {
+	names := CanonicalNames{}
+	data, err := os.ReadFile(path.Join(batchDir, ManifestFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return names, nil
+	} else if err != nil {
+		return names, err
+	}
+	if err := json.Unmarshal(data, &names); err != nil {
+		return names, fmt.Errorf("invalid manifest file in %s: %w", batchDir, err)
+	}
+	return names, nil
+}
+
+// Save writes the manifest into a batch directory.
+func (names CanonicalNames) Save(batchDir string) error {
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(batchDir, ManifestFilename), append(data, '\n'), 0644)
+}
+
+// originalNames returns the canonical name of each original name.
+func (names CanonicalNames) originalNames() map[string]string {
+	canonicalNames := map[string]string{}
+	for canonicalName, originalName := range names {
+		canonicalNames[originalName] = canonicalName
+	}
+	return canonicalNames
+}
+
+// canonical names of the types which files are not named after the type, e.g. the filter generated by PrepareImport
+var canonicalTypeNames = map[ValidFileType]string{
+	filter: "filter_siren",
+}
+
+// canonicalPrefix returns the beginning of the canonical name of the files of a type, e.g. "debit_1802".
+func canonicalPrefix(fileType ValidFileType, batchKey BatchKey) string {
+	typeName, ok := canonicalTypeNames[fileType]
+	if !ok {
+		typeName = string(fileType)
+	}
+	return typeName + "_" + batchKey.String()
+}
+
+// canonicalFilename returns the canonical name of the n-th file of a type (starting at 1),
+// with the extension of its original name, e.g. "debit_1802.csv.gz" then "debit_1802-2.csv.gz".
+func canonicalFilename(fileType ValidFileType, batchKey BatchKey, originalName string, n int) string {
+	extension := path.Ext(originalName)
+	if extension == ".gz" {
+		extension = path.Ext(strings.TrimSuffix(originalName, extension)) + extension
+	}
+	name := canonicalPrefix(fileType, batchKey)
+	if n > 1 {
+		name += "-" + strconv.Itoa(n)
+	}
+	return name + extension
+}
+
+// canonicalDataFile is a DataFile which is stored in Admin under its canonical name.
+type canonicalDataFile struct {
+	DataFile
+	canonicalName string
+}
+
+// GetFilename returns the canonical name of the file.
+func (dataFile canonicalDataFile) GetFilename() string {
+	return dataFile.canonicalName
+}
+
+// useCanonicalNames gives a canonical name to the supported files of a batch directory, by creating a
+// symbolic link to each of them, and writes the mapping to the manifest. The files keep the canonical
+// name they were given by a previous run, and the links of files which disappeared are removed.
+func useCanonicalNames(batchDir string, batchKey BatchKey, dataFiles []DataFile) ([]DataFile, error) {
+	previousNames, err := ReadCanonicalNames(batchDir)
+	if err != nil {
+		return nil, err
+	}
+	previousCanonicalNames := previousNames.originalNames()
+
+	sortedFiles := append([]DataFile{}, dataFiles...)
+	sort.SliceStable(sortedFiles, func(i, j int) bool {
+		return sortedFiles[i].GetOriginalFilename() < sortedFiles[j].GetOriginalFilename()
+	})
+	names := CanonicalNames{}
+	canonicalNames := map[string]string{} // by original name
+	originalNames := map[string]bool{}
+	for _, dataFile := range dataFiles {
+		originalNames[dataFile.GetOriginalFilename()] = true
+	}
+	// first, keep the canonical names given by the previous run
+	for _, dataFile := range sortedFiles {
+		fileType, originalName := dataFile.DetectFileType(), dataFile.GetOriginalFilename()
+		if canonicalName, ok := previousCanonicalNames[originalName]; ok && strings.HasPrefix(canonicalName, canonicalPrefix(fileType, batchKey)) {
+			names[canonicalName], canonicalNames[originalName] = originalName, canonicalName
+		}
+	}
+	for _, dataFile := range sortedFiles {
+		fileType, originalName := dataFile.DetectFileType(), dataFile.GetOriginalFilename()
+		if fileType == "" || canonicalNames[originalName] != "" {
+			continue
+		}
+		for n := 1; ; n++ {
+			canonicalName := canonicalFilename(fileType, batchKey, originalName, n)
+			_, taken := names[canonicalName]
+			if !taken && (canonicalName == originalName || !originalNames[canonicalName]) {
+				names[canonicalName], canonicalNames[originalName] = originalName, canonicalName
+				break
+			}
+		}
+	}
+
+	for canonicalName, originalName := range previousNames {
+		if names[canonicalName] != originalName {
+			if err := removeLink(path.Join(batchDir, canonicalName), originalName); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result := []DataFile{}
+	for _, dataFile := range dataFiles {
+		originalName := dataFile.GetOriginalFilename()
+		canonicalName := canonicalNames[originalName]
+		if canonicalName == "" || canonicalName == originalName {
+			result = append(result, dataFile)
+			continue
+		}
+		if err := link(batchDir, originalName, canonicalName); err != nil {
+			return nil, err
+		}
+		println("Info: " + originalName + " is referenced as " + canonicalName)
+		result = append(result, canonicalDataFile{dataFile, canonicalName})
+	}
+	if len(names) == 0 && len(previousNames) == 0 {
+		return result, nil
+	}
+	return result, names.Save(batchDir)
+}
+
+// link creates a symbolic link named canonicalName to originalName, unless it already exists.
+func link(batchDir string, originalName string, canonicalName string) error {
+	linkPath := path.Join(batchDir, canonicalName)
+	if target, err := os.Readlink(linkPath); err == nil && target == originalName {
+		return nil
+	} else if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("can't reference %s as %s: a file with that name already exists", originalName, canonicalName)
+	}
+	return os.Symlink(originalName, linkPath)
+}
+
+// removeLink removes a symbolic link to originalName, if it still exists.
+func removeLink(linkPath string, originalName string) error {
+	if target, err := os.Readlink(linkPath); err != nil || target != originalName {
+		return nil // not a link created by useCanonicalNames
+	}
+	return os.Remove(linkPath)
+}
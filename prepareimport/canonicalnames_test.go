@@ -0,0 +1,121 @@
+package prepareimport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalFilename(t *testing.T) {
+	assert.Equal(t, "debit_1802.csv", canonicalFilename(debit, dummyBatchKey, "sigfaible_debits.csv", 1))
+	assert.Equal(t, "debit_1802-2.csv.gz", canonicalFilename(debit, dummyBatchKey, "sigfaible_debits2.csv.gz", 2))
+	assert.Equal(t, "filter_siren_1802.csv", canonicalFilename(filter, dummyBatchKey, "filter_siren_2002.csv", 1))
+	assert.Equal(t, "paydex_1802", canonicalFilename(paydex, dummyBatchKey, "E_202011095813_Retro-Paydex_20201207", 1))
+}
+
+func TestWithCanonicalNames(t *testing.T) {
+	gzippedProcol, _ := GzipString("Siret;Dt_effet\n")
+	setup := func(t *testing.T) string {
+		return CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"filter_siren_2002.csv":  []byte("siren\n111111111\n"),
+			"diane_req_2002.csv":     []byte("diane"),
+			"diane_req_dom_2002.csv": []byte("diane2"),
+			"sigfaible_pcoll.csv.gz": gzippedProcol,
+			"unsupported_notes.xlsx": {},
+			"batch-overrides.json":   []byte(`{"exclude": ["unsupported_notes.xlsx"]}`),
+		})
+	}
+	prepare := func(t *testing.T, dir string) AdminObject {
+		t.Helper()
+		adminObject, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithCanonicalNames())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return adminObject
+	}
+
+	t.Run("references the files by their canonical name, through links to the original files", func(t *testing.T) {
+		dir := setup(t)
+		adminObject := prepare(t, dir)
+		assert.Equal(t, map[ValidFileType][]string{
+			diane:  {"/1802/diane_1802.csv", "/1802/diane_1802-2.csv"},
+			filter: {"/1802/filter_siren_1802.csv"},
+			procol: {"gzip:/1802/procol_1802.csv.gz"},
+		}, adminObject.Files)
+		content, err := os.ReadFile(filepath.Join(dir, "1802", "diane_1802-2.csv"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "diane2", string(content))
+		}
+		names, err := ReadCanonicalNames(filepath.Join(dir, "1802"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, CanonicalNames{
+				"diane_1802.csv":        "diane_req_2002.csv",
+				"diane_1802-2.csv":      "diane_req_dom_2002.csv",
+				"filter_siren_1802.csv": "filter_siren_2002.csv",
+				"procol_1802.csv.gz":    "sigfaible_pcoll.csv.gz",
+			}, names)
+		}
+	})
+
+	t.Run("keeps the original names when the option is not provided", func(t *testing.T) {
+		dir := setup(t)
+		prepare(t, dir)
+		adminObject, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"/1802/diane_req_2002.csv", "/1802/diane_req_dom_2002.csv"}, adminObject.Files[diane])
+		}
+	})
+
+	t.Run("keeps the canonical names of the files across runs, and removes the links of removed files", func(t *testing.T) {
+		dir := setup(t)
+		batchDir := filepath.Join(dir, "1802")
+		expected := prepare(t, dir)
+		assert.Equal(t, expected, prepare(t, dir))
+
+		_ = os.Remove(filepath.Join(batchDir, "diane_req_2002.csv"))
+		_ = os.WriteFile(filepath.Join(batchDir, "diane_req_dom_2003.csv"), []byte("diane3"), 0666)
+		adminObject := prepare(t, dir)
+		assert.Equal(t, []string{"/1802/diane_1802-2.csv", "/1802/diane_1802.csv"}, adminObject.Files[diane])
+		content, _ := os.ReadFile(filepath.Join(batchDir, "diane_1802.csv"))
+		assert.Equal(t, "diane3", string(content))
+		names, _ := ReadCanonicalNames(batchDir)
+		assert.Equal(t, "diane_req_dom_2002.csv", names["diane_1802-2.csv"])
+		assert.Equal(t, "diane_req_dom_2003.csv", names["diane_1802.csv"])
+	})
+
+	t.Run("creates the links of a sub-batch in its directory", func(t *testing.T) {
+		subBatchKey := newSafeBatchKey("1802_01")
+		dir := t.TempDir()
+		subBatchDir := BatchDir(dir, subBatchKey)
+		_ = os.MkdirAll(subBatchDir, 0777)
+		_ = os.WriteFile(filepath.Join(subBatchDir, "filter_siren_2002.csv"), []byte("siren\n111111111\n"), 0666)
+		_ = os.WriteFile(filepath.Join(subBatchDir, "diane_req_2002.csv"), []byte("diane"), 0666)
+		adminObject, err := PrepareImport(dir, subBatchKey, dummyDateFinEffectif, WithCanonicalNames())
+		if assert.NoError(t, err) {
+			assert.Equal(t, map[ValidFileType][]string{
+				diane:  {"/1802_01/diane_1802_01.csv"},
+				filter: {"/1802_01/filter_siren_1802_01.csv"},
+			}, adminObject.Files)
+		}
+		content, err := os.ReadFile(filepath.Join(subBatchDir, "diane_1802_01.csv"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "diane", string(content))
+		}
+		names, err := ReadCanonicalNames(subBatchDir)
+		if assert.NoError(t, err) {
+			assert.Equal(t, CanonicalNames{
+				"diane_1802_01.csv":        "diane_req_2002.csv",
+				"filter_siren_1802_01.csv": "filter_siren_2002.csv",
+			}, names)
+		}
+	})
+
+	t.Run("fails if a directory already has the canonical name of a file", func(t *testing.T) {
+		dir := setup(t)
+		_ = os.Mkdir(filepath.Join(dir, "1802", "diane_1802.csv"), 0777)
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithCanonicalNames())
+		assert.ErrorContains(t, err, "can't reference diane_req_2002.csv as diane_1802.csv: a file with that name already exists")
+	})
+}
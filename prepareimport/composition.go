@@ -0,0 +1,57 @@
+package prepareimport
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"prepare-import/createfilter"
+)
+
+// prefixes of the CSV files of a batch which are combined with the generated filter, in this order
+var compositionFilePrefixes = []struct {
+	prefix    string
+	operation createfilter.CompositionOperation
+}{
+	{"perimeter_union", createfilter.Union},               // e.g. the filter of the previous batch
+	{"perimeter_intersection", createfilter.Intersection}, // e.g. the filter of the previous batch
+	{"perimeter_include", createfilter.Include},           // companies that must always be in the perimeter
+	{"perimeter_exclude", createfilter.Exclude},           // companies that must never be in the perimeter
+}
+
+// findCompositionSteps lists the composition files of a batch, ordered by operation, then by name.
+// The File of each step is relative to pathname, like the paths of the Admin object.
+func findCompositionSteps(pathname string, batchKey BatchKey) ([]createfilter.CompositionStep, error) {
+	batchPath := getBatchPath(batchKey)
+	entries, err := os.ReadDir(path.Join(pathname, batchPath))
+	if err != nil {
+		return nil, err
+	}
+	filenames := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".csv") {
+			filenames = append(filenames, entry.Name())
+		}
+	}
+	sort.Strings(filenames)
+	steps := []createfilter.CompositionStep{}
+	for _, composition := range compositionFilePrefixes {
+		for _, filename := range filenames {
+			if strings.HasPrefix(filename, composition.prefix) {
+				steps = append(steps, createfilter.CompositionStep{Operation: composition.operation, File: "/" + path.Join(batchPath, filename)})
+			}
+		}
+	}
+	return steps, nil
+}
+
+// withAbsolutePaths returns a copy of the steps, which files are relative to pathname.
+func withAbsolutePaths(pathname string, steps []createfilter.CompositionStep) []createfilter.CompositionStep {
+	absoluteSteps := make([]createfilter.CompositionStep, len(steps))
+	for i, step := range steps {
+		step.File = path.Join(pathname, step.File)
+		absoluteSteps[i] = step
+	}
+	return absoluteSteps
+}
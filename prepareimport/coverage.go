@@ -0,0 +1,199 @@
+package prepareimport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"prepare-import/periode"
+)
+
+// Coverage is the range of periods found in the data files of a given type.
+type Coverage struct {
+	FirstPeriod  time.Time `json:"first_period"`
+	LastPeriod   time.Time `json:"last_period"`
+	MonthsBehind int       `json:"months_behind"` // number of months between the last period and date_fin
+}
+
+// CoverageReport lists the coverage of each time-series file type of a batch.
+type CoverageReport map[ValidFileType]Coverage
+
+// periodDetector describes where to find the period of each row of a time-series file.
+type periodDetector struct {
+	columns []string // candidate names of the column that holds the period (case insensitive)
+	parse   func(string) (time.Time, error)
+}
+
+// time-series file types for which the coverage can be detected
+var periodDetectors = map[ValidFileType]periodDetector{
+	cotisation: {[]string{"periode"}, parseUrssafPeriod},
+	debit:      {[]string{"periode", "per_ech"}, parseUrssafPeriod},
+	delai:      {[]string{"date_creation", "date de creation"}, parseDate},
+	apconso:    {[]string{"mois", "periode"}, parseDate},
+	apdemande:  {[]string{"date_statut", "date_deb"}, parseDate},
+	procol:     {[]string{"dt_effet", "date_effet"}, parseDate},
+}
+
+// DetectBatchCoverage detects the range of periods covered by the time-series files of a batch,
+// and how far behind dateFin (i.e. the date_fin param of the batch) they end.
+func DetectBatchCoverage(pathname string, batchKey BatchKey, dateFin time.Time) CoverageReport {
+	filesProperty, _, err := PopulateFilesProperty(pathname, batchKey)
+	if err != nil {
+		println("Warning: " + err.Error())
+	}
+	return detectCoverage(filesProperty, dateFin)
+}
+
+// detectCoverage skips the files which periods can't be detected, after printing a warning.
+func detectCoverage(filesProperty FilesProperty, dateFin time.Time) CoverageReport {
+	report := CoverageReport{}
+	for fileType, detector := range periodDetectors {
+		for _, file := range filesProperty[fileType] {
+			println("Detecting periods covered by " + file.Name() + " ...")
+			first, last, err := detector.detect(file.DataFile())
+			if err != nil {
+				println(fmt.Sprintf("Warning: could not detect periods covered by %s: %v", file.Name(), err))
+				continue
+			}
+			coverage, exists := report[fileType]
+			if !exists || first.Before(coverage.FirstPeriod) {
+				coverage.FirstPeriod = first
+			}
+			if last.After(coverage.LastPeriod) {
+				coverage.LastPeriod = last
+			}
+			coverage.MonthsBehind = monthsBetween(coverage.LastPeriod, dateFin)
+			report[fileType] = coverage
+		}
+	}
+	return report
+}
+
+// Print outputs a line per file type, ordered by name.
+func (report CoverageReport) Print() {
+	fileTypes := []string{}
+	for fileType := range report {
+		fileTypes = append(fileTypes, string(fileType))
+	}
+	sort.Strings(fileTypes)
+	for _, fileType := range fileTypes {
+		coverage := report[ValidFileType(fileType)]
+		println(fmt.Sprintf("Coverage of %s: from %s to %s (%d months behind date_fin)",
+			fileType, formatDate(coverage.FirstPeriod), formatDate(coverage.LastPeriod), coverage.MonthsBehind))
+	}
+}
+
+// detect returns the first and last periods found in the file.
+func (detector periodDetector) detect(dataFile DataFile) (first time.Time, last time.Time, err error) {
+	r, f, err := openCsvFile(dataFile)
+	if err != nil {
+		return first, last, err
+	}
+	defer f.Close()
+	header, err := r.Read()
+	if err != nil {
+		return first, last, err
+	}
+	col := findColumn(header, detector.columns)
+	if col < 0 {
+		return first, last, fmt.Errorf("none of the columns %v was found", detector.columns)
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return first, last, err
+		}
+		if col >= len(record) || record[col] == "" {
+			continue
+		}
+		period, err := detector.parse(strings.TrimSpace(record[col]))
+		if err != nil {
+			continue // invalid periods are reported by the import process
+		}
+		if first.IsZero() || period.Before(first) {
+			first = period
+		}
+		if period.After(last) {
+			last = period
+		}
+	}
+	if first.IsZero() {
+		return first, last, errors.New("no valid period was found")
+	}
+	return first, last, nil
+}
+
+func findColumn(header []string, candidates []string) int {
+	for _, candidate := range candidates {
+		for i, colName := range header {
+			if strings.EqualFold(strings.TrimSpace(colName), candidate) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// openCsvFile opens a csv file and guesses its separator from its first line.
+// If the original name of the file ends with ".gz", the file will be decompressed on the fly.
+func openCsvFile(dataFile DataFile) (*csv.Reader, io.Closer, error) {
+	file, err := dataFile.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	var fileReader io.Reader = file
+	if isGzipped(dataFile) {
+		if fileReader, err = gzip.NewReader(file); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	bufferedReader := bufio.NewReader(fileReader)
+	firstLine, _ := bufferedReader.Peek(4096)
+	r := csv.NewReader(bufferedReader)
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	r.Comma = guessSeparator(string(firstLine))
+	return r, file, nil
+}
+
+func guessSeparator(firstLine string) rune {
+	if i := strings.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+	separator, maxCount := ';', 0
+	for _, candidate := range []rune{';', ',', '|', '\t'} {
+		if count := strings.Count(firstLine, string(candidate)); count > maxCount {
+			separator, maxCount = candidate, count
+		}
+	}
+	return separator
+}
+
+func parseUrssafPeriod(value string) (time.Time, error) {
+	period, err := periode.Parse(value)
+	return period.Start, err
+}
+
+var dateLayouts = []string{"2006-01-02", "02/01/2006", "2006-01-02 15:04:05", "2006-01", "01/2006", "02Jan2006", "20060102"}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.New("unsupported date format: " + value)
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
@@ -0,0 +1,50 @@
+package prepareimport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCoverage(t *testing.T) {
+	t.Run("Should detect the periods covered by debit and procol files", func(t *testing.T) {
+		gzippedDebits, _ := GzipString("num_cpte;Num_Ets;periode;Mt_PO\n1;1;1711;10\n2;1;1811;20\n3;1;1740;30\n")
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_debits.csv.gz": gzippedDebits,
+			"sigfaible_pcoll.csv":     []byte("siret,dt_effet,action_procol\n11111111111111,2017-03-15,liquidation\n22222222222222,2016-12-01,redressement\n"),
+		})
+		report := DetectBatchCoverage(dir, dummyBatchKey, dummyBatchKey.Date())
+		assert.Equal(t, CoverageReport{
+			debit:  {FirstPeriod: makeDayDate(2017, 1, 1), LastPeriod: makeDayDate(2018, 1, 1), MonthsBehind: 1},
+			procol: {FirstPeriod: makeDayDate(2016, 12, 1), LastPeriod: makeDayDate(2017, 3, 15), MonthsBehind: 11},
+		}, report)
+	})
+
+	t.Run("Should count the months behind the provided date_fin", func(t *testing.T) {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_pcoll.csv": []byte("siret,dt_effet,action_procol\n11111111111111,2017-03-15,liquidation\n"),
+		})
+		report := DetectBatchCoverage(dir, dummyBatchKey, makeDayDate(2017, 6, 1))
+		assert.Equal(t, 3, report[procol].MonthsBehind)
+	})
+
+	t.Run("Should skip files which period column is not found", func(t *testing.T) {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_cotisdues.csv": []byte("a;b\n1;2\n"),
+		})
+		assert.Equal(t, CoverageReport{}, DetectBatchCoverage(dir, dummyBatchKey, dummyBatchKey.Date()))
+	})
+
+	t.Run("Should add the coverage to the param property, if requested", func(t *testing.T) {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"filter_2002.csv": {},
+			"demande_ap.csv":  []byte("ID_DA,ETAB_SIRET,DATE_STATUT\n1,11111111111111,01/02/2018\n"),
+		})
+		res, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithCoverageInParam())
+		if assert.NoError(t, err) {
+			assert.Equal(t, CoverageReport{
+				apdemande: {FirstPeriod: makeDayDate(2018, 2, 1), LastPeriod: makeDayDate(2018, 2, 1), MonthsBehind: 0},
+			}, res.Param.Coverage)
+		}
+	})
+}
@@ -1,7 +1,11 @@
 package prepareimport
 
 import (
+	"errors"
+	"fmt"
 	"time"
+
+	"prepare-import/createfilter"
 )
 
 // DateFinEffectif is a date that can be serialized for MongoDB.
@@ -9,9 +13,9 @@ type DateFinEffectif interface {
 	Date() time.Time
 }
 
-// NewDateFinEffectif creates a valid DateFinEffectif.
+// NewDateFinEffectif creates a DateFinEffectif.
+// The value is validated beforehand, by reconcileDateFinEffectif.
 func NewDateFinEffectif(date time.Time) DateFinEffectif {
-	// TODO: validate the value
 	return dateFinEffectifType{date}
 }
 
@@ -23,3 +27,144 @@ type dateFinEffectifType struct {
 func (dateFinEffectif dateFinEffectifType) Date() time.Time {
 	return dateFinEffectif.Time
 }
+
+// DateFinEffectifSource names where the value of date_fin_effectif comes from.
+type DateFinEffectifSource string
+
+// Sources of date_fin_effectif, by order of priority.
+const (
+	fromOverrides   DateFinEffectifSource = "overrides"
+	fromEffectif    DateFinEffectifSource = "effectif"
+	fromEffectifEnt DateFinEffectifSource = "effectif_ent"
+	fromCLI         DateFinEffectifSource = "cli"
+)
+
+// dateFinEffectifCandidate is a value of date_fin_effectif provided by a source.
+type dateFinEffectifCandidate struct {
+	source DateFinEffectifSource
+	date   time.Time
+}
+
+// reconcileDateFinEffectif picks the value of date_fin_effectif among candidates, ordered by priority,
+// and checks its consistency with the other candidates and with the date_fin_effectif of the previous batch.
+// Inconsistencies are reported as warnings, or as errors if strict is true. As a value of the overrides file
+// is a deliberate decision, the other candidates which differ from it are only reported as warnings.
+// A date after now is always an error.
+func reconcileDateFinEffectif(candidates []dateFinEffectifCandidate, previousDateFinEffectif time.Time, strict bool, now time.Time) (dateFinEffectifCandidate, error) {
+	if len(candidates) == 0 {
+		return dateFinEffectifCandidate{}, errors.New("date_fin_effectif is missing: batch should include an effectif file, or the value should be provided")
+	}
+	chosen := candidates[0]
+	if chosen.date.After(now) {
+		return dateFinEffectifCandidate{}, fmt.Errorf("date_fin_effectif from %s is in the future: %s", chosen.source, formatDate(chosen.date))
+	}
+	inconsistencies := []string{}
+	for _, other := range candidates[1:] {
+		if other.date.Equal(chosen.date) {
+			continue
+		}
+		mismatch := fmt.Sprintf("date_fin_effectif from %s (%s) differs from the one from %s (%s)",
+			other.source, formatDate(other.date), chosen.source, formatDate(chosen.date))
+		if chosen.source == fromOverrides {
+			println("Warning: " + mismatch)
+		} else {
+			inconsistencies = append(inconsistencies, mismatch)
+		}
+	}
+	if !previousDateFinEffectif.IsZero() && chosen.date.Before(previousDateFinEffectif) {
+		inconsistencies = append(inconsistencies, fmt.Sprintf("date_fin_effectif from %s (%s) is earlier than the one of the previous batch (%s)",
+			chosen.source, formatDate(chosen.date), formatDate(previousDateFinEffectif)))
+	}
+	for _, inconsistency := range inconsistencies {
+		if strict {
+			return dateFinEffectifCandidate{}, errors.New(inconsistency)
+		}
+		println("Warning: " + inconsistency)
+	}
+	println(fmt.Sprintf("Using date_fin_effectif from %s: %s", chosen.source, formatDate(chosen.date)))
+	return chosen, nil
+}
+
+// collectDateFinEffectifCandidates detects date_fin_effectif from the effectif and effectif_ent files,
+// and parses the values provided in the overrides file of the batch and in the CLI parameter.
+func collectDateFinEffectifCandidates(pathname string, effectifFile, effectifEntFile BatchFile, overriddenDateFinEffectif, providedDateFinEffectif string) ([]dateFinEffectifCandidate, error) {
+	candidates := []dateFinEffectifCandidate{}
+	if overriddenDateFinEffectif != "" {
+		date, err := time.Parse("2006-01-02", overriddenDateFinEffectif)
+		if err != nil {
+			return nil, errors.New("date_fin_effectif is invalid in overrides file: " + overriddenDateFinEffectif)
+		}
+		candidates = append(candidates, dateFinEffectifCandidate{fromOverrides, date})
+	}
+	if effectifFile != nil {
+		println("Detecting dateFinEffectif from effectif file ...")
+		date, err := createfilter.DetectDateFinEffectif(effectifFile.AbsolutePath(pathname)) // TODO: éviter de lire le fichier Effectif deux fois
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, dateFinEffectifCandidate{fromEffectif, date})
+	}
+	if effectifEntFile != nil {
+		println("Detecting dateFinEffectif from effectif_ent file ...")
+		date, err := createfilter.DetectDateFinEffectifEnt(effectifEntFile.AbsolutePath(pathname))
+		if err != nil {
+			println("Warning: could not detect dateFinEffectif from effectif_ent file: " + err.Error())
+		} else {
+			candidates = append(candidates, dateFinEffectifCandidate{fromEffectifEnt, date})
+		}
+	}
+	if providedDateFinEffectif != "" {
+		date, err := time.Parse("2006-01-02", providedDateFinEffectif)
+		if err != nil {
+			return nil, errors.New("date_fin_effectif is missing or invalid: " + providedDateFinEffectif)
+		}
+		candidates = append(candidates, dateFinEffectifCandidate{fromCLI, date})
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("date_fin_effectif is missing or invalid: " + providedDateFinEffectif)
+	}
+	return candidates, nil
+}
+
+// lookUpPreviousDateFinEffectif returns the date_fin_effectif of the previous batch: the one of the Admin object
+// it is compared with, if any, or else, in strict mode only, the one detected from its files, as they must be read
+// entirely. It returns a zero time if the date is not looked up or can't be found.
+func lookUpPreviousDateFinEffectif(pathname string, batchKey BatchKey, options options) time.Time {
+	if options.previousBatch != nil && options.previousBatch.AdminObjectFile != "" {
+		previousAdminObject, err := ReadAdminObject(options.previousBatch.AdminObjectFile)
+		if err != nil {
+			return time.Time{}
+		}
+		return previousAdminObject.Param.DateFinEffectif
+	}
+	if !options.strictDateFinEffectif {
+		return time.Time{}
+	}
+	return detectPreviousDateFinEffectif(pathname, batchKey)
+}
+
+// detectPreviousDateFinEffectif returns the date_fin_effectif detected in the batch preceding batchKey
+// in pathname (even if some months were skipped), or a zero time if it can't be detected.
+func detectPreviousDateFinEffectif(pathname string, batchKey BatchKey) time.Time {
+	previousBatch, found := FindPreviousBatch(pathname, batchKey)
+	if !found {
+		return time.Time{}
+	}
+	filesProperty, _, err := PopulateFilesProperty(pathname, previousBatch)
+	if err != nil {
+		return time.Time{}
+	}
+	effectifFile, _ := filesProperty.GetEffectifFile()
+	effectifEntFile, _ := filesProperty.GetEffectifEntFile()
+	if effectifFile != nil {
+		if date, err := createfilter.DetectDateFinEffectif(effectifFile.AbsolutePath(pathname)); err == nil {
+			return date
+		}
+	}
+	if effectifEntFile != nil {
+		if date, err := createfilter.DetectDateFinEffectifEnt(effectifEntFile.AbsolutePath(pathname)); err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
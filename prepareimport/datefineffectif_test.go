@@ -0,0 +1,105 @@
+package prepareimport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileDateFinEffectif(t *testing.T) {
+	now := makeDayDate(2021, 1, 1)
+
+	fromEffectifFile := dateFinEffectifCandidate{fromEffectif, makeDayDate(2020, 1, 1)}
+
+	t.Run("Should prefer the first candidate", func(t *testing.T) {
+		res, err := reconcileDateFinEffectif([]dateFinEffectifCandidate{fromEffectifFile, {fromCLI, makeDayDate(2019, 12, 1)}}, time.Time{}, false, now)
+		if assert.NoError(t, err) {
+			assert.Equal(t, fromEffectifFile, res)
+		}
+	})
+
+	t.Run("Should fail on mismatching candidates, in strict mode", func(t *testing.T) {
+		_, err := reconcileDateFinEffectif([]dateFinEffectifCandidate{fromEffectifFile, {fromCLI, makeDayDate(2019, 12, 1)}}, time.Time{}, true, now)
+		assert.EqualError(t, err, "date_fin_effectif from cli (2019-12-01) differs from the one from effectif (2020-01-01)")
+	})
+
+	t.Run("Should only warn on candidates which differ from the overrides file, in strict mode", func(t *testing.T) {
+		fromOverridesFile := dateFinEffectifCandidate{fromOverrides, makeDayDate(2019, 12, 1)}
+		res, err := reconcileDateFinEffectif([]dateFinEffectifCandidate{fromOverridesFile, fromEffectifFile}, time.Time{}, true, now)
+		if assert.NoError(t, err) {
+			assert.Equal(t, fromOverridesFile, res)
+		}
+	})
+
+	t.Run("Should accept matching candidates, in strict mode", func(t *testing.T) {
+		_, err := reconcileDateFinEffectif([]dateFinEffectifCandidate{fromEffectifFile, {fromEffectifEnt, makeDayDate(2020, 1, 1)}}, makeDayDate(2019, 12, 1), true, now)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should fail on a date earlier than the previous batch, in strict mode", func(t *testing.T) {
+		_, err := reconcileDateFinEffectif([]dateFinEffectifCandidate{fromEffectifFile}, makeDayDate(2020, 2, 1), true, now)
+		assert.EqualError(t, err, "date_fin_effectif from effectif (2020-01-01) is earlier than the one of the previous batch (2020-02-01)")
+	})
+
+	t.Run("Should only warn on a date earlier than the previous batch", func(t *testing.T) {
+		_, err := reconcileDateFinEffectif([]dateFinEffectifCandidate{fromEffectifFile}, makeDayDate(2020, 2, 1), false, now)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should fail on a date in the future", func(t *testing.T) {
+		_, err := reconcileDateFinEffectif([]dateFinEffectifCandidate{{fromCLI, makeDayDate(2022, 1, 1)}}, time.Time{}, false, now)
+		assert.EqualError(t, err, "date_fin_effectif from cli is in the future: 2022-01-01")
+	})
+}
+
+func TestPrepareImportDateFinEffectif(t *testing.T) {
+	t.Run("Should record that date_fin_effectif was provided as a parameter", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		res, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
+		if assert.NoError(t, err) {
+			assert.Equal(t, fromCLI, res.Param.DateFinEffectifSource)
+		}
+	})
+
+	t.Run("Should fail if the parameter differs from the effectif file, in strict mode", func(t *testing.T) {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": ReadFileData(t, "../createfilter/test_data.csv"),
+			"filter_2002.csv":              {},
+		})
+		_, err := PrepareImport(dir, dummyBatchKey, "2019-12-01", WithStrictDateFinEffectif())
+		assert.EqualError(t, err, "date_fin_effectif from cli (2019-12-01) differs from the one from effectif (2020-01-01)")
+	})
+
+	for _, previousBatch := range []string{"1801", "1711"} { // the previous month, or an earlier batch if months were skipped
+		t.Run("Should fail if date_fin_effectif is earlier than the previous batch "+previousBatch+", in strict mode", func(t *testing.T) {
+			dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+			previousBatchDir := filepath.Join(dir, previousBatch)
+			_ = os.Mkdir(previousBatchDir, 0777)
+			effectifData := ReadFileData(t, "../createfilter/test_data.csv")
+			if err := os.WriteFile(filepath.Join(previousBatchDir, "sigfaible_effectif_siret.csv"), effectifData, 0666); err != nil {
+				t.Fatal(err)
+			}
+			_, err := PrepareImport(dir, dummyBatchKey, "2019-12-01", WithStrictDateFinEffectif())
+			assert.EqualError(t, err, "date_fin_effectif from cli (2019-12-01) is earlier than the one of the previous batch (2020-01-01)")
+		})
+	}
+	t.Run("Should read the date_fin_effectif of the previous batch from its Admin object", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		adminObjectFile := filepath.Join(t.TempDir(), "1801.json")
+		previousAdminObject := AdminObject{ID: IDProperty{newSafeBatchKey("1801"), "batch"}, Param: ParamProperty{DateFinEffectif: makeDayDate(2020, 1, 1)}}
+		if err := SaveToFile(previousAdminObject, adminObjectFile); err != nil {
+			t.Fatal(err)
+		}
+		_, err := PrepareImport(dir, dummyBatchKey, "2019-12-01", WithStrictDateFinEffectif(), WithPreviousBatchComparison(PreviousBatchComparison{AdminObjectFile: adminObjectFile}))
+		assert.EqualError(t, err, "date_fin_effectif from cli (2019-12-01) is earlier than the one of the previous batch (2020-01-01)")
+	})
+
+	t.Run("Should compare date_fin_effectif with the provided clock", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		_, err := PrepareImport(dir, dummyBatchKey, "2019-12-01", WithClock(func() time.Time { return makeDayDate(2019, 1, 1) }))
+		assert.EqualError(t, err, "date_fin_effectif from cli is in the future: 2019-12-01")
+	})
+}
@@ -1,51 +1,209 @@
 package prepareimport
 
 import (
-	"log"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"strings"
+	"time"
 )
 
-// DataFile represents a Data File to be imported, and allows to determine its type and name.
+// DataFile represents a Data File to be imported, and allows to determine its type and name,
+// and to read it, wherever it is stored.
 type DataFile interface {
 	GetFilename() string           // the name as it will be stored in Admin
 	GetOriginalFilename() string   // the original name of the file
 	DetectFileType() ValidFileType // returns the type of that file (e.g. DEBIT)
-	GetSize() *uint64              // returns the size of that file, in bytes
+	Stat() (DataFileInfo, error)   // returns the size and modification time of that file
+	Open() (io.ReadCloser, error)  // returns a reader of the content of that file, to be closed by the caller
 }
 
-// NewDataFile returns a SimpleDataFile
+// DataFileInfo describes the size and modification time of a DataFile.
+type DataFileInfo struct {
+	Size    uint64    // in bytes
+	ModTime time.Time // zero if unknown
+}
+
+// NewDataFile returns a LocalDataFile
 func NewDataFile(file string, pathname string) DataFile {
-	return SimpleDataFile{file, pathname}
+	return LocalDataFile{file, pathname}
 }
 
-// SimpleDataFile is a DataFile
-type SimpleDataFile struct {
+// LocalDataFile is a DataFile stored in a local directory.
+type LocalDataFile struct {
 	filename string
-	pathname string
+	pathname string // the directory of the file
 }
 
 // DetectFileType returns the type of that file (e.g. DEBIT).
-func (dataFile SimpleDataFile) DetectFileType() ValidFileType {
+func (dataFile LocalDataFile) DetectFileType() ValidFileType {
 	return ExtractFileTypeFromFilename(dataFile.filename)
 }
 
 // GetFilename returns the name as it will be stored in Admin.
-func (dataFile SimpleDataFile) GetFilename() string {
+func (dataFile LocalDataFile) GetFilename() string {
 	return dataFile.filename
 }
 
 // GetOriginalFilename returns the same as GetFilename()
-func (dataFile SimpleDataFile) GetOriginalFilename() string {
+func (dataFile LocalDataFile) GetOriginalFilename() string {
+	return dataFile.GetFilename()
+}
+
+// Stat returns the size and modification time of that file.
+func (dataFile LocalDataFile) Stat() (DataFileInfo, error) {
+	fileInfo, err := os.Stat(dataFile.path())
+	if err != nil {
+		return DataFileInfo{}, err
+	}
+	return DataFileInfo{Size: uint64(fileInfo.Size()), ModTime: fileInfo.ModTime()}, nil
+}
+
+// Open opens that file for reading.
+func (dataFile LocalDataFile) Open() (io.ReadCloser, error) {
+	return os.Open(dataFile.path())
+}
+
+func (dataFile LocalDataFile) path() string {
+	return path.Join(dataFile.pathname, dataFile.GetOriginalFilename())
+}
+
+// NewMemoryDataFile returns a MemoryDataFile
+func NewMemoryDataFile(filename string, content []byte, modTime time.Time) DataFile {
+	return MemoryDataFile{filename, content, modTime}
+}
+
+// MemoryDataFile is a DataFile which content is held in memory, e.g. an uploaded file.
+type MemoryDataFile struct {
+	filename string
+	content  []byte
+	modTime  time.Time
+}
+
+// DetectFileType returns the type of that file (e.g. DEBIT).
+func (dataFile MemoryDataFile) DetectFileType() ValidFileType {
+	return ExtractFileTypeFromFilename(dataFile.filename)
+}
+
+// GetFilename returns the name as it will be stored in Admin.
+func (dataFile MemoryDataFile) GetFilename() string {
+	return dataFile.filename
+}
+
+// GetOriginalFilename returns the same as GetFilename()
+func (dataFile MemoryDataFile) GetOriginalFilename() string {
+	return dataFile.GetFilename()
+}
+
+// Stat returns the size of the content of that file, and the modification time provided to NewMemoryDataFile.
+func (dataFile MemoryDataFile) Stat() (DataFileInfo, error) {
+	return DataFileInfo{Size: uint64(len(dataFile.content)), ModTime: dataFile.modTime}, nil
+}
+
+// Open returns a reader of the content of that file.
+func (dataFile MemoryDataFile) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(dataFile.content)), nil
+}
+
+// ObjectStore gives access to remote objects, by key (e.g. "1802/sigfaible_debits.csv").
+type ObjectStore interface {
+	Stat(key string) (DataFileInfo, error)
+	Open(key string) (io.ReadCloser, error)
+}
+
+// NewRemoteDataFile returns a RemoteDataFile, named after the last element of its key.
+func NewRemoteDataFile(store ObjectStore, key string) DataFile {
+	return RemoteDataFile{store, key}
+}
+
+// RemoteDataFile is a DataFile stored as an object of an ObjectStore.
+type RemoteDataFile struct {
+	store ObjectStore
+	key   string
+}
+
+// DetectFileType returns the type of that file (e.g. DEBIT).
+func (dataFile RemoteDataFile) DetectFileType() ValidFileType {
+	return ExtractFileTypeFromFilename(dataFile.GetFilename())
+}
+
+// GetFilename returns the name as it will be stored in Admin.
+func (dataFile RemoteDataFile) GetFilename() string {
+	return path.Base(dataFile.key)
+}
+
+// GetOriginalFilename returns the same as GetFilename()
+func (dataFile RemoteDataFile) GetOriginalFilename() string {
 	return dataFile.GetFilename()
 }
 
-// GetSize returns the size of that file, in bytes.
-func (dataFile SimpleDataFile) GetSize() *uint64 {
-	fi, err := os.Stat(dataFile.pathname + "/" + dataFile.GetOriginalFilename())
+// Stat returns the size and modification time of the remote object.
+func (dataFile RemoteDataFile) Stat() (DataFileInfo, error) {
+	return dataFile.store.Stat(dataFile.key)
+}
+
+// Open returns a reader of the content of the remote object.
+func (dataFile RemoteDataFile) Open() (io.ReadCloser, error) {
+	return dataFile.store.Open(dataFile.key)
+}
+
+// HTTPObjectStore is an ObjectStore which objects are served over HTTP, at BaseURL + "/" + key
+// (each segment of the key being escaped).
+// Their size and modification time are provided by the Content-Length and Last-Modified headers,
+// the modification time being zero when the server does not provide it.
+type HTTPObjectStore struct {
+	BaseURL string
+	Client  *http.Client // http.DefaultClient if nil
+}
+
+// Stat requests the headers of an object.
+func (store HTTPObjectStore) Stat(key string) (DataFileInfo, error) {
+	resp, err := store.client().Head(store.url(key))
+	if err != nil {
+		return DataFileInfo{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return DataFileInfo{}, fmt.Errorf("can't stat %s: %s", key, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return DataFileInfo{}, errors.New("unknown size of " + key)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return DataFileInfo{Size: uint64(resp.ContentLength), ModTime: modTime}, nil
+}
+
+// Open requests the content of an object.
+func (store HTTPObjectStore) Open(key string) (io.ReadCloser, error) {
+	resp, err := store.client().Get(store.url(key))
 	if err != nil {
-		log.Println("Error: can't open file for reading: " + dataFile.GetOriginalFilename())
-		return nil
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("can't open %s: %s", key, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// url escapes each segment of the key, so that e.g. a "#" or a "?" of a file name is not taken for a
+// fragment or a query.
+func (store HTTPObjectStore) url(key string) string {
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(store.BaseURL, "/") + "/" + strings.Join(segments, "/")
+}
+
+func (store HTTPObjectStore) client() *http.Client {
+	if store.Client == nil {
+		return http.DefaultClient
 	}
-	size := uint64(fi.Size())
-	return &size
+	return store.Client
 }
@@ -0,0 +1,120 @@
+package prepareimport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readDataFile(t *testing.T, dataFile DataFile) string {
+	t.Helper()
+	reader, err := dataFile.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestLocalDataFile(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)
+	_ = os.WriteFile(filepath.Join(dir, "sigfaible_debits.csv"), []byte("num_cpte;Siren\n"), 0644)
+	_ = os.Chtimes(filepath.Join(dir, "sigfaible_debits.csv"), modTime, modTime)
+
+	t.Run("provides the type, size, modification time and content of a local file", func(t *testing.T) {
+		dataFile := NewDataFile("sigfaible_debits.csv", dir)
+		assert.Equal(t, debit, dataFile.DetectFileType())
+		info, err := dataFile.Stat()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(15), info.Size)
+		assert.True(t, modTime.Equal(info.ModTime))
+		assert.Equal(t, "num_cpte;Siren\n", readDataFile(t, dataFile))
+	})
+
+	t.Run("returns an error if the file does not exist", func(t *testing.T) {
+		dataFile := NewDataFile("missing.csv", dir)
+		_, err := dataFile.Stat()
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = dataFile.Open()
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestMemoryDataFile(t *testing.T) {
+	modTime := time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)
+	dataFile := NewMemoryDataFile("sigfaible_pcoll.csv.gz", []byte("content"), modTime)
+	assert.Equal(t, procol, dataFile.DetectFileType())
+	info, err := dataFile.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, DataFileInfo{Size: 7, ModTime: modTime}, info)
+	assert.Equal(t, "content", readDataFile(t, dataFile))
+
+	t.Run("provides the gzipped size of detected files", func(t *testing.T) {
+		filesProperty, _, err := PopulateFilesPropertyFromDataFiles([]DataFile{dataFile}, dummyBatchKey)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(7), filesProperty[procol][0].GetGzippedSize())
+	})
+}
+
+func TestRemoteDataFile(t *testing.T) {
+	modTime := time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/batches/1802/sigfaible_debits.csv":
+			http.ServeContent(w, r, "sigfaible_debits.csv", modTime, strings.NewReader("num_cpte;Siren\n"))
+		case "/batches/1802/sigfaible_debits#2 ?.csv":
+			http.ServeContent(w, r, "sigfaible_debits#2 ?.csv", modTime, strings.NewReader("num_cpte;Siren\n"))
+		case "/batches/1802/sigfaible_pcoll.csv":
+			http.ServeContent(w, r, "sigfaible_pcoll.csv", time.Time{}, strings.NewReader("siret\n")) // without Last-Modified header
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	store := HTTPObjectStore{BaseURL: server.URL + "/batches/"}
+
+	t.Run("provides the type, size, modification time and content of a remote object", func(t *testing.T) {
+		dataFile := NewRemoteDataFile(store, "1802/sigfaible_debits.csv")
+		assert.Equal(t, "sigfaible_debits.csv", dataFile.GetFilename())
+		assert.Equal(t, debit, dataFile.DetectFileType())
+		info, err := dataFile.Stat()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(15), info.Size)
+		assert.True(t, modTime.Equal(info.ModTime))
+		assert.Equal(t, "num_cpte;Siren\n", readDataFile(t, dataFile))
+	})
+
+	t.Run("provides a zero modification time if the server does not provide it", func(t *testing.T) {
+		info, err := NewRemoteDataFile(store, "1802/sigfaible_pcoll.csv").Stat()
+		assert.NoError(t, err)
+		assert.Equal(t, DataFileInfo{Size: 6}, info)
+	})
+
+	t.Run("escapes the key of a remote object", func(t *testing.T) {
+		dataFile := NewRemoteDataFile(store, "1802/sigfaible_debits#2 ?.csv")
+		info, err := dataFile.Stat()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(15), info.Size)
+		assert.Equal(t, "num_cpte;Siren\n", readDataFile(t, dataFile))
+	})
+
+	t.Run("returns an error if the object does not exist", func(t *testing.T) {
+		dataFile := NewRemoteDataFile(store, "1802/missing.csv")
+		_, err := dataFile.Stat()
+		assert.ErrorContains(t, err, "can't stat 1802/missing.csv: 404 Not Found")
+		_, err = dataFile.Open()
+		assert.ErrorContains(t, err, "can't open 1802/missing.csv: 404 Not Found")
+	})
+}
@@ -2,7 +2,6 @@ package prepareimport
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -10,18 +9,38 @@ import (
 )
 
 // PopulateFilesProperty populates the "files" property of an Admin object, given a path.
-func PopulateFilesProperty(pathname string, batchKey BatchKey) (FilesProperty, []string) {
-	batchPath := path.Join(pathname, batchKey.String())
-	filenames, _ := ReadFilenames(batchPath)
+func PopulateFilesProperty(pathname string, batchKey BatchKey) (FilesProperty, []string, error) {
+	batchDir := BatchDir(pathname, batchKey)
+	overrides, err := ReadBatchOverrides(batchDir)
+	if err != nil {
+		println("Warning: " + err.Error())
+	}
+	return PopulateFilesPropertyFromDataFiles(listDataFiles(batchDir, overrides), batchKey)
+}
+
+// listDataFiles returns the files of a batch directory, after applying its overrides.
+// The links to canonical names listed in the manifest of the batch are skipped.
+func listDataFiles(batchDir string, overrides BatchOverrides) []DataFile {
+	filenames, err := ReadFilenames(batchDir)
+	if err != nil {
+		println("Warning: " + err.Error())
+	}
+	canonicalNames, err := ReadCanonicalNames(batchDir)
+	if err != nil {
+		println("Warning: " + err.Error())
+	}
 	var augmentedFiles []DataFile
 	for _, file := range filenames {
-		augmentedFiles = append(augmentedFiles, NewDataFile(file, batchPath))
+		if originalName, isLink := canonicalNames[file]; !isLink || originalName == file {
+			augmentedFiles = append(augmentedFiles, NewDataFile(file, batchDir))
+		}
 	}
-	return PopulateFilesPropertyFromDataFiles(augmentedFiles, batchKey)
+	return overrides.apply(augmentedFiles)
 }
 
 // PopulateFilesPropertyFromDataFiles populates the "files" property of an Admin object, given a list of Data files.
-func PopulateFilesPropertyFromDataFiles(filenames []DataFile, batchKey BatchKey) (FilesProperty, []string) {
+// An error is returned if the size of a gzipped file can't be determined.
+func PopulateFilesPropertyFromDataFiles(filenames []DataFile, batchKey BatchKey) (FilesProperty, []string, error) {
 	filesProperty := FilesProperty{}
 	unsupportedFiles := []string{}
 	for _, filename := range filenames {
@@ -33,28 +52,37 @@ func PopulateFilesPropertyFromDataFiles(filenames []DataFile, batchKey BatchKey)
 		if _, exists := filesProperty[filetype]; !exists {
 			filesProperty[filetype] = []BatchFile{}
 		}
-		batchFileToAdd := newBatchFile(batchKey, filename.GetFilename())
-		if strings.HasSuffix(filename.GetOriginalFilename(), ".gz") {
-			size := filename.GetSize()
-			if size == nil {
-				panic(errors.New("file size could not be found for: " + batchFileToAdd.Name()))
+		batchFileToAdd := newDataBatchFile(batchKey, filename)
+		if isGzipped(filename) {
+			info, err := filename.Stat()
+			if err != nil {
+				return nil, nil, fmt.Errorf("file size could not be found for %s: %w", batchFileToAdd.Name(), err)
 			}
-			batchFileToAdd.AddGzippedSize(*size)
+			batchFileToAdd.AddGzippedSize(info.Size)
 		}
 		filesProperty[filetype] = append(filesProperty[filetype], batchFileToAdd)
 	}
-	return filesProperty, unsupportedFiles
+	return filesProperty, unsupportedFiles, nil
+}
+
+func isGzipped(dataFile DataFile) bool {
+	return strings.HasSuffix(dataFile.GetOriginalFilename(), ".gz")
 }
 
-// ReadFilenames returns the name of files found at the provided path.
-func ReadFilenames(path string) ([]string, error) {
+// ReadFilenames returns the name of files found at the provided path,
+// except the ones that are ignored by default or by .prepareignore files.
+func ReadFilenames(dirPath string) ([]string, error) {
 	var files []string
-	fileInfo, err := os.ReadDir(path)
+	fileInfo, err := os.ReadDir(dirPath)
+	if err != nil {
+		return files, err
+	}
+	ignoreList, err := ReadIgnoreList(dirPath)
 	if err != nil {
 		return files, err
 	}
 	for _, file := range fileInfo {
-		if !file.IsDir() {
+		if !file.IsDir() && !ignoreList.IsIgnored(path.Join(dirPath, file.Name())) {
 			files = append(files, file.Name())
 		}
 	}
@@ -79,6 +107,14 @@ func (fp FilesProperty) GetSireneULFile() (BatchFile, error) {
 	return fp[sireneUl][0], nil
 }
 
+// GetSireneFile returns the StockEtablissement ("sirene") file.
+func (fp FilesProperty) GetSireneFile() (BatchFile, error) {
+	if fp[sirene] == nil || len(fp[sirene]) != 1 {
+		return nil, fmt.Errorf("batch requires just 1 sirene file, found %s", fp[sirene])
+	}
+	return fp[sirene][0], nil
+}
+
 // GetEffectifFile returns the effectif file.
 func (fp FilesProperty) GetEffectifFile() (BatchFile, error) {
 	if fp["effectif"] == nil || len(fp["effectif"]) != 1 {
@@ -87,6 +123,14 @@ func (fp FilesProperty) GetEffectifFile() (BatchFile, error) {
 	return fp["effectif"][0], nil
 }
 
+// GetEffectifEntFile returns the effectif_ent file.
+func (fp FilesProperty) GetEffectifEntFile() (BatchFile, error) {
+	if fp[effectifEnt] == nil || len(fp[effectifEnt]) != 1 {
+		return nil, fmt.Errorf("batch requires just 1 effectif_ent file, found: %s", fp[effectifEnt])
+	}
+	return fp[effectifEnt][0], nil
+}
+
 // BatchFile represents a file that is listed in a FilesProperty entry.
 type BatchFile interface {
 	BatchKey() BatchKey
@@ -95,6 +139,7 @@ type BatchFile interface {
 	AbsolutePath(parentDir string) string
 	GetGzippedSize() uint64     // in bytes
 	AddGzippedSize(size uint64) // in bytes
+	DataFile() DataFile         // gives access to the content of the file, wherever it is stored
 }
 
 func newBatchFile(batchKey BatchKey, filename string) BatchFile {
@@ -104,10 +149,20 @@ func newBatchFile(batchKey BatchKey, filename string) BatchFile {
 	}
 }
 
+// newDataBatchFile returns a BatchFile which content is read from dataFile.
+func newDataBatchFile(batchKey BatchKey, dataFile DataFile) BatchFile {
+	return &batchFile{
+		batchKey: batchKey,
+		filename: dataFile.GetFilename(),
+		dataFile: dataFile,
+	}
+}
+
 type batchFile struct {
 	batchKey    BatchKey
 	filename    string
-	gzippedSize uint64 // in bytes
+	gzippedSize uint64   // in bytes
+	dataFile    DataFile // nil if the file was not listed from a DataFile
 }
 
 func (file *batchFile) BatchKey() BatchKey {
@@ -118,18 +173,22 @@ func (file *batchFile) Name() string {
 	return file.filename
 }
 
-// Path retourne le chemin relatif du fichier, avec un préfixe "gzip:" si celui-ci est compressé.
+// Path retourne le chemin relatif du fichier, tel que stocké dans Admin, avec un préfixe "gzip:" si celui-ci est compressé.
 func (file *batchFile) Path() string {
-	return file.AbsolutePath("")
+	return file.gzipPrefix() + path.Join(file.batchKey.Path(), file.filename)
 }
 
-// AbsolutePath retourne le chemin absolu du fichier, avec un préfixe "gzip:" si celui-ci est compressé.
+// AbsolutePath retourne le chemin absolu du fichier, dans le répertoire de son batch (cf BatchDir),
+// avec un préfixe "gzip:" si celui-ci est compressé.
 func (file *batchFile) AbsolutePath(parentDir string) string {
-	var prefix string
+	return file.gzipPrefix() + path.Join(BatchDir(parentDir, file.batchKey), file.filename)
+}
+
+func (file *batchFile) gzipPrefix() string {
 	if file.gzippedSize > 0 {
-		prefix = "gzip:"
+		return "gzip:"
 	}
-	return prefix + path.Join(parentDir, file.batchKey.Path(), file.filename)
+	return ""
 }
 
 func (file *batchFile) AddGzippedSize(size uint64) {
@@ -140,6 +199,10 @@ func (file *batchFile) GetGzippedSize() uint64 {
 	return file.gzippedSize
 }
 
+func (file *batchFile) DataFile() DataFile {
+	return file.dataFile
+}
+
 // MarshalJSON will be called when serializing the AdminObject.
 func (file *batchFile) MarshalJSON() ([]byte, error) {
 	return json.Marshal(file.Path())
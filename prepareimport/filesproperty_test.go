@@ -8,31 +8,36 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// listedBatchFile returns the BatchFile of a LocalDataFile listed in the current directory.
+func listedBatchFile(filename string) BatchFile {
+	return newDataBatchFile(dummyBatchKey, LocalDataFile{filename, ""})
+}
+
 func TestPopulateFilesProperty(t *testing.T) {
 	t.Run("Should return an empty json when there is no file", func(t *testing.T) {
-		filesProperty, unsupportedFiles := PopulateFilesPropertyFromDataFiles([]DataFile{}, dummyBatchKey)
+		filesProperty, unsupportedFiles, _ := PopulateFilesPropertyFromDataFiles([]DataFile{}, dummyBatchKey)
 		assert.Len(t, unsupportedFiles, 0)
 		assert.Equal(t, FilesProperty{}, filesProperty)
 	})
 
 	t.Run("PopulateFilesProperty should contain effectif file in \"effectif\" property", func(t *testing.T) {
-		filesProperty, unsupportedFiles := PopulateFilesPropertyFromDataFiles([]DataFile{SimpleDataFile{"sigfaibles_effectif_siret.csv", ""}}, dummyBatchKey)
+		filesProperty, unsupportedFiles, _ := PopulateFilesPropertyFromDataFiles([]DataFile{LocalDataFile{"sigfaibles_effectif_siret.csv", ""}}, dummyBatchKey)
 		if assert.Len(t, unsupportedFiles, 0) {
-			assert.Equal(t, []BatchFile{dummyBatchFile("sigfaibles_effectif_siret.csv")}, filesProperty[effectif])
+			assert.Equal(t, []BatchFile{listedBatchFile("sigfaibles_effectif_siret.csv")}, filesProperty[effectif])
 		}
 	})
 
 	t.Run("PopulateFilesProperty should contain one debit file in \"debit\" property", func(t *testing.T) {
-		filesProperty, unsupportedFiles := PopulateFilesPropertyFromDataFiles([]DataFile{SimpleDataFile{"sigfaibles_debits.csv", ""}}, dummyBatchKey)
-		expected := FilesProperty{debit: {dummyBatchFile("sigfaibles_debits.csv")}}
+		filesProperty, unsupportedFiles, _ := PopulateFilesPropertyFromDataFiles([]DataFile{LocalDataFile{"sigfaibles_debits.csv", ""}}, dummyBatchKey)
+		expected := FilesProperty{debit: {listedBatchFile("sigfaibles_debits.csv")}}
 		assert.Len(t, unsupportedFiles, 0)
 		assert.Equal(t, expected, filesProperty)
 	})
 
 	t.Run("PopulateFilesProperty should contain both debits files in \"debit\" property", func(t *testing.T) {
-		filesProperty, unsupportedFiles := PopulateFilesPropertyFromDataFiles([]DataFile{SimpleDataFile{"sigfaibles_debits.csv", ""}, SimpleDataFile{"sigfaibles_debits2.csv", ""}}, dummyBatchKey)
+		filesProperty, unsupportedFiles, _ := PopulateFilesPropertyFromDataFiles([]DataFile{LocalDataFile{"sigfaibles_debits.csv", ""}, LocalDataFile{"sigfaibles_debits2.csv", ""}}, dummyBatchKey)
 		if assert.Len(t, unsupportedFiles, 0) {
-			assert.Equal(t, []BatchFile{dummyBatchFile("sigfaibles_debits.csv"), dummyBatchFile("sigfaibles_debits2.csv")}, filesProperty[debit])
+			assert.Equal(t, []BatchFile{listedBatchFile("sigfaibles_debits.csv"), listedBatchFile("sigfaibles_debits2.csv")}, filesProperty[debit])
 		}
 	})
 
@@ -52,32 +57,37 @@ func TestPopulateFilesProperty(t *testing.T) {
 		expectedFiles := FilesProperty{}
 		inputFiles := []DataFile{}
 		for _, file := range files {
-			expectedFiles[file.Type] = append(expectedFiles[file.Type], dummyBatchFile(file.Filename))
-			inputFiles = append(inputFiles, SimpleDataFile{file.Filename, ""})
+			expectedFiles[file.Type] = append(expectedFiles[file.Type], listedBatchFile(file.Filename))
+			inputFiles = append(inputFiles, LocalDataFile{file.Filename, ""})
 		}
-		resFilesProperty, unsupportedFiles := PopulateFilesPropertyFromDataFiles(inputFiles, dummyBatchKey)
+		resFilesProperty, unsupportedFiles, _ := PopulateFilesPropertyFromDataFiles(inputFiles, dummyBatchKey)
 		assert.Len(t, unsupportedFiles, 0)
 		assert.Equal(t, expectedFiles, resFilesProperty)
 	})
 
 	t.Run("Should not include unsupported files", func(t *testing.T) {
-		filesProperty, unsupportedFiles := PopulateFilesPropertyFromDataFiles([]DataFile{SimpleDataFile{"coco.csv", ""}}, dummyBatchKey)
+		filesProperty, unsupportedFiles, _ := PopulateFilesPropertyFromDataFiles([]DataFile{LocalDataFile{"coco.csv", ""}}, dummyBatchKey)
 		assert.Len(t, unsupportedFiles, 1)
 		assert.Equal(t, FilesProperty{}, filesProperty)
 	})
 
 	t.Run("Should report unsupported files", func(t *testing.T) {
-		_, unsupportedFiles := PopulateFilesPropertyFromDataFiles([]DataFile{SimpleDataFile{"coco.csv", ""}}, dummyBatchKey)
+		_, unsupportedFiles, _ := PopulateFilesPropertyFromDataFiles([]DataFile{LocalDataFile{"coco.csv", ""}}, dummyBatchKey)
 		assert.Equal(t, []string{dummyBatchKey.Path() + "coco.csv"}, unsupportedFiles)
 	})
 
+	t.Run("Should return an error if the size of a compressed file can't be found", func(t *testing.T) {
+		_, _, err := PopulateFilesPropertyFromDataFiles([]DataFile{LocalDataFile{"sigfaibles_debits.csv.gz", t.TempDir()}}, dummyBatchKey)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
 	t.Run("Should skip subdirectories", func(t *testing.T) {
 		subBatch := newSafeBatchKey("1803_01")
 		parentBatch := subBatch.GetParentBatch()
 		parentDir := CreateTempFiles(t, newSafeBatchKey(parentBatch), []string{})
 		subBatchDir := filepath.Join(parentDir, parentBatch, subBatch.String())
 		_ = os.Mkdir(subBatchDir, 0777)
-		parentFilesProperty, unsupportedFiles := PopulateFilesProperty(parentDir, newSafeBatchKey(parentBatch))
+		parentFilesProperty, unsupportedFiles, _ := PopulateFilesProperty(parentDir, newSafeBatchKey(parentBatch))
 		assert.Equal(t, []string{}, unsupportedFiles)
 		assert.Equal(t, FilesProperty{}, parentFilesProperty)
 	})
@@ -90,7 +100,7 @@ func TestPopulateFilesProperty(t *testing.T) {
 		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
 			"sigfaibles_debits.csv.gz": bytes,
 		})
-		resFilesProperty, _ := PopulateFilesProperty(dir, dummyBatchKey)
+		resFilesProperty, _, _ := PopulateFilesProperty(dir, dummyBatchKey)
 		assert.Len(t, resFilesProperty["debit"], 1)
 		actualFilePath := resFilesProperty["debit"][0].Path() // cf batchFile.MarshalJSON()
 		assert.Equal(t, "gzip:/1802/sigfaibles_debits.csv.gz", actualFilePath)
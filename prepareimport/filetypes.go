@@ -1,7 +1,9 @@
 package prepareimport
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 )
 
 // ExtractFileTypeFromFilename returns a file type from filename, or empty string for unsupported file names
@@ -24,7 +26,7 @@ func ExtractFileTypeFromFilename(filename string) ValidFileType {
 		return delai
 	case possiblyGzFilename == "sigfaible_ccsf.csv":
 		return ccsf
-	case filename == "sireneUL.csv":
+	case possiblyGzFilename == "sireneUL.csv":
 		return sireneUl
 	case filename == "StockEtablissement_utf8_geo.csv":
 		return sirene
@@ -70,6 +72,53 @@ const (
 // ValidFileType is the type used by all constants like ADMIN_URSSAF, APCONSO, etc...
 type ValidFileType string
 
+// allFileTypes lists the supported types, in alphabetical order.
+var allFileTypes = []ValidFileType{
+	adminUrssaf,
+	apconso,
+	apdemande,
+	bdf,
+	ccsf,
+	cotisation,
+	debit,
+	delai,
+	diane,
+	effectif,
+	effectifEnt,
+	ellisphere,
+	filter,
+	paydex,
+	procol,
+	sirene,
+	sireneUl,
+}
+
+// ParseValidFileType returns the supported type named fileType.
+func ParseValidFileType(fileType string) (ValidFileType, error) {
+	for _, validFileType := range allFileTypes {
+		if string(validFileType) == fileType {
+			return validFileType, nil
+		}
+	}
+	return "", fmt.Errorf("type de fichier inconnu : %s", fileType)
+}
+
+// ParseValidFileTypes parses a comma-separated list of types, e.g. "effectif,debit".
+func ParseValidFileTypes(fileTypes string) ([]ValidFileType, error) {
+	validFileTypes := []ValidFileType{}
+	for _, fileType := range strings.Split(fileTypes, ",") {
+		if fileType = strings.TrimSpace(fileType); fileType == "" {
+			continue
+		}
+		validFileType, err := ParseValidFileType(fileType)
+		if err != nil {
+			return nil, err
+		}
+		validFileTypes = append(validFileTypes, validFileType)
+	}
+	return validFileTypes, nil
+}
+
 var hasDianePrefix = regexp.MustCompile(`^[Dd]iane`)
 var mentionsEffectif = regexp.MustCompile(`effectif_`)
 var mentionsDebits = regexp.MustCompile(`_debits`)
@@ -46,6 +46,7 @@ func TestExtractFileTypeFromFilename(t *testing.T) {
 		{"effectif_dom.csv", effectif},
 		{"filter_siren_2002.csv", filter},
 		{"sireneUL.csv", sireneUl},
+		{"sireneUL.csv.gz", sireneUl},
 		{"StockEtablissement_utf8_geo.csv", sirene},
 		{"StockEtablissement_utf8_geo.csv", sirene},
 		{"E_202011095813_Retro-Paydex_20201207.csv", paydex},
@@ -59,3 +60,17 @@ func TestExtractFileTypeFromFilename(t *testing.T) {
 		})
 	}
 }
+
+func TestParseValidFileTypes(t *testing.T) {
+	t.Run("should parse a list of types", func(t *testing.T) {
+		fileTypes, err := ParseValidFileTypes("effectif, debit,,sirene_ul")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []ValidFileType{effectif, debit, sireneUl}, fileTypes)
+		}
+	})
+
+	t.Run("should fail on an unknown type", func(t *testing.T) {
+		_, err := ParseValidFileTypes("effectif,debits")
+		assert.EqualError(t, err, "type de fichier inconnu : debits")
+	})
+}
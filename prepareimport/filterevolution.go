@@ -0,0 +1,81 @@
+package prepareimport
+
+import (
+	"errors"
+	"strings"
+
+	"prepare-import/createfilter"
+)
+
+// ExplainFilterEvolution lists the companies which entered or left the perimeter of the filter between
+// a previous batch and a batch, with the reason of each change. The perimeter of each batch is evaluated
+// like PrepareImport generates its filter, with the same options, from the files of the batch (or of its
+// parent batch). When a batch already has a filter, its sirens are compared instead of the evaluated ones,
+// and the changes which are not explained by the evaluation are reported as such. When such a batch has
+// no effectif (nor effectif_ent) file, the changes explained by its perimeter are all reported as such.
+func ExplainFilterEvolution(pathname string, previousKey BatchKey, batchKey BatchKey, opts ...Option) (createfilter.FilterChanges, error) {
+	options := newOptions(opts)
+	previousOptions := options
+	previousOptions.params = ParamOptions{} // the parameters only apply to batchKey, e.g. its date_fin
+	println("Evaluating the filter of batch " + previousKey.String() + " ...")
+	previous, err := evaluateBatchFilter(pathname, previousKey, previousOptions)
+	if err != nil {
+		return nil, err
+	}
+	println("Evaluating the filter of batch " + batchKey.String() + " ...")
+	current, err := evaluateBatchFilter(pathname, batchKey, options)
+	if err != nil {
+		return nil, err
+	}
+	return createfilter.CompareFilterEvaluations(previous, current), nil
+}
+
+// evaluateBatchFilter evaluates the perimeter of the filter of a batch, and replaces it by the content of
+// the filter of the batch, if any.
+func evaluateBatchFilter(pathname string, batchKey BatchKey, options options) (createfilter.FilterEvaluation, error) {
+	filesProperty, _, err := PopulateFilesProperty(pathname, batchKey)
+	if err != nil {
+		return createfilter.FilterEvaluation{}, err
+	}
+	inputs, err := findFilterInputs(pathname, batchKey, filesProperty)
+	if err != nil {
+		return createfilter.FilterEvaluation{}, err
+	}
+	if inputs.filterFile != nil && inputs.effectifFile == nil && inputs.effectifEntFile == nil {
+		println("Warning: no effectif file found, the perimeter of batch " + batchKey.String() + " can't be evaluated")
+		perimeter, err := readFilterSirens(pathname, inputs.filterFile)
+		return createfilter.FilterEvaluation{Perimeter: perimeter, Unevaluated: true}, err
+	}
+	generation, err := planFilterGeneration(pathname, batchKey, options, filesProperty, inputs)
+	if err != nil {
+		return createfilter.FilterEvaluation{}, err
+	}
+	evaluation, err := createfilter.EvaluateFilter(
+		generation.sourceFile.AbsolutePath(pathname),
+		createfilter.DefaultNbMois,
+		createfilter.DefaultMinEffectif,
+		generation.perimeterMode,
+		options.rejectInvalidSirets,
+		generation.rules,
+		withAbsolutePaths(pathname, generation.composition),
+	)
+	if err != nil {
+		return createfilter.FilterEvaluation{}, err
+	}
+	if inputs.filterFile != nil {
+		if evaluation.Perimeter, err = readFilterSirens(pathname, inputs.filterFile); err != nil {
+			return createfilter.FilterEvaluation{}, err
+		}
+	}
+	return evaluation, nil
+}
+
+// readFilterSirens reads the sirens of the filter file of a batch.
+func readFilterSirens(pathname string, filterFile BatchFile) (map[string]struct{}, error) {
+	filterPath := filterFile.AbsolutePath(pathname)
+	if strings.HasPrefix(filterPath, "gzip:") {
+		return nil, errors.New("compressed filter files are not supported: " + filterPath)
+	}
+	println("Using the sirens of the filter file: " + filterFile.Name())
+	return createfilter.ReadSirenList(filterPath)
+}
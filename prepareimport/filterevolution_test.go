@@ -0,0 +1,72 @@
+package prepareimport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"prepare-import/createfilter"
+)
+
+func TestExplainFilterEvolution(t *testing.T) {
+	previousBatch := newSafeBatchKey("1801")
+	setup := func(t *testing.T, previousFiles map[string][]byte) string {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;4\n22222222200017;12\n44444444400013;12\n"),
+			"sireneUL.csv":                 ReadFileData(t, "../createfilter/test_uniteLegale.csv"),
+			"perimeter_include.csv":        []byte("siren\n555555555\n"),
+		})
+		writeBatchFiles(t, dir, previousBatch, previousFiles)
+		return dir
+	}
+
+	t.Run("Should explain the changes between the evaluated perimeters of both batches", func(t *testing.T) {
+		dir := setup(t, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n22222222200017;12\n44444444400013;4\n"),
+		})
+		changes, err := ExplainFilterEvolution(dir, previousBatch, dummyBatchKey)
+		if assert.NoError(t, err) {
+			assert.Equal(t, createfilter.FilterChanges{
+				{Siren: "111111111", Evolution: createfilter.Left, Reason: createfilter.ReasonEffectifSousSeuil},
+				{Siren: "222222222", Evolution: createfilter.Left, Reason: createfilter.RuleCategorieJuridique},
+				{Siren: "444444444", Evolution: createfilter.Entered, Reason: createfilter.ReasonEffectifSousSeuil},
+				{Siren: "555555555", Evolution: createfilter.Entered, Reason: createfilter.ReasonComposition},
+			}, changes)
+		}
+	})
+
+	t.Run("Should compare the sirens of the filter of a batch, if any", func(t *testing.T) {
+		dir := setup(t, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n22222222200017;12\n44444444400013;4\n"),
+			"filter_siren_1801.csv":        []byte("siren\n111111111\n333333333\n"),
+		})
+		changes, err := ExplainFilterEvolution(dir, previousBatch, dummyBatchKey)
+		if assert.NoError(t, err) {
+			assert.Equal(t, createfilter.FilterChanges{
+				{Siren: "111111111", Evolution: createfilter.Left, Reason: createfilter.ReasonEffectifSousSeuil},
+				{Siren: "333333333", Evolution: createfilter.Left, Reason: createfilter.ReasonAbsentEffectif},
+				{Siren: "444444444", Evolution: createfilter.Entered, Reason: createfilter.ReasonEffectifSousSeuil},
+				{Siren: "555555555", Evolution: createfilter.Entered, Reason: createfilter.ReasonComposition},
+			}, changes)
+		}
+	})
+
+	t.Run("Should report the changes as unexplained if a batch has a filter but no effectif file", func(t *testing.T) {
+		dir := setup(t, map[string][]byte{"filter_siren_1801.csv": []byte("siren\n111111111\n333333333\n")})
+		changes, err := ExplainFilterEvolution(dir, previousBatch, dummyBatchKey)
+		if assert.NoError(t, err) {
+			assert.Equal(t, createfilter.FilterChanges{
+				{Siren: "111111111", Evolution: createfilter.Left, Reason: createfilter.ReasonEffectifSousSeuil},
+				{Siren: "333333333", Evolution: createfilter.Left, Reason: createfilter.ReasonAbsentEffectif},
+				{Siren: "444444444", Evolution: createfilter.Entered, Reason: createfilter.ReasonInexpliquee},
+				{Siren: "555555555", Evolution: createfilter.Entered, Reason: createfilter.ReasonComposition},
+			}, changes)
+		}
+	})
+
+	t.Run("Should fail if the perimeter of a batch can't be evaluated", func(t *testing.T) {
+		dir := setup(t, map[string][]byte{"other.csv": []byte("siren\n111111111\n")})
+		_, err := ExplainFilterEvolution(dir, previousBatch, dummyBatchKey)
+		assert.ErrorContains(t, err, "batch should include a filter, or one effectif or effectif_ent file")
+	})
+}
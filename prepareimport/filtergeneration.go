@@ -0,0 +1,106 @@
+package prepareimport
+
+import (
+	"errors"
+
+	"prepare-import/createfilter"
+)
+
+// filterInputs are the files of a batch, or of its parent batch, which provide or generate its filter.
+type filterInputs struct {
+	effectifFile    BatchFile
+	effectifEntFile BatchFile
+	filterFile      BatchFile
+	sireneULFile    BatchFile
+}
+
+// findFilterInputs looks up the files which provide or generate the filter of a batch.
+// Files which are missing from a sub-batch are looked up in its parent batch.
+func findFilterInputs(pathname string, batchKey BatchKey, filesProperty FilesProperty) (filterInputs, error) {
+	var inputs filterInputs
+	inputs.effectifFile, _ = filesProperty.GetEffectifFile()
+	inputs.effectifEntFile, _ = filesProperty.GetEffectifEntFile()
+	inputs.filterFile, _ = filesProperty.GetFilterFile()
+	inputs.sireneULFile, _ = filesProperty.GetSireneULFile()
+	if (inputs.effectifFile == nil || inputs.filterFile == nil || inputs.sireneULFile == nil) && batchKey.IsSubBatch() {
+		println("Looking for effectif, effectif_ent, filter and/or sireneUL file in " + batchKey.GetParentBatch() + " ...")
+		parentFilesProperty, _, err := PopulateFilesProperty(pathname, batchKey.Parent())
+		if err != nil {
+			return inputs, err
+		}
+		if inputs.effectifFile == nil {
+			inputs.effectifFile, _ = parentFilesProperty.GetEffectifFile()
+		}
+		if inputs.effectifEntFile == nil {
+			inputs.effectifEntFile, _ = parentFilesProperty.GetEffectifEntFile()
+		}
+		if inputs.filterFile == nil {
+			inputs.filterFile, _ = parentFilesProperty.GetFilterFile()
+		}
+		if inputs.sireneULFile == nil {
+			inputs.sireneULFile, _ = parentFilesProperty.GetSireneULFile()
+		}
+	}
+	return inputs, nil
+}
+
+// withExpectedFilter returns the files of a batch, including the filter that will be provided by its parent batch
+// or generated from an effectif (or effectif_ent) file, if any.
+func withExpectedFilter(batchKey BatchKey, filesProperty FilesProperty, inputs filterInputs) FilesProperty {
+	if len(filesProperty[filter]) > 0 {
+		return filesProperty
+	}
+	expectedFilter := inputs.filterFile
+	if expectedFilter == nil && (inputs.effectifFile != nil || inputs.effectifEntFile != nil) {
+		expectedFilter = newBatchFile(batchKey, "filter_siren_"+batchKey.String()+".csv")
+	}
+	if expectedFilter == nil {
+		return filesProperty
+	}
+	expected := FilesProperty{filter: {expectedFilter}}
+	for fileType, files := range filesProperty {
+		if fileType != filter {
+			expected[fileType] = files
+		}
+	}
+	return expected
+}
+
+// filterGeneration describes how the filter of a batch is generated.
+type filterGeneration struct {
+	perimeterMode createfilter.PerimeterMode
+	sourceFile    BatchFile // the effectif file, or the effectif_ent file in the FromEffectifEnt mode
+	rules         createfilter.SireneRules
+	composition   []createfilter.CompositionStep // the files of the steps are relative to pathname
+}
+
+// planFilterGeneration selects the perimeter mode, the source file, the Sirene rules and the composition
+// steps from which the filter of a batch is generated.
+func planFilterGeneration(pathname string, batchKey BatchKey, options options, filesProperty FilesProperty, inputs filterInputs) (filterGeneration, error) {
+	generation := filterGeneration{perimeterMode: options.perimeterMode, sourceFile: inputs.effectifFile}
+	if generation.perimeterMode != createfilter.FromEffectifEnt && inputs.effectifFile == nil && inputs.effectifEntFile != nil {
+		println("Info: no effectif file found, the filter will be generated from the effectif_ent file: " + inputs.effectifEntFile.Name())
+		generation.perimeterMode = createfilter.FromEffectifEnt
+	}
+	if generation.perimeterMode == createfilter.FromEffectifEnt {
+		generation.sourceFile = inputs.effectifEntFile
+	}
+	if generation.sourceFile == nil && generation.perimeterMode == createfilter.FromEffectifEnt {
+		return filterGeneration{}, errors.New("filter is missing: batch should include a filter or one effectif_ent file")
+	} else if generation.sourceFile == nil {
+		return filterGeneration{}, errors.New("filter is missing: batch should include a filter, or one effectif or effectif_ent file")
+	}
+	if inputs.sireneULFile == nil && options.requireSireneUL {
+		return filterGeneration{}, errors.New("sireneUL is missing: batch should include a sireneUL file to generate the filter")
+	} else if inputs.sireneULFile == nil {
+		println("Warning: no sireneUL file found, the filter will include companies regardless of their categorie juridique, activity and state")
+	}
+	var err error
+	if generation.rules, err = options.sireneRules.resolve(pathname, batchKey, options.params, filesProperty, inputs.sireneULFile, options.sireneULCacheDir); err != nil {
+		return filterGeneration{}, err
+	}
+	if generation.composition, err = findCompositionSteps(pathname, generation.sourceFile.BatchKey()); err != nil {
+		return filterGeneration{}, err
+	}
+	return generation, nil
+}
@@ -0,0 +1,148 @@
+package prepareimport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"prepare-import/siret"
+)
+
+// types of files which identifiers are validated, and the name of their identifier columns
+var identifierColumns = map[ValidFileType][]string{
+	adminUrssaf: {"siret"},
+	apconso:     {"siret"},
+	apdemande:   {"siret"},
+	effectif:    {"siret"},
+	effectifEnt: {"siren"},
+	filter:      {"siren"},
+	sirene:      {"siret"},
+	sireneUl:    {"siren"},
+}
+
+// IdentifiersCount reports the number of invalid SIREN or SIRET identifiers found in a file.
+type IdentifiersCount struct {
+	Column          string `json:"column"`
+	Total           int    `json:"total"`
+	Malformed       int    `json:"malformed"`
+	InvalidChecksum int    `json:"invalid_checksum"`
+}
+
+// Invalid returns the number of invalid identifiers.
+func (count IdentifiersCount) Invalid() int {
+	return count.Malformed + count.InvalidChecksum
+}
+
+// IdentifiersReport lists the counts of invalid identifiers, by file path.
+type IdentifiersReport map[string]IdentifiersCount
+
+// InvalidIdentifiersError is returned when files contain invalid identifiers, and they must be rejected.
+type InvalidIdentifiersError struct {
+	Report IdentifiersReport
+}
+
+func (err InvalidIdentifiersError) Error() string {
+	messages := []string{}
+	for _, filePath := range err.Report.sortedFilePaths() {
+		if count := err.Report[filePath]; count.Invalid() > 0 {
+			messages = append(messages, fmt.Sprintf("%s (%d)", filePath, count.Invalid()))
+		}
+	}
+	return "identifiants siren/siret invalides : " + strings.Join(messages, ", ")
+}
+
+// CountInvalidIdentifiers counts the invalid identifiers of a file, from its siret or siren column.
+func CountInvalidIdentifiers(dataFile DataFile, columnCandidates []string) (IdentifiersCount, error) {
+	r, f, err := openCsvFile(dataFile)
+	if err != nil {
+		return IdentifiersCount{}, err
+	}
+	defer f.Close()
+	header, err := r.Read()
+	if err != nil {
+		return IdentifiersCount{}, err
+	}
+	col := findColumn(header, columnCandidates)
+	if col < 0 {
+		return IdentifiersCount{}, errors.New("no identifier column found, expected: " + strings.Join(columnCandidates, ", "))
+	}
+	count := IdentifiersCount{Column: strings.ToLower(strings.TrimSpace(header[col]))}
+	check := siret.CheckSiret
+	if count.Column == "siren" {
+		check = siret.CheckSiren
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return count, err
+		}
+		if col >= len(record) {
+			continue
+		}
+		count.Total++
+		switch check(strings.TrimSpace(record[col])) {
+		case siret.ErrFormat:
+			count.Malformed++
+		case siret.ErrChecksum:
+			count.InvalidChecksum++
+		}
+	}
+	return count, nil
+}
+
+// validateIdentifiers counts the invalid identifiers of the files of the batch.
+// Files that can't be read are reported as a warning.
+func validateIdentifiers(filesProperty FilesProperty) IdentifiersReport {
+	report := IdentifiersReport{}
+	for _, fileType := range allFileTypes {
+		columnCandidates, ok := identifierColumns[fileType]
+		if !ok {
+			continue
+		}
+		for _, file := range filesProperty[fileType] {
+			println("Validating identifiers of " + file.Name() + " ...")
+			count, err := CountInvalidIdentifiers(file.DataFile(), columnCandidates)
+			if err != nil {
+				println(fmt.Sprintf("Warning: could not validate identifiers of %s: %v", file.Name(), err))
+				continue
+			}
+			report[file.Path()] = count
+		}
+	}
+	return report
+}
+
+// HasInvalid tells whether at least one file contains invalid identifiers.
+func (report IdentifiersReport) HasInvalid() bool {
+	for _, count := range report {
+		if count.Invalid() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Print prints the number of invalid identifiers of each file.
+func (report IdentifiersReport) Print() {
+	for _, filePath := range report.sortedFilePaths() {
+		count := report[filePath]
+		if count.Invalid() == 0 {
+			continue
+		}
+		println(fmt.Sprintf("Warning: %s: %d invalid %s out of %d (%d malformed, %d with an invalid key)",
+			filePath, count.Invalid(), count.Column, count.Total, count.Malformed, count.InvalidChecksum))
+	}
+}
+
+func (report IdentifiersReport) sortedFilePaths() []string {
+	filePaths := make([]string, 0, len(report))
+	for filePath := range report {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+	return filePaths
+}
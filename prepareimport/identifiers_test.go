@@ -0,0 +1,48 @@
+package prepareimport
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountInvalidIdentifiers(t *testing.T) {
+	dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+		"sigfaible_effectif_siret.csv": []byte("compte;siret;rais_soc\n1;73282932000074;A\n2;7328293200007A;B\n3;73282932000075;C\n4;35600000012341;D\n"),
+	})
+	count, err := CountInvalidIdentifiers(NewDataFile("sigfaible_effectif_siret.csv", path.Join(dir, dummyBatchKey.String())), identifierColumns[effectif])
+	if assert.NoError(t, err) {
+		assert.Equal(t, IdentifiersCount{Column: "siret", Total: 4, Malformed: 1, InvalidChecksum: 1}, count)
+	}
+}
+
+func TestPrepareImportWithIdentifierValidation(t *testing.T) {
+	files := map[string][]byte{"filter_2002.csv": []byte("siren\n732829320\n732829321\n")}
+
+	t.Run("Should only report invalid identifiers by default", func(t *testing.T) {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, files)
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithIdentifierValidation(false))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should fail if invalid identifiers must be rejected", func(t *testing.T) {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, files)
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithIdentifierValidation(true))
+		var invalidIdentifiersError InvalidIdentifiersError
+		if assert.True(t, errors.As(err, &invalidIdentifiersError)) {
+			assert.Equal(t, "identifiants siren/siret invalides : /1802/filter_2002.csv (1)", err.Error())
+		}
+	})
+	t.Run("Should validate the files of a sub-batch, in its directory", func(t *testing.T) {
+		subBatchKey := newSafeBatchKey("1802_01")
+		dir := t.TempDir()
+		subBatchDir := BatchDir(dir, subBatchKey)
+		_ = os.MkdirAll(subBatchDir, 0777)
+		_ = os.WriteFile(path.Join(subBatchDir, "filter_2002.csv"), files["filter_2002.csv"], 0666)
+		_, err := PrepareImport(dir, subBatchKey, dummyDateFinEffectif, WithIdentifierValidation(true))
+		assert.EqualError(t, err, "identifiants siren/siret invalides : /1802_01/filter_2002.csv (1)")
+	})
+}
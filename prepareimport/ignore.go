@@ -0,0 +1,207 @@
+package prepareimport
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFilename is the name of the file listing the files to ignore, with the syntax of .gitignore.
+// It is read from the data root, and from batch directories.
+const IgnoreFilename = ".prepareignore"
+
+// DefaultConfigFilename is the default name of the configuration file generated from a batch.
+const DefaultConfigFilename = "batch.toml"
+
+// name of the generated configuration file, which is ignored if it is written into a batch directory
+var configFilename = DefaultConfigFilename
+
+// IgnoreConfigFile makes ReadFilenames ignore the configuration file generated at configFile (e.g. by -configFile),
+// instead of the default "batch.toml".
+func IgnoreConfigFile(configFile string) {
+	configFilename = filepath.Base(configFile)
+}
+
+// patterns of files that are always ignored, because they don't contain any data
+func defaultIgnorePatterns() []string {
+	return []string{
+		IgnoreFilename,
+		OverridesFilename,
+		ManifestFilename,
+		literalPattern(configFilename), // generated configuration
+		"perimeter_*.csv",              // lists of sirens combined with the generated filter, cf findCompositionSteps
+		"[Rr][Ee][Aa][Dd][Mm][Ee]*",    // e.g. README.md, readme.txt or ReadMe.md
+		".DS_Store",
+		"Thumbs.db",
+		"*.md5",
+		"*.sha1",
+		"*.sha256",
+		"*.sha512",
+		"MD5SUMS",
+		"SHA1SUMS",
+		"SHA256SUMS",
+		"SHA512SUMS",
+	}
+}
+
+// literalPattern returns a pattern which only matches the given filename.
+func literalPattern(filename string) string {
+	var pattern strings.Builder
+	for _, char := range filename {
+		if strings.ContainsRune(`*?[\`, char) {
+			pattern.WriteRune('\\')
+		}
+		pattern.WriteRune(char)
+	}
+	escaped := pattern.String()
+	if strings.HasPrefix(escaped, "#") || strings.HasPrefix(escaped, "!") || strings.HasPrefix(escaped, `\`) {
+		return `\` + escaped // otherwise read as a comment, a negation or an escape by IgnoreList.add
+	}
+	return escaped
+}
+
+// ignorePattern is a line of a .prepareignore file.
+type ignorePattern struct {
+	baseDir  string // directory of the .prepareignore file
+	pattern  string
+	negate   bool // the pattern starts with "!"
+	anchored bool // the pattern contains a "/", i.e. it is relative to baseDir
+	dirOnly  bool // the pattern ends with "/"
+}
+
+// IgnoreList tells which files of a directory must be ignored, from the default patterns
+// and the .prepareignore files of the directory and its parents, up to the data root.
+type IgnoreList struct {
+	patterns []ignorePattern
+}
+
+// NewIgnoreList parses the given patterns, relative to baseDir.
+func NewIgnoreList(baseDir string, lines []string) IgnoreList {
+	ignoreList := IgnoreList{}
+	ignoreList.add(baseDir, lines)
+	return ignoreList
+}
+
+// ReadIgnoreList returns the ignore list that applies to the files of dir.
+// Batch directories are expected to be found in the data root, and sub-batch directories in their parent.
+func ReadIgnoreList(dir string) (IgnoreList, error) {
+	dirs := []string{dir}
+	for current := filepath.Clean(dir); isBatchDir(current); {
+		current = filepath.Dir(current)
+		dirs = append(dirs, current)
+	}
+	ignoreList := NewIgnoreList(dir, defaultIgnorePatterns())
+	// the patterns of the deepest .prepareignore files take precedence
+	for i := len(dirs) - 1; i >= 0; i-- {
+		lines, err := readIgnoreFile(path.Join(dirs[i], IgnoreFilename))
+		if err != nil {
+			return ignoreList, err
+		}
+		ignoreList.add(dirs[i], lines)
+	}
+	return ignoreList, nil
+}
+
+func isBatchDir(dir string) bool {
+	_, err := NewBatchKey(filepath.Base(dir))
+	return err == nil
+}
+
+func readIgnoreFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func (ignoreList *IgnoreList) add(baseDir string, lines []string) {
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := ignorePattern{baseDir: filepath.Clean(baseDir)}
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // e.g. "\#file" or "\!file"
+		}
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		pattern.anchored = strings.Contains(line, "/")
+		pattern.pattern = strings.TrimPrefix(line, "/")
+		ignoreList.patterns = append(ignoreList.patterns, pattern)
+	}
+}
+
+// IsIgnored tells whether the file at filePath must be ignored. As with .gitignore, the last matching pattern wins.
+func (ignoreList IgnoreList) IsIgnored(filePath string) bool {
+	filePath = filepath.Clean(filePath)
+	ignored := false
+	for _, pattern := range ignoreList.patterns {
+		if pattern.matches(filePath) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+// matches tells whether the pattern matches the file, or one of the directories containing it.
+func (pattern ignorePattern) matches(filePath string) bool {
+	relPath, err := filepath.Rel(pattern.baseDir, filePath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	for end := len(segments); end > 0; end-- {
+		isDir := end < len(segments)
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.anchored {
+			if matchSegments(strings.Split(pattern.pattern, "/"), segments[:end]) {
+				return true
+			}
+		} else if matched, _ := path.Match(pattern.pattern, segments[end-1]); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where "**" matches any number of segments.
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
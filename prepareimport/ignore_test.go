@@ -0,0 +1,86 @@
+package prepareimport
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreList(t *testing.T) {
+	ignoreList := NewIgnoreList("/data", []string{
+		"# comment",
+		"*.log",
+		"!important.log",
+		"/1802/notes.txt",
+		"archives/",
+		"**/tmp_*.csv",
+	})
+	cases := []struct {
+		filePath string
+		expected bool
+	}{
+		{"/data/1802/debug.log", true},
+		{"/data/1802/important.log", false},
+		{"/data/1802/notes.txt", true},
+		{"/data/1803/notes.txt", false},
+		{"/data/1802/archives/debits.csv", true},
+		{"/data/1802/1802_01/tmp_debits.csv", true},
+		{"/data/1802/sigfaible_debits.csv", false},
+		{"/elsewhere/debug.log", false},
+	}
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.expected, ignoreList.IsIgnored(testCase.filePath), testCase.filePath)
+	}
+}
+
+func TestReadFilenamesWithIgnoreFiles(t *testing.T) {
+	t.Run("Should ignore housekeeping files by default", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"sigfaible_debits.csv", "README.md", "ReadMe.txt", ".DS_Store", "sigfaible_debits.csv.sha256", "batch.toml"})
+		filenames, err := ReadFilenames(path.Join(dir, dummyBatchKey.String()))
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"sigfaible_debits.csv"}, filenames)
+		}
+	})
+
+	t.Run("Should ignore the configuration file provided instead of batch.toml", func(t *testing.T) {
+		IgnoreConfigFile("./config/admin[1802].json")
+		t.Cleanup(func() { IgnoreConfigFile(DefaultConfigFilename) })
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"sigfaible_debits.csv", "admin[1802].json", "admin1.json", "batch.toml"})
+		filenames, err := ReadFilenames(path.Join(dir, dummyBatchKey.String()))
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"admin1.json", "batch.toml", "sigfaible_debits.csv"}, filenames)
+		}
+	})
+
+	t.Run("Should apply the .prepareignore files of the data root and of the batch", func(t *testing.T) {
+		subBatchKey := newSafeBatchKey("1802_01")
+		dir := CreateTempFiles(t, dummyBatchKey, []string{})
+		subBatchDir := path.Join(dir, dummyBatchKey.String(), subBatchKey.String())
+		if err := os.Mkdir(subBatchDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for filePath, content := range map[string]string{
+			path.Join(dir, IgnoreFilename):                          "*.txt\n",
+			path.Join(subBatchDir, IgnoreFilename):                  "!keep.txt\nold_*\n",
+			path.Join(subBatchDir, "notes.txt"):                     "",
+			path.Join(subBatchDir, "keep.txt"):                      "",
+			path.Join(subBatchDir, "old_debits.csv"):                "",
+			path.Join(subBatchDir, "sigfaible_debits.csv"):          "",
+			path.Join(dir, dummyBatchKey.String(), "livraison.txt"): "",
+		} {
+			if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		filenames, err := ReadFilenames(subBatchDir)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"keep.txt", "sigfaible_debits.csv"}, filenames)
+		}
+		filenames, err = ReadFilenames(path.Join(dir, dummyBatchKey.String()))
+		if assert.NoError(t, err) {
+			assert.Empty(t, filenames)
+		}
+	})
+}
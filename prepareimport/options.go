@@ -0,0 +1,144 @@
+package prepareimport
+
+import (
+	"time"
+
+	"prepare-import/createfilter"
+)
+
+// Option customizes the behaviour of PrepareImport.
+type Option func(*options)
+
+type options struct {
+	params                ParamOptions
+	strictDateFinEffectif bool
+	coverageInParam       bool
+	previousBatch         *PreviousBatchComparison
+	policy                *BatchPolicy
+	allowIncomplete       bool
+	validateIdentifiers   bool
+	rejectInvalidSirets   bool
+	perimeterMode         createfilter.PerimeterMode
+	sireneRules           SireneRuleOptions
+	requireSireneUL       bool
+	sireneULCacheDir      string
+	canonicalNames        bool
+	now                   func() time.Time
+}
+
+func newOptions(opts []Option) options {
+	o := options{perimeterMode: createfilter.DefaultPerimeterMode, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithParams overrides the default values of the "param" property of the Admin object.
+func WithParams(params ParamOptions) Option {
+	return func(o *options) {
+		o.params = params
+	}
+}
+
+// WithStrictDateFinEffectif makes PrepareImport fail when the sources of date_fin_effectif are inconsistent,
+// instead of printing a warning.
+func WithStrictDateFinEffectif() Option {
+	return func(o *options) {
+		o.strictDateFinEffectif = true
+	}
+}
+
+// WithClock replaces time.Now, to which date_fin_effectif is compared, e.g. in tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithCoverageInParam adds the range of periods covered by each time-series file to the "param" property.
+func WithCoverageInParam() Option {
+	return func(o *options) {
+		o.coverageInParam = true
+	}
+}
+
+// WithPreviousBatchComparison prints warnings about the regressions found since the previous batch.
+func WithPreviousBatchComparison(comparison PreviousBatchComparison) Option {
+	return func(o *options) {
+		o.previousBatch = &comparison
+	}
+}
+
+// WithPolicy makes PrepareImport fail if the files of the batch don't comply with the policy.
+func WithPolicy(policy BatchPolicy) Option {
+	return func(o *options) {
+		o.policy = &policy
+	}
+}
+
+// WithAllowIncomplete only prints a warning when required types are missing from the batch.
+func WithAllowIncomplete() Option {
+	return func(o *options) {
+		o.allowIncomplete = true
+	}
+}
+
+// WithIdentifierValidation prints the number of invalid siren and siret identifiers found in the files of the batch.
+// If reject is true, PrepareImport fails when a file contains invalid identifiers, and sirets
+// which key is invalid are excluded from the generated filter.
+func WithIdentifierValidation(reject bool) Option {
+	return func(o *options) {
+		o.validateIdentifiers = true
+		o.rejectInvalidSirets = reject
+	}
+}
+
+// WithPerimeterMode tells how the effectif of companies is evaluated when the filter is generated:
+// per establishment, summed per siren, or from the effectif_ent file.
+func WithPerimeterMode(mode createfilter.PerimeterMode) Option {
+	return func(o *options) {
+		o.perimeterMode = mode
+	}
+}
+
+// WithRequiredSireneUL makes PrepareImport fail if the filter must be generated, and no sireneUL file is found
+// in the batch (or its parent batch). Otherwise, the filter is generated without excluding any company.
+func WithRequiredSireneUL() Option {
+	return func(o *options) {
+		o.requireSireneUL = true
+	}
+}
+
+// WithSireneULCache caches the exclusions computed from the sireneUL file into dir, so that the next
+// filters generated from the same file (e.g. for sub-batches) don't parse it again.
+// Without this option, the exclusions are not cached.
+func WithSireneULCache(dir string) Option {
+	return func(o *options) {
+		o.sireneULCacheDir = dir
+	}
+}
+
+// SireneRuleOptions toggles the optional rules which exclude companies from the generated filter, using Sirene data.
+type SireneRuleOptions struct {
+	ExcludeCessees             bool // exclude the unités légales which are cessées, according to the sireneUL file
+	ExcludeCreatedAfterDateFin bool // exclude the unités légales created after date_fin, according to the sireneUL file
+	IgnoreClosedEtablissements bool // ignore the closed establishments of the sirene (StockEtablissement) file
+}
+
+// WithSireneRules enables optional Sirene rules when the filter is generated.
+// The number of exclusions of each rule is reported in the "filter_exclusions" param.
+func WithSireneRules(rules SireneRuleOptions) Option {
+	return func(o *options) {
+		o.sireneRules = rules
+	}
+}
+
+// WithCanonicalNames references the files of the batch in the Admin object by a canonical name per type
+// (e.g. "debit_1802.csv.gz"), through symbolic links to the original files. The original name of each
+// file is kept in the manifest of the batch (cf ManifestFilename).
+func WithCanonicalNames() Option {
+	return func(o *options) {
+		o.canonicalNames = true
+	}
+}
@@ -0,0 +1,139 @@
+package prepareimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// OverridesFilename is the name of the file, inside a batch directory, that overrides the detection of its files.
+const OverridesFilename = "batch-overrides.json"
+
+// BatchOverrides contains manual decisions about the files of a batch.
+type BatchOverrides struct {
+	Types           map[string]ValidFileType `json:"types,omitempty"`             // type of a file, by filename
+	Exclude         []string                 `json:"exclude,omitempty"`           // names of files to ignore
+	CompleteTypes   []ValidFileType          `json:"complete_types,omitempty"`    // types to mark as complete
+	IncompleteTypes []ValidFileType          `json:"incomplete_types,omitempty"`  // types to never mark as complete
+	DateFinEffectif string                   `json:"date_fin_effectif,omitempty"` // e.g. "2020-01-01"
+}
+
+// ReadBatchOverrides reads the overrides file of a batch directory, if any.
+func ReadBatchOverrides(batchDir string) (BatchOverrides, error) {
+	overrides := BatchOverrides{}
+	data, err := os.ReadFile(path.Join(batchDir, OverridesFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return overrides, nil
+	} else if err != nil {
+		return overrides, err
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return overrides, fmt.Errorf("invalid overrides file in %s: %w", batchDir, err)
+	}
+	for filename, fileType := range overrides.Types {
+		if _, err := ParseValidFileType(string(fileType)); err != nil {
+			return overrides, fmt.Errorf("invalid type for %s in overrides file of %s: %w", filename, batchDir, err)
+		}
+	}
+	for _, fileType := range append(append([]ValidFileType{}, overrides.CompleteTypes...), overrides.IncompleteTypes...) {
+		if _, err := ParseValidFileType(string(fileType)); err != nil {
+			return overrides, fmt.Errorf("invalid complete type in overrides file of %s: %w", batchDir, err)
+		}
+		if containsFileType(overrides.CompleteTypes, fileType) && containsFileType(overrides.IncompleteTypes, fileType) {
+			return overrides, fmt.Errorf("type %s is both complete and incomplete in overrides file of %s", fileType, batchDir)
+		}
+	}
+	if overrides.DateFinEffectif != "" {
+		if _, err := time.Parse("2006-01-02", overrides.DateFinEffectif); err != nil {
+			return overrides, fmt.Errorf("invalid date_fin_effectif in overrides file of %s: %s", batchDir, overrides.DateFinEffectif)
+		}
+	}
+	return overrides, nil
+}
+
+// IsEmpty tells whether the overrides contain no decision.
+func (overrides BatchOverrides) IsEmpty() bool {
+	return len(overrides.Types) == 0 && len(overrides.Exclude) == 0 && len(overrides.CompleteTypes) == 0 &&
+		len(overrides.IncompleteTypes) == 0 && overrides.DateFinEffectif == ""
+}
+
+// Save writes the overrides file of a batch directory.
+func (overrides BatchOverrides) Save(batchDir string) error {
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(batchDir, OverridesFilename), data, 0644)
+}
+
+// SetType forces the type of a file.
+func (overrides *BatchOverrides) SetType(filename string, fileType ValidFileType) {
+	if overrides.Types == nil {
+		overrides.Types = map[string]ValidFileType{}
+	}
+	overrides.Types[filename] = fileType
+}
+
+// IsExcluded tells whether a file must be ignored.
+func (overrides BatchOverrides) IsExcluded(filename string) bool {
+	for _, excluded := range overrides.Exclude {
+		if excluded == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// apply removes excluded files, and forces the type of overridden files.
+func (overrides BatchOverrides) apply(dataFiles []DataFile) []DataFile {
+	result := []DataFile{}
+	for _, dataFile := range dataFiles {
+		if overrides.IsExcluded(dataFile.GetOriginalFilename()) {
+			continue
+		}
+		if fileType, ok := overrides.Types[dataFile.GetOriginalFilename()]; ok {
+			dataFile = overriddenDataFile{dataFile, fileType}
+		}
+		result = append(result, dataFile)
+	}
+	return result
+}
+
+// overriddenDataFile is a DataFile which type was provided in the overrides file.
+type overriddenDataFile struct {
+	DataFile
+	fileType ValidFileType
+}
+
+// DetectFileType returns the type provided in the overrides file.
+func (dataFile overriddenDataFile) DetectFileType() ValidFileType {
+	return dataFile.fileType
+}
+
+// applyToCompleteTypes adds the types forced as complete, if the batch contains files of these types,
+// and removes the types denied as complete.
+func (overrides BatchOverrides) applyToCompleteTypes(completeTypes []ValidFileType, filesProperty FilesProperty) []ValidFileType {
+	result := []ValidFileType{}
+	for _, fileType := range completeTypes {
+		if containsFileType(overrides.IncompleteTypes, fileType) {
+			println("Info: type \"" + string(fileType) + "\" was marked as \"incomplete\" by the overrides file")
+			continue
+		}
+		result = append(result, fileType)
+	}
+	for _, fileType := range overrides.CompleteTypes {
+		if containsFileType(result, fileType) {
+			continue
+		}
+		if len(filesProperty[fileType]) == 0 {
+			println("Warning: type \"" + string(fileType) + "\" is marked as \"complete\" by the overrides file, but the batch has no such file")
+			continue
+		}
+		println("Info: type \"" + string(fileType) + "\" was marked as \"complete\" by the overrides file")
+		result = append(result, fileType)
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package prepareimport
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchOverrides(t *testing.T) {
+	t.Run("Should force the type of a file and exclude another one", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"debits_janvier.csv", "notes.txt", "sigfaible_delais.csv"})
+		overrides := BatchOverrides{Types: map[string]ValidFileType{"debits_janvier.csv": debit}, Exclude: []string{"notes.txt"}}
+		if err := overrides.Save(path.Join(dir, dummyBatchKey.String())); err != nil {
+			t.Fatal(err)
+		}
+		filesProperty, unsupportedFiles, _ := PopulateFilesProperty(dir, dummyBatchKey)
+		assert.Empty(t, unsupportedFiles)
+		assert.Equal(t, map[ValidFileType][]string{
+			debit: {"/1802/debits_janvier.csv"},
+			delai: {"/1802/sigfaible_delais.csv"},
+		}, populateFilesPaths(filesProperty))
+	})
+
+	t.Run("Should fail on an unknown type", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{})
+		batchDir := path.Join(dir, dummyBatchKey.String())
+		if err := os.WriteFile(path.Join(batchDir, OverridesFilename), []byte(`{"types": {"a.csv": "debits"}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadBatchOverrides(batchDir)
+		assert.ErrorContains(t, err, "type de fichier inconnu : debits")
+	})
+}
+
+func TestPrepareImportWithOverrides(t *testing.T) {
+	t.Run("Should force and deny complete types, and report the overrides", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv", "sigfaible_debits.csv", "conso.csv"})
+		overrides := BatchOverrides{
+			Types:           map[string]ValidFileType{"conso.csv": apconso},
+			CompleteTypes:   []ValidFileType{debit},
+			IncompleteTypes: []ValidFileType{apconso},
+		}
+		if err := overrides.Save(path.Join(dir, dummyBatchKey.String())); err != nil {
+			t.Fatal(err)
+		}
+		res, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []ValidFileType{debit}, res.CompleteTypes)
+			assert.Equal(t, &overrides, res.Overrides)
+		}
+	})
+
+	t.Run("Should use date_fin_effectif from the overrides file in priority", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		overrides := BatchOverrides{DateFinEffectif: "2018-01-01"}
+		if err := overrides.Save(path.Join(dir, dummyBatchKey.String())); err != nil {
+			t.Fatal(err)
+		}
+		res, err := PrepareImport(dir, dummyBatchKey, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, fromOverrides, res.Param.DateFinEffectifSource)
+			assert.Equal(t, "2018-01-01", formatDate(res.Param.DateFinEffectif))
+		}
+	})
+
+	t.Run("Should read the overrides of a sub-batch from its directory", func(t *testing.T) {
+		subBatchKey := newSafeBatchKey("1802_01")
+		dir := t.TempDir()
+		subBatchDir := BatchDir(dir, subBatchKey)
+		_ = os.MkdirAll(subBatchDir, 0777)
+		for _, filename := range []string{"filter_2002.csv", "conso.csv"} {
+			_ = os.WriteFile(path.Join(subBatchDir, filename), []byte{}, 0666)
+		}
+		overrides := BatchOverrides{Types: map[string]ValidFileType{"conso.csv": apconso}}
+		if err := overrides.Save(subBatchDir); err != nil {
+			t.Fatal(err)
+		}
+		res, err := PrepareImport(dir, subBatchKey, dummyDateFinEffectif)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"/1802_01/conso.csv"}, res.Files[apconso])
+			assert.Equal(t, &overrides, res.Overrides)
+		}
+	})
+
+	t.Run("Should fail on a type that is both complete and incomplete", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		overrides := BatchOverrides{CompleteTypes: []ValidFileType{debit}, IncompleteTypes: []ValidFileType{debit}}
+		if err := overrides.Save(path.Join(dir, dummyBatchKey.String())); err != nil {
+			t.Fatal(err)
+		}
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
+		assert.ErrorContains(t, err, "type debit is both complete and incomplete")
+	})
+}
@@ -0,0 +1,129 @@
+package prepareimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ParamOptions overrides the default values of the "param" property of an Admin object.
+// Zero values keep the default behaviour.
+type ParamOptions struct {
+	DateDebut time.Time              // replaces the default date_debut
+	DateFin   time.Time              // replaces the date_fin derived from the batch key
+	NbMois    int                    // if > 0, date_debut is set NbMois months before date_fin (rolling window)
+	Extra     map[string]interface{} // additional entries of the "param" property
+}
+
+// paramsFile is the format of the configuration file read by ReadParamOptions.
+type paramsFile struct {
+	DateDebut string                 `json:"date_debut"`
+	DateFin   string                 `json:"date_fin"`
+	NbMois    int                    `json:"nb_mois"`
+	Param     map[string]interface{} `json:"param"`
+}
+
+// ReadParamOptions reads ParamOptions from a JSON configuration file, e.g.
+// {"date_debut": "2017-01-01", "nb_mois": 24, "param": {"commentaire": "reconstruction"}}
+func ReadParamOptions(filePath string) (ParamOptions, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return ParamOptions{}, err
+	}
+	var file paramsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return ParamOptions{}, fmt.Errorf("fichier de paramètres invalide %s: %w", filePath, err)
+	}
+	if file.NbMois < 0 {
+		return ParamOptions{}, fmt.Errorf("nb_mois doit être positif dans %s, trouvé : %d", filePath, file.NbMois)
+	}
+	params := ParamOptions{NbMois: file.NbMois, Extra: file.Param}
+	if params.DateDebut, err = ParseOptionalDate(file.DateDebut); err != nil {
+		return ParamOptions{}, fmt.Errorf("date_debut invalide dans %s: %w", filePath, err)
+	}
+	if params.DateFin, err = ParseOptionalDate(file.DateFin); err != nil {
+		return ParamOptions{}, fmt.Errorf("date_fin invalide dans %s: %w", filePath, err)
+	}
+	return params, nil
+}
+
+// Merge returns params, completed by the values of fallback that params doesn't define.
+func (params ParamOptions) Merge(fallback ParamOptions) ParamOptions {
+	merged := fallback
+	if !params.DateDebut.IsZero() {
+		merged.DateDebut = params.DateDebut
+	}
+	if !params.DateFin.IsZero() {
+		merged.DateFin = params.DateFin
+	}
+	if params.NbMois > 0 {
+		merged.NbMois = params.NbMois
+	}
+	if len(params.Extra) > 0 {
+		merged.Extra = map[string]interface{}{}
+		for key, value := range fallback.Extra {
+			merged.Extra[key] = value
+		}
+		for key, value := range params.Extra {
+			merged.Extra[key] = value
+		}
+	}
+	return merged
+}
+
+// apply overrides the values of param, then checks their consistency.
+func (params ParamOptions) apply(param ParamProperty) (ParamProperty, error) {
+	if !params.DateFin.IsZero() {
+		param.DateFin = params.DateFin
+	}
+	if !params.DateDebut.IsZero() {
+		if params.NbMois > 0 {
+			return ParamProperty{}, errors.New("date_debut et nb_mois ne peuvent pas être fournis ensemble")
+		}
+		param.DateDebut = params.DateDebut
+	}
+	if params.NbMois > 0 {
+		param.DateDebut = param.DateFin.AddDate(0, -params.NbMois, 0)
+	}
+	if !param.DateDebut.Before(param.DateFin) {
+		return ParamProperty{}, fmt.Errorf("date_debut (%s) doit précéder date_fin (%s)", formatDate(param.DateDebut), formatDate(param.DateFin))
+	}
+	if param.DateFinEffectif.After(param.DateFin) {
+		if !params.DateFin.IsZero() {
+			return ParamProperty{}, fmt.Errorf("date_fin_effectif (%s) est postérieure à date_fin (%s)", formatDate(param.DateFinEffectif), formatDate(param.DateFin))
+		}
+		println(fmt.Sprintf("Warning: date_fin_effectif (%s) is after date_fin (%s)", formatDate(param.DateFinEffectif), formatDate(param.DateFin)))
+	}
+	for key, value := range params.Extra {
+		if isReservedParam(key) {
+			return ParamProperty{}, fmt.Errorf("le paramètre %q ne peut pas être fourni comme paramètre supplémentaire", key)
+		}
+		if param.Extra == nil {
+			param.Extra = map[string]interface{}{}
+		}
+		param.Extra[key] = value
+	}
+	return param, nil
+}
+
+func isReservedParam(key string) bool {
+	switch key {
+	case "date_debut", "date_fin", "date_fin_effectif", "date_fin_effectif_source", "coverage", "perimeter_mode", "filter_exclusions", "filter_composition":
+		return true
+	}
+	return false
+}
+
+// ParseOptionalDate parses a date in the AAAA-MM-JJ format, or returns the zero time if value is empty.
+func ParseOptionalDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func formatDate(date time.Time) string {
+	return date.Format("2006-01-02")
+}
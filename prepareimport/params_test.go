@@ -0,0 +1,101 @@
+package prepareimport
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamOptions(t *testing.T) {
+	defaultParam := populateParamProperty(newSafeBatchKey("1802"), validDateFinEffectif)
+
+	t.Run("Should keep default values when no option is provided", func(t *testing.T) {
+		res, err := ParamOptions{}.apply(defaultParam)
+		if assert.NoError(t, err) {
+			assert.Equal(t, defaultParam, res)
+		}
+	})
+
+	t.Run("Should override date_debut and date_fin", func(t *testing.T) {
+		res, err := ParamOptions{DateDebut: makeDayDate(2017, 1, 1), DateFin: makeDayDate(2017, 6, 1)}.apply(defaultParam)
+		if assert.NoError(t, err) {
+			assert.Equal(t, makeDayDate(2017, 1, 1), res.DateDebut)
+			assert.Equal(t, makeDayDate(2017, 6, 1), res.DateFin)
+		}
+	})
+
+	t.Run("Should compute date_debut from a rolling window", func(t *testing.T) {
+		res, err := ParamOptions{NbMois: 24}.apply(defaultParam)
+		if assert.NoError(t, err) {
+			assert.Equal(t, makeDayDate(2016, 2, 1), res.DateDebut)
+		}
+	})
+
+	t.Run("Should fail if date_debut and nb_mois are both provided", func(t *testing.T) {
+		_, err := ParamOptions{DateDebut: makeDayDate(2017, 1, 1), NbMois: 24}.apply(defaultParam)
+		assert.EqualError(t, err, "date_debut et nb_mois ne peuvent pas être fournis ensemble")
+	})
+
+	t.Run("Should fail if date_debut is not before date_fin", func(t *testing.T) {
+		_, err := ParamOptions{DateDebut: makeDayDate(2018, 2, 1)}.apply(defaultParam)
+		assert.EqualError(t, err, "date_debut (2018-02-01) doit précéder date_fin (2018-02-01)")
+	})
+
+	t.Run("Should fail if date_fin_effectif is after the provided date_fin", func(t *testing.T) {
+		_, err := ParamOptions{DateFin: makeDayDate(2013, 6, 1), DateDebut: makeDayDate(2012, 1, 1)}.apply(defaultParam)
+		assert.EqualError(t, err, "date_fin_effectif (2014-01-01) est postérieure à date_fin (2013-06-01)")
+	})
+
+	t.Run("Should add extra params after the other properties", func(t *testing.T) {
+		res, err := ParamOptions{Extra: map[string]interface{}{"commentaire": "test", "version": 2}}.apply(defaultParam)
+		if assert.NoError(t, err) {
+			serialized, _ := json.Marshal(res)
+			expected := `{"date_debut":"2016-01-01T00:00:00Z","date_fin":"2018-02-01T00:00:00Z","date_fin_effectif":"2014-01-01T00:00:00Z","commentaire":"test","version":2}`
+			assert.Equal(t, expected, string(serialized))
+		}
+	})
+
+	t.Run("Should not allow extra params to override a property", func(t *testing.T) {
+		_, err := ParamOptions{Extra: map[string]interface{}{"date_fin": "2020-01-01"}}.apply(defaultParam)
+		assert.EqualError(t, err, `le paramètre "date_fin" ne peut pas être fourni comme paramètre supplémentaire`)
+	})
+}
+
+func TestReadParamOptions(t *testing.T) {
+	t.Run("Should read params from a JSON file", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "params.json")
+		content := `{"date_fin": "2019-06-01", "nb_mois": 12, "param": {"commentaire": "reconstruction"}}`
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		params, err := ReadParamOptions(filePath)
+		if assert.NoError(t, err) {
+			assert.Equal(t, ParamOptions{
+				DateFin: makeDayDate(2019, 6, 1),
+				NbMois:  12,
+				Extra:   map[string]interface{}{"commentaire": "reconstruction"},
+			}, params)
+		}
+	})
+
+	t.Run("Should fail on an invalid date", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "params.json")
+		if err := os.WriteFile(filePath, []byte(`{"date_debut": "01/01/2017"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadParamOptions(filePath)
+		assert.ErrorContains(t, err, "date_debut invalide")
+	})
+
+	t.Run("Should fail on a negative nb_mois", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "params.json")
+		if err := os.WriteFile(filePath, []byte(`{"nb_mois": -12}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadParamOptions(filePath)
+		assert.ErrorContains(t, err, "nb_mois doit être positif")
+	})
+}
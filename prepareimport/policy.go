@@ -0,0 +1,125 @@
+package prepareimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"prepare-import/core"
+)
+
+// FileTypesPolicy lists the types of files that are required, optional or forbidden in a batch.
+// When Optional is not empty, the types that are not listed at all are reported as unexpected.
+type FileTypesPolicy struct {
+	Required  []ValidFileType `json:"required"`
+	Optional  []ValidFileType `json:"optional"`
+	Forbidden []ValidFileType `json:"forbidden"`
+}
+
+// BatchPolicy applies a FileTypesPolicy to main batches, and another one to sub-batches.
+type BatchPolicy struct {
+	Batch    FileTypesPolicy `json:"batch"`
+	SubBatch FileTypesPolicy `json:"sub_batch"`
+}
+
+// ReadBatchPolicy reads a BatchPolicy from a JSON file, e.g.
+// {"batch": {"required": ["effectif", "debit"]}, "sub_batch": {"forbidden": ["effectif"]}}
+func ReadBatchPolicy(filePath string) (BatchPolicy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return BatchPolicy{}, err
+	}
+	var policy BatchPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return BatchPolicy{}, fmt.Errorf("fichier de politique invalide %s: %w", filePath, err)
+	}
+	for _, fileTypesPolicy := range []FileTypesPolicy{policy.Batch, policy.SubBatch} {
+		for _, fileTypes := range [][]ValidFileType{fileTypesPolicy.Required, fileTypesPolicy.Optional, fileTypesPolicy.Forbidden} {
+			for _, fileType := range fileTypes {
+				if _, err := ParseValidFileType(string(fileType)); err != nil {
+					return BatchPolicy{}, fmt.Errorf("fichier de politique invalide %s: %w", filePath, err)
+				}
+			}
+		}
+	}
+	return policy, nil
+}
+
+// For returns the policy that applies to the given batch.
+func (policy BatchPolicy) For(batchKey BatchKey) FileTypesPolicy {
+	if batchKey.IsSubBatch() {
+		return policy.SubBatch
+	}
+	return policy.Batch
+}
+
+// PolicyViolationError lists the required types that are missing and the forbidden types that are present.
+type PolicyViolationError struct {
+	Missing   []ValidFileType
+	Forbidden []ValidFileType
+}
+
+func (err PolicyViolationError) Error() string {
+	messages := []string{}
+	if len(err.Missing) > 0 {
+		messages = append(messages, "types de fichiers manquants : "+joinFileTypes(err.Missing))
+	}
+	if len(err.Forbidden) > 0 {
+		messages = append(messages, "types de fichiers interdits : "+joinFileTypes(err.Forbidden))
+	}
+	return strings.Join(messages, " ; ")
+}
+
+// Check returns the violations of the policy by the files of a batch, and the unexpected types.
+func (policy FileTypesPolicy) Check(filesProperty FilesProperty) (violation PolicyViolationError, unexpected []ValidFileType) {
+	for _, fileType := range policy.Required {
+		if len(filesProperty[fileType]) == 0 {
+			violation.Missing = append(violation.Missing, fileType)
+		}
+	}
+	for _, fileType := range policy.Forbidden {
+		if len(filesProperty[fileType]) > 0 {
+			violation.Forbidden = append(violation.Forbidden, fileType)
+		}
+	}
+	if len(policy.Optional) > 0 {
+		for _, fileType := range allFileTypes {
+			if len(filesProperty[fileType]) > 0 && !containsFileType(policy.Required, fileType) &&
+				!containsFileType(policy.Optional, fileType) && !containsFileType(policy.Forbidden, fileType) {
+				unexpected = append(unexpected, fileType)
+			}
+		}
+	}
+	return violation, unexpected
+}
+
+// applyPolicy fails if the files of the batch violate the policy.
+// Missing types are only reported as a warning if allowIncomplete is true.
+func applyPolicy(policy FileTypesPolicy, filesProperty FilesProperty, allowIncomplete bool) error {
+	violation, unexpected := policy.Check(filesProperty)
+	if len(unexpected) > 0 {
+		println("Warning: types de fichiers inattendus : " + joinFileTypes(unexpected))
+	}
+	if len(violation.Missing) > 0 && allowIncomplete {
+		println("Warning: batch incomplet, types de fichiers manquants : " + joinFileTypes(violation.Missing))
+		violation.Missing = nil
+	}
+	if len(violation.Missing) > 0 || len(violation.Forbidden) > 0 {
+		return violation
+	}
+	return nil
+}
+
+func containsFileType(fileTypes []ValidFileType, fileType ValidFileType) bool {
+	for _, current := range fileTypes {
+		if current == fileType {
+			return true
+		}
+	}
+	return false
+}
+
+func joinFileTypes(fileTypes []ValidFileType) string {
+	return strings.Join(core.Apply(fileTypes, func(fileType ValidFileType) string { return string(fileType) }), ", ")
+}
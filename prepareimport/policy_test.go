@@ -0,0 +1,98 @@
+package prepareimport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTypesPolicy(t *testing.T) {
+	filesProperty := FilesProperty{
+		debit:    {dummyBatchFile("sigfaible_debits.csv")},
+		effectif: {dummyBatchFile("sigfaible_effectif_siret.csv")},
+		diane:    {dummyBatchFile("diane_req_2002.csv")},
+	}
+
+	t.Run("Should list missing and forbidden types", func(t *testing.T) {
+		policy := FileTypesPolicy{Required: []ValidFileType{debit, cotisation, delai}, Forbidden: []ValidFileType{effectif}}
+		violation, unexpected := policy.Check(filesProperty)
+		assert.Equal(t, PolicyViolationError{Missing: []ValidFileType{cotisation, delai}, Forbidden: []ValidFileType{effectif}}, violation)
+		assert.Empty(t, unexpected)
+		assert.Equal(t, "types de fichiers manquants : cotisation, delai ; types de fichiers interdits : effectif", violation.Error())
+	})
+
+	t.Run("Should list unexpected types when optional types are listed", func(t *testing.T) {
+		policy := FileTypesPolicy{Required: []ValidFileType{debit}, Optional: []ValidFileType{effectif}}
+		_, unexpected := policy.Check(filesProperty)
+		assert.Equal(t, []ValidFileType{diane}, unexpected)
+	})
+
+	t.Run("Should only warn about missing types if the batch is allowed to be incomplete", func(t *testing.T) {
+		policy := FileTypesPolicy{Required: []ValidFileType{cotisation}}
+		assert.NoError(t, applyPolicy(policy, filesProperty, true))
+		assert.Error(t, applyPolicy(policy, filesProperty, false))
+	})
+
+	t.Run("Should always fail on forbidden types", func(t *testing.T) {
+		policy := FileTypesPolicy{Forbidden: []ValidFileType{diane}}
+		assert.EqualError(t, applyPolicy(policy, filesProperty, true), "types de fichiers interdits : diane")
+	})
+}
+
+func TestReadBatchPolicy(t *testing.T) {
+	t.Run("Should read a policy for batches and sub-batches", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "policy.json")
+		content := `{"batch": {"required": ["effectif", "debit"]}, "sub_batch": {"forbidden": ["effectif"]}}`
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		policy, err := ReadBatchPolicy(filePath)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []ValidFileType{effectif, debit}, policy.For(dummyBatchKey).Required)
+			assert.Equal(t, []ValidFileType{effectif}, policy.For(newSafeBatchKey("1802_01")).Forbidden)
+		}
+	})
+
+	t.Run("Should fail on an unknown type", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "policy.json")
+		if err := os.WriteFile(filePath, []byte(`{"batch": {"required": ["debits"]}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadBatchPolicy(filePath)
+		assert.ErrorContains(t, err, "type de fichier inconnu : debits")
+	})
+}
+
+func TestPrepareImportWithPolicy(t *testing.T) {
+	policy := BatchPolicy{Batch: FileTypesPolicy{Required: []ValidFileType{filter, debit}}}
+
+	t.Run("Should fail if a required type is missing", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithPolicy(policy))
+		var violation PolicyViolationError
+		if assert.True(t, errors.As(err, &violation)) {
+			assert.Equal(t, []ValidFileType{debit}, violation.Missing)
+		}
+	})
+
+	t.Run("Should not generate the filter of a rejected batch", func(t *testing.T) {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": ReadFileData(t, "../createfilter/test_data.csv"),
+		})
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithPolicy(policy))
+		var violation PolicyViolationError
+		if assert.True(t, errors.As(err, &violation)) {
+			assert.Equal(t, []ValidFileType{debit}, violation.Missing, "the filter to be generated is expected")
+		}
+		assert.NoFileExists(t, filepath.Join(dir, "1802", "filter_siren_1802.csv"))
+	})
+
+	t.Run("Should succeed if the batch is allowed to be incomplete", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithPolicy(policy), WithAllowIncomplete())
+		assert.NoError(t, err)
+	})
+}
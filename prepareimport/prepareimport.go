@@ -6,39 +6,49 @@ import (
 	"io"
 	"os"
 	"path"
-	"time"
 
 	"prepare-import/createfilter"
 )
 
 // PrepareImport generates an Admin object from files found at given pathname of the file system.
-func PrepareImport(pathname string, batchKey BatchKey, providedDateFinEffectif string) (AdminObject, error) {
+func PrepareImport(pathname string, batchKey BatchKey, providedDateFinEffectif string, opts ...Option) (AdminObject, error) {
+	options := newOptions(opts)
 
-	batchPath := getBatchPath(pathname, batchKey)
+	batchPath := getBatchPath(batchKey)
 	println("Listing data files in " + batchPath + "/ ...")
 	if _, err := os.ReadDir(path.Join(pathname, batchPath)); err != nil {
 		return AdminObject{}, fmt.Errorf("could not find directory %s in provided path", batchPath)
 	}
 
-	var err error
-	filesProperty, unsupportedFiles := PopulateFilesProperty(pathname, batchKey)
+	overrides, err := ReadBatchOverrides(BatchDir(pathname, batchKey))
+	if err != nil {
+		return AdminObject{}, err
+	}
+	dataFiles := listDataFiles(BatchDir(pathname, batchKey), overrides)
+	if options.canonicalNames {
+		if dataFiles, err = useCanonicalNames(BatchDir(pathname, batchKey), batchKey, dataFiles); err != nil {
+			return AdminObject{}, err
+		}
+	}
+	filesProperty, unsupportedFiles, err := PopulateFilesPropertyFromDataFiles(dataFiles, batchKey)
+	if err != nil {
+		return AdminObject{}, err
+	}
 
 	// To complete the FilesProperty, we need:
-	// - a filter file (created from an effectif file, at the batch/parent level)
-	// - a dateFinEffectif value (provided as parameter, or detected from effectif file)
-
-	var dateFinEffectif time.Time
-	effectifFile, _ := filesProperty.GetEffectifFile()
-	filterFile, _ := filesProperty.GetFilterFile()
-	sireneULFile, _ := filesProperty.GetSireneULFile()
-	if (effectifFile == nil || filterFile == nil) && batchKey.IsSubBatch() {
-		println("Looking for effectif and/or filter file in " + batchKey.GetParentBatch() + " ...")
-		parentFilesProperty, _ := PopulateFilesProperty(pathname, newSafeBatchKey(batchKey.GetParentBatch()))
-		if effectifFile == nil {
-			effectifFile, _ = parentFilesProperty.GetEffectifFile()
-		}
-		if filterFile == nil {
-			filterFile, _ = parentFilesProperty.GetFilterFile()
+	// - a filter file (created from an effectif or effectif_ent file, at the batch/parent level)
+	// - a dateFinEffectif value (provided in the overrides file or as parameter, or detected from effectif files)
+
+	inputs, err := findFilterInputs(pathname, batchKey, filesProperty)
+	if err != nil {
+		return AdminObject{}, err
+	}
+	effectifFile, effectifEntFile, filterFile := inputs.effectifFile, inputs.effectifEntFile, inputs.filterFile
+
+	// check the policy before generating or copying the filter, so that a rejected batch is left untouched
+	if options.policy != nil {
+		if err := applyPolicy(options.policy.For(batchKey), withExpectedFilter(batchKey, filesProperty, inputs), options.allowIncomplete); err != nil {
+			return AdminObject{}, err
 		}
 	}
 
@@ -50,99 +60,165 @@ func PrepareImport(pathname string, batchKey BatchKey, providedDateFinEffectif s
 		println("Found filter file: " + filterFile.Name())
 	}
 
-	if sireneULFile != nil {
-		println("Found sireneUL file: " + sireneULFile.Name())
+	if inputs.sireneULFile != nil {
+		println("Found sireneUL file: " + inputs.sireneULFile.Name())
 	}
 
-	// if needed, create a filter file from the effectif file
+	// if needed, create a filter file from the effectif (or effectif_ent) file
+	var perimeterMode createfilter.PerimeterMode
+	var filterExclusions createfilter.ExclusionReport
+	var filterComposition []createfilter.CompositionStep
 	if filterFile == nil {
-		if effectifFile == nil {
-			return AdminObject{}, errors.New("filter is missing: batch should include a filter or one effectif file")
+		generation, err := planFilterGeneration(pathname, batchKey, options, filesProperty, inputs)
+		if err != nil {
+			return AdminObject{}, err
 		}
-		effectifFilePath := effectifFile.AbsolutePath(pathname)
-		sireneULFilePath := sireneULFile.AbsolutePath(pathname)
-		effectifBatch := effectifFile.BatchKey()
-		filterFile = newBatchFile(effectifBatch, "filter_siren_"+effectifBatch.String()+".csv")
-		println("Generating filter file: " + filterFile.Path() + " ...")
-		if err = createFilterFromEffectifAndSirene(path.Join(pathname, filterFile.Path()), effectifFilePath, sireneULFilePath); err != nil {
+		perimeterMode, filterComposition = generation.perimeterMode, generation.composition
+		sourceBatch := generation.sourceFile.BatchKey()
+		filterName, filterDir := "filter_siren_"+sourceBatch.String()+".csv", BatchDir(pathname, sourceBatch)
+		filterFile = newDataBatchFile(sourceBatch, NewDataFile(filterName, filterDir))
+		println("Generating filter file: " + filterFile.Path() + " (perimeter mode: " + string(perimeterMode) + ") ...")
+		composition := withAbsolutePaths(pathname, filterComposition)
+		if filterExclusions, err = createFilterFromEffectifAndSirene(path.Join(filterDir, filterName), generation.sourceFile.AbsolutePath(pathname), perimeterMode, options.rejectInvalidSirets, generation.rules, composition); err != nil {
 			return AdminObject{}, err
 		}
+		filterExclusions.Print()
+		for i, step := range composition {
+			filterComposition[i].Added, filterComposition[i].Removed = step.Added, step.Removed
+			println(fmt.Sprintf("Info: %s of %s: %d sirens added to the filter, %d removed", step.Operation, filterComposition[i].File, step.Added, step.Removed))
+		}
+	} else if steps, _ := findCompositionSteps(pathname, batchKey); len(steps) > 0 {
+		println("Warning: the batch already has a filter, the perimeter_* files are not combined with it")
 	}
 
 	// add the filter to filesProperty
 	if filesProperty["filter"] == nil && filterFile != nil {
-		if batchKey.IsSubBatch() {
+		if batchKey.IsSubBatch() && filterFile.BatchKey() != batchKey {
 			// copy the filter into the sub-batch's directory
 			println("Copying filter file to " + filterFile.Path() + " ...")
-			src := path.Join(pathname, filterFile.Path())
-			dest := path.Join(pathname, batchKey.GetParentBatch(), batchKey.Path(), filterFile.Name())
-			err = copy(src, dest)
+			batchDir := BatchDir(pathname, batchKey)
+			err = copy(filterFile.DataFile(), path.Join(batchDir, filterFile.Name()))
 			if err != nil {
 				return AdminObject{}, err
 			}
-			filterFile = newBatchFile(batchKey, filterFile.Name())
+			filterFile = newDataBatchFile(batchKey, NewDataFile(filterFile.Name(), batchDir))
 		}
 		println("Adding filter file to batch ...")
 		filesProperty["filter"] = append(filesProperty["filter"], filterFile)
 	}
 
-	if effectifFile != nil {
-		println("Detecting dateFinEffectif from effectif file ...")
-		effectifFilePath := effectifFile.AbsolutePath(pathname)
-		dateFinEffectif, err = createfilter.DetectDateFinEffectif(effectifFilePath, createfilter.DefaultNbIgnoredCols) // TODO: éviter de lire le fichier Effectif deux fois
-		if err != nil {
-			return AdminObject{}, err
+	if options.validateIdentifiers {
+		report := validateIdentifiers(filesProperty)
+		report.Print()
+		if options.rejectInvalidSirets && report.HasInvalid() {
+			return AdminObject{}, InvalidIdentifiersError{report}
 		}
 	}
 
-	// make sure we have date_fin_effectif
-	if dateFinEffectif.IsZero() {
-		println("Still missing date_fin_effectif => parsing CLI parameter ...")
-		dateFinEffectif, err = time.Parse("2006-01-02", providedDateFinEffectif)
+	if options.previousBatch != nil && !batchKey.IsSubBatch() {
+		warnings, err := compareWithPreviousBatch(pathname, batchKey, filesProperty, *options.previousBatch)
 		if err != nil {
-			return AdminObject{}, errors.New("date_fin_effectif is missing or invalid: " + providedDateFinEffectif)
+			return AdminObject{}, err
+		}
+		for _, warning := range warnings {
+			println("Warning: " + warning)
 		}
 	}
 
+	// make sure we have a consistent date_fin_effectif
+	candidates, err := collectDateFinEffectifCandidates(pathname, effectifFile, effectifEntFile, overrides.DateFinEffectif, providedDateFinEffectif)
+	if err != nil {
+		return AdminObject{}, err
+	}
+	dateFinEffectif, err := reconcileDateFinEffectif(candidates, lookUpPreviousDateFinEffectif(pathname, batchKey, options), options.strictDateFinEffectif, options.now())
+	if err != nil {
+		return AdminObject{}, err
+	}
+
+	param := populateParamProperty(batchKey, NewDateFinEffectif(dateFinEffectif.date))
+	param.DateFinEffectifSource = dateFinEffectif.source
+	param.PerimeterMode = perimeterMode
+	param.FilterExclusions = filterExclusions
+	param.FilterComposition = filterComposition
+	param, err = options.params.apply(param)
+	if err != nil {
+		return AdminObject{}, err
+	}
+
+	if options.coverageInParam {
+		param.Coverage = detectCoverage(filesProperty, param.DateFin)
+		param.Coverage.Print()
+	}
+
 	if len(unsupportedFiles) > 0 {
 		err = UnsupportedFilesError{unsupportedFiles}
 	}
 
-	return AdminObject{
+	adminObject := AdminObject{
 		ID:            IDProperty{batchKey, "batch"},
 		Files:         populateFilesPaths(filesProperty),
-		CompleteTypes: populateCompleteTypesProperty(filesProperty),
-		Param:         populateParamProperty(batchKey, NewDateFinEffectif(dateFinEffectif)),
-	}, err
+		CompleteTypes: overrides.applyToCompleteTypes(populateCompleteTypesProperty(filesProperty), filesProperty),
+		Param:         param,
+	}
+	if !overrides.IsEmpty() {
+		adminObject.Overrides = &overrides
+	}
+	return adminObject, err
 }
 
-func createFilterFromEffectifAndSirene(filterFilePath string, effectifFilePath string, sireneULFilePath string) error {
+// createFilterFromEffectifAndSirene generates a filter file, excluding companies according to the Sirene files of rules, if any,
+// then combining it with the lists of sirens of composition.
+func createFilterFromEffectifAndSirene(filterFilePath string, effectifFilePath string, perimeterMode createfilter.PerimeterMode, rejectInvalidSirets bool, rules createfilter.SireneRules, composition []createfilter.CompositionStep) (createfilter.ExclusionReport, error) {
 	if fileExists(filterFilePath) {
-		return errors.New("about to overwrite existing filter file: " + filterFilePath)
+		return nil, errors.New("about to overwrite existing filter file: " + filterFilePath)
 	}
-	filterWriter, err := os.Create(filterFilePath)
+	report := createfilter.NewExclusionReport(rules)
+	keepSiret, filters, err := createfilter.NewSireneFilters(rules, report)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// the filter is written into a temporary file, and only gets its name once complete,
+	// so that a failed generation doesn't leave a filter which would be reused by the next run
+	filterWriter, err := os.CreateTemp(path.Dir(filterFilePath), ".tmp-"+path.Base(filterFilePath)+"-*")
+	if err != nil {
+		return nil, err
 	}
-	categoriesJuridiqueFilter := createfilter.CategorieJuridiqueFilter(sireneULFilePath)
+	defer os.Remove(filterWriter.Name()) // no-op once renamed
 
-	return createfilter.CreateFilter(
+	err = createfilter.CreateFilter(
 		filterWriter,     // output: the filter file
-		effectifFilePath, // input: the effectif file
+		effectifFilePath, // input: the effectif file (or effectif_ent file, depending on perimeterMode)
 		createfilter.DefaultNbMois,
 		createfilter.DefaultMinEffectif,
-		createfilter.DefaultNbIgnoredCols,
-		categoriesJuridiqueFilter,
+		perimeterMode,
+		rejectInvalidSirets,
+		keepSiret,
+		composition,
+		filters...,
 	)
+	if closeErr := filterWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, os.Rename(filterWriter.Name(), filterFilePath)
 }
 
-func getBatchPath(pathname string, batchKey BatchKey) string {
+// getBatchPath returns the directory of a batch, relative to the data directory.
+// Sub-batches are located in the directory of their parent batch.
+func getBatchPath(batchKey BatchKey) string {
 	if batchKey.IsSubBatch() {
 		return path.Join(batchKey.GetParentBatch(), batchKey.String())
 	}
 	return batchKey.String()
 }
 
+// BatchDir returns the directory of a batch, in the data directory pathname.
+func BatchDir(pathname string, batchKey BatchKey) string {
+	return path.Join(pathname, getBatchPath(batchKey))
+}
+
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	return !os.IsNotExist(err)
@@ -150,8 +226,8 @@ func fileExists(filename string) bool {
 
 // Copy the src file to dst. Any existing file will be overwritten and will not
 // copy file attributes. Source: https://stackoverflow.com/a/21061062/592254
-func copy(src, dst string) error {
-	in, err := os.Open(src)
+func copy(src DataFile, dst string) error {
+	in, err := src.Open()
 	if err != nil {
 		return err
 	}
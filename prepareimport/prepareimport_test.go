@@ -7,10 +7,14 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/signaux-faibles/goSirene"
 	"github.com/stretchr/testify/assert"
+
+	"prepare-import/createfilter"
 )
 
 func TestReadFilenames(t *testing.T) {
@@ -45,14 +49,14 @@ func TestPrepareImport(t *testing.T) {
 	t.Run("Should warn if no filter is provided", func(t *testing.T) {
 		dir := CreateTempFiles(t, dummyBatchKey, []string{"sigfaibles_debits.csv"})
 		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
-		expected := "filter is missing: batch should include a filter or one effectif file"
+		expected := "filter is missing: batch should include a filter, or one effectif or effectif_ent file"
 		assert.Equal(t, expected, err.Error())
 	})
 
 	t.Run("Should warn if 2 effectif files are provided", func(t *testing.T) {
 		dir := CreateTempFiles(t, dummyBatchKey, []string{"sigfaible_effectif_siret.csv", "sigfaible_effectif_siret2.csv"})
 		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
-		expected := "filter is missing: batch should include a filter or one effectif file"
+		expected := "filter is missing: batch should include a filter, or one effectif or effectif_ent file"
 		assert.Equal(t, expected, err.Error())
 	})
 
@@ -139,6 +143,16 @@ func TestPrepareImport(t *testing.T) {
 		}
 	})
 
+	t.Run("Should apply the provided params", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv"})
+		params := ParamOptions{NbMois: 12, Extra: map[string]interface{}{"commentaire": "test"}}
+		res, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif, WithParams(params))
+		if assert.NoError(t, err) {
+			assert.Equal(t, makeDayDate(2017, 2, 1), res.Param.DateDebut)
+			assert.Equal(t, "test", res.Param.Extra["commentaire"])
+		}
+	})
+
 	cases := []struct {
 		//id       string
 		filename string
@@ -199,6 +213,175 @@ func TestPrepareImport(t *testing.T) {
 		assert.Equal(t, expectedDateFinEffectif, actualDateFinEffectif)
 	})
 
+	t.Run("should create filter file from the effectif_ent file, and record the perimeter mode", func(t *testing.T) {
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siren.csv": []byte("siren;rais_soc;eff201011;eff201012\n111111111;ENTREPRISE;12;\n333333333;ENTREPRISE;4;4\n"),
+			"sireneUL.csv":                 ReadFileData(t, "../createfilter/test_uniteLegale.csv"),
+		})
+		adminObject, err := PrepareImport(batchDir, dummyBatchKey, "", WithPerimeterMode(createfilter.FromEffectifEnt))
+		if assert.NoError(t, err) {
+			assert.Equal(t, createfilter.FromEffectifEnt, adminObject.Param.PerimeterMode)
+			assert.Equal(t, []string{dummyBatchFile("filter_siren_1802.csv").Path()}, adminObject.Files[filter])
+		}
+		filterData, _ := os.ReadFile(path.Join(batchDir, dummyBatchKey.Path(), "filter_siren_1802.csv"))
+		assert.Equal(t, "siren\n111111111\n", string(filterData))
+	})
+
+	t.Run("should apply the enabled sirene rules to the filter, and report their exclusions", func(t *testing.T) {
+		closedEtablissement := make([]string, len(goSirene.GeoSireneHeaders))
+		closedEtablissement[goSirene.GeoSireneMap["siret"]] = "11111111100023"
+		closedEtablissement[goSirene.GeoSireneMap["etatAdministratifEtablissement"]] = "F"
+		sireneData := strings.Join(goSirene.GeoSireneHeaders, ",") + "\n" + strings.Join(closedEtablissement, ",") + "\n"
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv":    []byte("siret;eff201011\n11111111100015;4\n11111111100023;40\n44444444400013;12\n"),
+			"sireneUL.csv":                    ReadFileData(t, "../createfilter/test_uniteLegale.csv"),
+			"StockEtablissement_utf8_geo.csv": []byte(sireneData),
+		})
+		adminObject, err := PrepareImport(batchDir, dummyBatchKey, "", WithSireneRules(SireneRuleOptions{
+			ExcludeCessees:             true,
+			IgnoreClosedEtablissements: true,
+		}))
+		if assert.NoError(t, err) {
+			assert.Equal(t, createfilter.ExclusionReport{
+				createfilter.RuleCategorieJuridique: 0,
+				createfilter.RuleActivite:           0,
+				createfilter.RuleCessee:             0,
+				createfilter.RuleEtablissementFerme: 1,
+			}, adminObject.Param.FilterExclusions)
+		}
+		filterData, _ := os.ReadFile(path.Join(batchDir, dummyBatchKey.Path(), "filter_siren_1802.csv"))
+		assert.Equal(t, "siren\n444444444\n", string(filterData))
+	})
+
+	t.Run("should create filter file without excluding companies if there is no sireneUL file", func(t *testing.T) {
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n22222222200017;12\n"),
+		})
+		adminObject, err := PrepareImport(batchDir, dummyBatchKey, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{dummyBatchFile("filter_siren_1802.csv").Path()}, adminObject.Files[filter])
+			assert.Empty(t, adminObject.Param.FilterExclusions)
+		}
+		filterData, _ := os.ReadFile(path.Join(batchDir, dummyBatchKey.Path(), "filter_siren_1802.csv"))
+		assert.Equal(t, "siren\n111111111\n222222222\n", string(filterData))
+	})
+
+	t.Run("should fail if the sireneUL file is required but missing", func(t *testing.T) {
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n"),
+		})
+		_, err := PrepareImport(batchDir, dummyBatchKey, "", WithRequiredSireneUL())
+		if assert.Error(t, err) {
+			assert.Equal(t, "sireneUL is missing: batch should include a sireneUL file to generate the filter", err.Error())
+		}
+		assert.False(t, fileExists(path.Join(batchDir, dummyBatchKey.Path(), "filter_siren_1802.csv")))
+	})
+
+	t.Run("should exclude companies according to a gzipped sireneUL file", func(t *testing.T) {
+		compressedSireneULData := compressFileData(t, "../createfilter/test_uniteLegale.csv")
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n22222222200017;12\n"),
+			"sireneUL.csv.gz":              compressedSireneULData.Bytes(),
+		})
+		_, err := PrepareImport(batchDir, dummyBatchKey, "", WithRequiredSireneUL())
+		assert.NoError(t, err)
+		filterData, _ := os.ReadFile(path.Join(batchDir, dummyBatchKey.Path(), "filter_siren_1802.csv"))
+		assert.Equal(t, "siren\n111111111\n", string(filterData))
+	})
+
+	t.Run("should combine the generated filter with the perimeter_* files of the batch, and record the composition", func(t *testing.T) {
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv":     []byte("siret;eff201011\n11111111100015;12\n22222222200017;12\n"),
+			"perimeter_union_filter_1801.csv":  []byte("siren\n333333333\n"),
+			"perimeter_include_suivis.csv":     []byte("siren\n444444444\n111111111\n"),
+			"perimeter_exclude_collectivs.csv": []byte("siren\n222222222\n"),
+		})
+		adminObject, err := PrepareImport(batchDir, dummyBatchKey, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []createfilter.CompositionStep{
+				{Operation: createfilter.Union, File: "/1802/perimeter_union_filter_1801.csv", Added: 1},
+				{Operation: createfilter.Include, File: "/1802/perimeter_include_suivis.csv", Added: 1},
+				{Operation: createfilter.Exclude, File: "/1802/perimeter_exclude_collectivs.csv", Removed: 1},
+			}, adminObject.Param.FilterComposition)
+			assert.Equal(t, []ValidFileType{effectif, filter}, sortedFileTypes(adminObject.Files))
+		}
+		filterData, _ := os.ReadFile(path.Join(batchDir, dummyBatchKey.Path(), "filter_siren_1802.csv"))
+		assert.Equal(t, "siren\n111111111\n333333333\n444444444\n", string(filterData))
+	})
+
+	t.Run("should not leave any filter when a perimeter_* file is malformed", func(t *testing.T) {
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n"),
+			"perimeter_include.csv":        []byte("siren\n12AB\n"),
+		})
+		_, err := PrepareImport(batchDir, dummyBatchKey, "")
+		assert.ErrorContains(t, err, `siren mal formé "12AB" à la ligne 2`)
+		entries, _ := os.ReadDir(path.Join(batchDir, dummyBatchKey.Path()))
+		for _, entry := range entries {
+			assert.NotContains(t, entry.Name(), "filter")
+		}
+	})
+
+	t.Run("should cache the exclusions of the sireneUL file, and reuse them for the next batches", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		for _, batchKey := range []BatchKey{newSafeBatchKey("1802"), newSafeBatchKey("1803")} {
+			batchDir := CreateTempFilesWithContent(t, batchKey, map[string][]byte{
+				"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n22222222200017;12\n"),
+				"sireneUL.csv":                 ReadFileData(t, "../createfilter/test_uniteLegale.csv"),
+			})
+			_, err := PrepareImport(batchDir, batchKey, "", WithSireneULCache(cacheDir))
+			assert.NoError(t, err)
+			filterData, _ := os.ReadFile(path.Join(batchDir, batchKey.Path(), "filter_siren_"+batchKey.String()+".csv"))
+			assert.Equal(t, "siren\n111111111\n", string(filterData))
+		}
+		cacheFiles, _ := filepath.Glob(filepath.Join(cacheDir, "*.bin"))
+		assert.Len(t, cacheFiles, 1)
+	})
+
+	t.Run("should use the sireneUL file of the parent batch, given we are generating a sub-batch", func(t *testing.T) {
+		subBatch := newSafeBatchKey("1802_01")
+		parentDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siret.csv": []byte("siret;eff201011\n11111111100015;12\n22222222200017;12\n"),
+			"sireneUL.csv":                 ReadFileData(t, "../createfilter/test_uniteLegale.csv"),
+		})
+		subBatchDir := filepath.Join(parentDir, dummyBatchKey.String(), subBatch.String())
+		_ = os.Mkdir(subBatchDir, 0777)
+		adminObject, err := PrepareImport(parentDir, subBatch, "", WithRequiredSireneUL())
+		if assert.NoError(t, err) {
+			assert.Nil(t, adminObject.Files[sireneUl]) // the file of the parent batch is not imported again
+		}
+		filterData, _ := os.ReadFile(filepath.Join(subBatchDir, "filter_siren_1802.csv"))
+		assert.Equal(t, "siren\n111111111\n", string(filterData))
+	})
+
+	t.Run("should create the filter file in the directory of a sub-batch, given it has its own effectif file", func(t *testing.T) {
+		subBatch := newSafeBatchKey("1802_01")
+		parentDir := t.TempDir()
+		subBatchDir := BatchDir(parentDir, subBatch)
+		_ = os.MkdirAll(subBatchDir, 0777)
+		_ = os.WriteFile(filepath.Join(subBatchDir, "sigfaible_effectif_siret.csv"), []byte("siret;eff201011\n11111111100015;12\n"), 0666)
+		adminObject, err := PrepareImport(parentDir, subBatch, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"/1802_01/filter_siren_1802_01.csv"}, adminObject.Files[filter])
+		}
+		filterData, _ := os.ReadFile(filepath.Join(subBatchDir, "filter_siren_1802_01.csv"))
+		assert.Equal(t, "siren\n111111111\n", string(filterData))
+	})
+
+	t.Run("should create filter file from the effectif_ent file if there is no effectif file", func(t *testing.T) {
+		batchDir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_effectif_siren.csv": []byte("siren;rais_soc;eff201011;eff201012\n111111111;ENTREPRISE;12;\n333333333;ENTREPRISE;4;4\n"),
+			"sireneUL.csv":                 ReadFileData(t, "../createfilter/test_uniteLegale.csv"),
+		})
+		adminObject, err := PrepareImport(batchDir, dummyBatchKey, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, createfilter.FromEffectifEnt, adminObject.Param.PerimeterMode)
+			assert.Equal(t, []string{dummyBatchFile("filter_siren_1802.csv").Path()}, adminObject.Files[filter])
+			assert.Equal(t, fromEffectifEnt, adminObject.Param.DateFinEffectifSource)
+			assert.Equal(t, makeDayDate(2010, 2, 1), adminObject.Param.DateFinEffectif)
+		}
+	})
+
 	t.Run("should create filter file even if effectif file is compressed", func(t *testing.T) {
 		compressedEffectifData := compressFileData(t, "../createfilter/test_data.csv")
 		// setup expectations
@@ -0,0 +1,203 @@
+package prepareimport
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PreviousBatchComparison configures the comparison of a batch with the previous one.
+type PreviousBatchComparison struct {
+	AdminObjectFile string  // if provided, the previous batch is described by this Admin object instead of being looked up in the data directory
+	MaxSizeDrop     float64 // e.g. 0.3 => warn if the total size of the files of a type shrank by more than 30%
+	MaxFilterDrop   float64 // e.g. 0.1 => warn if the filter lost more than 10% of its sirens
+}
+
+// DefaultPreviousBatchComparison contains the default thresholds of the comparison with the previous batch.
+var DefaultPreviousBatchComparison = PreviousBatchComparison{
+	MaxSizeDrop:   0.3,
+	MaxFilterDrop: 0.1,
+}
+
+// ReadAdminObject reads an Admin object saved by SaveToFile.
+func ReadAdminObject(filePath string) (AdminObject, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return AdminObject{}, err
+	}
+	var adminObject AdminObject
+	if err := json.Unmarshal(data, &adminObject); err != nil {
+		return AdminObject{}, fmt.Errorf("invalid Admin object in %s: %w", filePath, err)
+	}
+	return adminObject, nil
+}
+
+// ListBatches returns the keys of the batches and sub-batches found in root, in chronological order.
+func ListBatches(root string) ([]BatchKey, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	batches := []BatchKey{}
+	for _, entry := range entries {
+		batchKey, err := NewBatchKey(entry.Name())
+		if err != nil || !entry.IsDir() || batchKey.IsSubBatch() {
+			continue
+		}
+		batches = append(batches, batchKey)
+		subEntries, _ := os.ReadDir(path.Join(root, entry.Name()))
+		for _, subEntry := range subEntries {
+			subBatchKey, err := NewBatchKey(subEntry.Name())
+			if err == nil && subEntry.IsDir() && subBatchKey.IsSubBatch() && subBatchKey.Parent() == batchKey {
+				batches = append(batches, subBatchKey)
+			}
+		}
+	}
+	sort.Slice(batches, func(i, j int) bool { return batches[i].Before(batches[j]) })
+	return batches, nil
+}
+
+// FindPreviousBatch returns the latest main batch found in pathname before batchKey.
+func FindPreviousBatch(pathname string, batchKey BatchKey) (BatchKey, bool) {
+	entries, err := os.ReadDir(pathname)
+	if err != nil {
+		return BatchKey{}, false
+	}
+	var previous BatchKey
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		key, err := NewBatchKey(entry.Name())
+		if err != nil || key.IsSubBatch() || !key.Before(batchKey.Parent()) {
+			continue
+		}
+		if previous.IsZero() || previous.Before(key) {
+			previous = key
+		}
+	}
+	return previous, !previous.IsZero()
+}
+
+// compareWithPreviousBatch returns warnings about the file types, file sizes and filter cardinality
+// that regressed since the previous batch.
+func compareWithPreviousBatch(pathname string, batchKey BatchKey, filesProperty FilesProperty, comparison PreviousBatchComparison) ([]string, error) {
+	var previousKey BatchKey
+	var previousFiles map[ValidFileType][]DataFile
+	if comparison.AdminObjectFile != "" {
+		previousAdminObject, err := ReadAdminObject(comparison.AdminObjectFile)
+		if err != nil {
+			return nil, err
+		}
+		previousKey, previousFiles = previousAdminObject.ID.Key, adminFilesToDataFiles(pathname, previousAdminObject.Files)
+	} else {
+		var found bool
+		if previousKey, found = FindPreviousBatch(pathname, batchKey); !found {
+			return []string{"no previous batch was found in " + pathname}, nil
+		}
+		previousFilesProperty, _, err := PopulateFilesProperty(pathname, previousKey)
+		if err != nil {
+			return nil, err
+		}
+		previousFiles = populateDataFiles(previousFilesProperty)
+	}
+	println("Comparing with previous batch " + previousKey.String() + " ...")
+	currentFiles := populateDataFiles(filesProperty)
+
+	warnings := []string{}
+	for _, fileType := range sortedFileTypes(previousFiles) {
+		if _, ok := currentFiles[fileType]; !ok {
+			warnings = append(warnings, fmt.Sprintf("type %s was provided in batch %s, but is missing", fileType, previousKey))
+			continue
+		}
+		if fileType == filter {
+			previousCount, previousErr := countSirens(previousFiles[fileType])
+			currentCount, currentErr := countSirens(currentFiles[fileType])
+			if previousErr == nil && currentErr == nil && isDrop(previousCount, currentCount, comparison.MaxFilterDrop) {
+				warnings = append(warnings, fmt.Sprintf("filter shrank from %d to %d sirens since batch %s", previousCount, currentCount, previousKey))
+			}
+			continue
+		}
+		previousSize, previousErr := totalSize(previousFiles[fileType])
+		currentSize, currentErr := totalSize(currentFiles[fileType])
+		if previousErr == nil && currentErr == nil && isDrop(previousSize, currentSize, comparison.MaxSizeDrop) {
+			warnings = append(warnings, fmt.Sprintf("files of type %s shrank from %d to %d bytes since batch %s", fileType, previousSize, currentSize, previousKey))
+		}
+	}
+	return warnings, nil
+}
+
+func isDrop(previous, current int64, maxDrop float64) bool {
+	return previous > 0 && float64(previous-current)/float64(previous) > maxDrop
+}
+
+// totalSize returns the sum of the sizes of files, in bytes.
+func totalSize(dataFiles []DataFile) (int64, error) {
+	var size int64
+	for _, dataFile := range dataFiles {
+		info, err := dataFile.Stat()
+		if err != nil {
+			return 0, err
+		}
+		size += int64(info.Size)
+	}
+	return size, nil
+}
+
+// countSirens returns the number of sirens listed in filter files (i.e. their number of lines, without header).
+func countSirens(dataFiles []DataFile) (int64, error) {
+	var count int64
+	for _, dataFile := range dataFiles {
+		file, err := dataFile.Open()
+		if err != nil {
+			return 0, err
+		}
+		scanner := bufio.NewScanner(file)
+		for lineNumber := 0; scanner.Scan(); lineNumber++ {
+			if lineNumber > 0 && scanner.Text() != "" {
+				count++
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// populateDataFiles returns the files of a FilesProperty, by type.
+func populateDataFiles(filesProperty FilesProperty) map[ValidFileType][]DataFile {
+	dataFiles := map[ValidFileType][]DataFile{}
+	for fileType, batchFiles := range filesProperty {
+		for _, batchFile := range batchFiles {
+			dataFiles[fileType] = append(dataFiles[fileType], batchFile.DataFile())
+		}
+	}
+	return dataFiles
+}
+
+// adminFilesToDataFiles returns the files listed in an Admin object (e.g. "gzip:/1802/debits.csv.gz"), by type.
+func adminFilesToDataFiles(pathname string, files map[ValidFileType][]string) map[ValidFileType][]DataFile {
+	dataFiles := map[ValidFileType][]DataFile{}
+	for fileType, filePaths := range files {
+		for _, adminPath := range filePaths {
+			filePath := path.Join(pathname, strings.TrimPrefix(adminPath, "gzip:"))
+			dataFiles[fileType] = append(dataFiles[fileType], NewDataFile(path.Base(filePath), path.Dir(filePath)))
+		}
+	}
+	return dataFiles
+}
+
+func sortedFileTypes[T any](files map[ValidFileType]T) []ValidFileType {
+	fileTypes := []ValidFileType{}
+	for fileType := range files {
+		fileTypes = append(fileTypes, fileType)
+	}
+	sort.Slice(fileTypes, func(i, j int) bool { return fileTypes[i] < fileTypes[j] })
+	return fileTypes
+}
@@ -0,0 +1,94 @@
+package prepareimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPreviousBatch(t *testing.T) {
+	t.Run("Should return the latest main batch before the current one", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{})
+		for _, dirName := range []string{"1712", "1801", "1801_01", "1803", "not_a_batch"} {
+			_ = os.Mkdir(filepath.Join(dir, dirName), 0777)
+		}
+		previous, found := FindPreviousBatch(dir, dummyBatchKey)
+		if assert.True(t, found) {
+			assert.Equal(t, "1801", previous.String())
+		}
+	})
+
+	t.Run("Should not find a previous batch in an empty directory", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{})
+		_, found := FindPreviousBatch(dir, dummyBatchKey)
+		assert.False(t, found)
+	})
+}
+
+func TestCompareWithPreviousBatch(t *testing.T) {
+	previousBatch := newSafeBatchKey("1801")
+	setup := func(t *testing.T) string {
+		dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{
+			"sigfaible_debits.csv": bytes.Repeat([]byte("a"), 500),
+			"filter_siren.csv":     []byte("siren\n111111111\n"),
+		})
+		writeBatchFiles(t, dir, previousBatch, map[string][]byte{
+			"sigfaible_debits.csv":    bytes.Repeat([]byte("a"), 1000),
+			"sigfaible_cotisdues.csv": SomeTextAsBytes(1000),
+			"filter_siren.csv":        []byte("siren\n111111111\n222222222\n"),
+		})
+		return dir
+	}
+
+	t.Run("Should warn about missing types, smaller files and a smaller filter", func(t *testing.T) {
+		dir := setup(t)
+		filesProperty, _, _ := PopulateFilesProperty(dir, dummyBatchKey)
+		warnings, err := compareWithPreviousBatch(dir, dummyBatchKey, filesProperty, DefaultPreviousBatchComparison)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{
+				"type cotisation was provided in batch 1801, but is missing",
+				"files of type debit shrank from 1000 to 500 bytes since batch 1801",
+				"filter shrank from 2 to 1 sirens since batch 1801",
+			}, warnings)
+		}
+	})
+
+	t.Run("Should not warn below the thresholds", func(t *testing.T) {
+		dir := setup(t)
+		filesProperty, _, _ := PopulateFilesProperty(dir, dummyBatchKey)
+		warnings, err := compareWithPreviousBatch(dir, dummyBatchKey, filesProperty, PreviousBatchComparison{MaxSizeDrop: 0.6, MaxFilterDrop: 0.6})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"type cotisation was provided in batch 1801, but is missing"}, warnings)
+		}
+	})
+
+	t.Run("Should compare with a stored Admin object", func(t *testing.T) {
+		dir := setup(t)
+		adminObjectFile := filepath.Join(t.TempDir(), "batch.json")
+		previousAdminObject := AdminObject{
+			ID:    IDProperty{previousBatch, "batch"},
+			Files: map[ValidFileType][]string{debit: {"/1801/sigfaible_debits.csv"}},
+		}
+		if err := SaveToFile(previousAdminObject, adminObjectFile); err != nil {
+			t.Fatal(err)
+		}
+		filesProperty, _, _ := PopulateFilesProperty(dir, dummyBatchKey)
+		warnings, err := compareWithPreviousBatch(dir, dummyBatchKey, filesProperty, PreviousBatchComparison{AdminObjectFile: adminObjectFile, MaxSizeDrop: 0.3})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"files of type debit shrank from 1000 to 500 bytes since batch 1801"}, warnings)
+		}
+	})
+}
+
+func writeBatchFiles(t *testing.T, parentDir string, batchKey BatchKey, contentPerFile map[string][]byte) {
+	batchDir := filepath.Join(parentDir, batchKey.String())
+	_ = os.Mkdir(batchDir, 0777)
+	for filename, content := range contentPerFile {
+		if err := os.WriteFile(filepath.Join(batchDir, filename), content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
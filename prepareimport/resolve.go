@@ -0,0 +1,199 @@
+package prepareimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Suggestion is the type proposed for an unsupported file, with the reason of the proposal.
+type Suggestion struct {
+	FileType ValidFileType
+	Reason   string
+}
+
+// typical name of the files of each type, used to find the closest type of an unsupported file
+var typicalFilenames = map[ValidFileType]string{
+	adminUrssaf: "sigfaible_etablissement_utf8.csv",
+	apconso:     "consommation_ap.csv",
+	apdemande:   "demande_ap.csv",
+	ccsf:        "sigfaible_ccsf.csv",
+	cotisation:  "sigfaible_cotisdues.csv",
+	debit:       "sigfaible_debits.csv",
+	delai:       "sigfaible_delais.csv",
+	diane:       "diane_req.csv",
+	effectif:    "sigfaible_effectif_siret.csv",
+	effectifEnt: "sigfaible_effectif_siren.csv",
+	ellisphere:  "Ellisphère-Tête de groupe.xlsx",
+	filter:      "filter_siren.csv",
+	paydex:      "E_000000000000_Retro-Paydex_00000000.csv",
+	procol:      "sigfaible_pcoll.csv",
+	sirene:      "StockEtablissement_utf8_geo.csv",
+	sireneUl:    "sireneUL.csv",
+}
+
+// column names (in lower case) that are specific to the files of each type
+var typicalColumns = map[ValidFileType][]string{
+	adminUrssaf: {"num_compte", "siret", "date_crea_siret"},
+	apconso:     {"id_da", "heures"},
+	apdemande:   {"id_da", "date_statut"},
+	ccsf:        {"date_traitement", "stade"},
+	cotisation:  {"periode", "cotis_due"},
+	debit:       {"num_ecn", "num_hist_ecn"},
+	delai:       {"date_creation", "montant_echeancier"},
+	effectif:    {"siret", "rais_soc", "ape_ins"},
+	effectifEnt: {"siren", "rais_soc"},
+	procol:      {"dt_effet", "action_procol"},
+	sirene:      {"siret", "etatadministratifetablissement"},
+	sireneUl:    {"siren", "categoriejuridiqueunitelegale"},
+}
+
+// SuggestFileType proposes a type for an unsupported file, from its header, or else from its name.
+func SuggestFileType(batchDir string, filename string) (Suggestion, bool) {
+	if header, err := readHeader(NewDataFile(filename, batchDir)); err == nil {
+		if suggestion, found := suggestFromHeader(header); found {
+			return suggestion, true
+		}
+	}
+	return suggestFromFilename(filename)
+}
+
+func readHeader(dataFile DataFile) ([]string, error) {
+	r, f, err := openCsvFile(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return r.Read()
+}
+
+// suggestFromHeader returns the type which typical columns are all found in the header.
+// If several types match, the one with the most typical columns wins.
+func suggestFromHeader(header []string) (Suggestion, bool) {
+	columns := map[string]bool{}
+	for _, colName := range header {
+		columns[strings.ToLower(strings.TrimSpace(colName))] = true
+	}
+	best, bestScore := ValidFileType(""), 0
+	for _, fileType := range allFileTypes {
+		typical, ok := typicalColumns[fileType]
+		if !ok || len(typical) <= bestScore {
+			continue
+		}
+		allFound := true
+		for _, colName := range typical {
+			allFound = allFound && columns[colName]
+		}
+		if allFound {
+			best, bestScore = fileType, len(typical)
+		}
+	}
+	if best == "" {
+		return Suggestion{}, false
+	}
+	return Suggestion{best, "colonnes " + strings.Join(typicalColumns[best], ", ") + " trouvées dans l'en-tête"}, true
+}
+
+// suggestFromFilename returns the type which typical filename is the closest to filename.
+func suggestFromFilename(filename string) (Suggestion, bool) {
+	normalized := normalizeFilename(filename)
+	best, bestDistance := ValidFileType(""), -1
+	for _, fileType := range allFileTypes {
+		typical, ok := typicalFilenames[fileType]
+		if !ok {
+			continue
+		}
+		distance := levenshtein(normalized, normalizeFilename(typical))
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = fileType, distance
+		}
+	}
+	// beyond half of the length of the name, the similarity is meaningless
+	if best == "" || bestDistance > len(normalized)/2 {
+		return Suggestion{}, false
+	}
+	return Suggestion{best, "nom de fichier proche de " + typicalFilenames[best]}, true
+}
+
+func normalizeFilename(filename string) string {
+	filename = strings.TrimSuffix(strings.ToLower(filename), ".gz")
+	return strings.TrimSuffix(strings.TrimSuffix(filename, ".csv"), ".xlsx")
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(first int, others ...int) int {
+	min := first
+	for _, value := range others {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+// ResolveUnsupportedFiles asks the operator, for each unsupported file, to assign a type or to ignore the file.
+// Decisions are added to the overrides file of the batch, so that they are reused by subsequent runs.
+func ResolveUnsupportedFiles(pathname string, batchKey BatchKey, unsupportedFiles []string, in io.Reader, out io.Writer) error {
+	batchDir := BatchDir(pathname, batchKey)
+	overrides, err := ReadBatchOverrides(batchDir)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(in)
+	for _, unsupportedFile := range unsupportedFiles {
+		filename := path.Base(unsupportedFile)
+		fmt.Fprintln(out, "Fichier non supporté : "+unsupportedFile)
+		suggestion, found := SuggestFileType(batchDir, filename)
+		if found {
+			fmt.Fprintf(out, "Type proposé : %s (%s)\n", suggestion.FileType, suggestion.Reason)
+		}
+		for {
+			if found {
+				fmt.Fprint(out, "[Entrée] accepter, <type> assigner un autre type, i ignorer le fichier, s passer : ")
+			} else {
+				fmt.Fprint(out, "<type> assigner un type, i ignorer le fichier, s passer : ")
+			}
+			if !scanner.Scan() {
+				return overrides.Save(batchDir) // end of input: keep the decisions taken so far
+			}
+			answer := strings.TrimSpace(scanner.Text())
+			if answer == "" && found {
+				overrides.SetType(filename, suggestion.FileType)
+			} else if answer == "i" {
+				overrides.Exclude = append(overrides.Exclude, filename)
+			} else if answer != "s" {
+				fileType, err := ParseValidFileType(answer)
+				if err != nil {
+					fmt.Fprintln(out, err.Error())
+					continue
+				}
+				overrides.SetType(filename, fileType)
+			}
+			break
+		}
+	}
+	return overrides.Save(batchDir)
+}
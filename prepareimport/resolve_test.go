@@ -0,0 +1,76 @@
+package prepareimport
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestFileType(t *testing.T) {
+	cases := []struct {
+		filename string
+		content  string
+		expected ValidFileType
+	}{
+		{"sigfaible_debit.csv", "", debit},                                        // close filename
+		{"Sigfaible_Cotisdue.csv.gz", "", cotisation},                             // close filename, compressed
+		{"export.csv", "compte;siret;rais_soc;ape_ins;dep;eff201011\n", effectif}, // header
+		{"export2.csv", "siren,categorieJuridiqueUniteLegale,etc\n", sireneUl},    // header
+		{"livraison.csv", "Num_Compte;Num_Ecn;Num_Hist_Ecn;periode\n", debit},     // header
+		{"effectif_entreprises.csv", "siren;rais_soc;eff201011\n", effectifEnt},   // header wins over filename
+		{"readme.txt", "", ""}, // no suggestion
+	}
+	for _, testCase := range cases {
+		t.Run("should suggest "+string(testCase.expected)+" for "+testCase.filename, func(t *testing.T) {
+			dir := CreateTempFilesWithContent(t, dummyBatchKey, map[string][]byte{testCase.filename: []byte(testCase.content)})
+			suggestion, _ := SuggestFileType(path.Join(dir, dummyBatchKey.String()), testCase.filename)
+			assert.Equal(t, testCase.expected, suggestion.FileType)
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("debits", "debits"))
+	assert.Equal(t, 1, levenshtein("debit", "debits"))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+	assert.Equal(t, 1, levenshtein("tête", "tete"))
+}
+
+func TestResolveUnsupportedFiles(t *testing.T) {
+	t.Run("Should persist the decisions of the operator, and reuse them", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"filter_2002.csv", "sigfaible_debit.csv", "todo.txt", "notes.csv", "other.csv"})
+		_, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
+		unsupportedFiles := err.(UnsupportedFilesError).UnsupportedFiles
+		assert.Len(t, unsupportedFiles, 4)
+
+		// answers for: notes.csv, other.csv, sigfaible_debit.csv, todo.txt
+		in := strings.NewReader("delai\ns\n\ni\n")
+		var out bytes.Buffer
+		err = ResolveUnsupportedFiles(dir, dummyBatchKey, unsupportedFiles, in, &out)
+		if assert.NoError(t, err) {
+			assert.Contains(t, out.String(), "Type proposé : debit (nom de fichier proche de sigfaible_debits.csv)")
+		}
+
+		res, err := PrepareImport(dir, dummyBatchKey, dummyDateFinEffectif)
+		var unsupportedFilesError UnsupportedFilesError
+		if assert.ErrorAs(t, err, &unsupportedFilesError) {
+			assert.Equal(t, []string{"/1802/other.csv"}, unsupportedFilesError.UnsupportedFiles)
+		}
+		assert.Equal(t, []string{"/1802/sigfaible_debit.csv"}, res.Files[debit])
+		assert.Equal(t, []string{"/1802/notes.csv"}, res.Files[delai])
+	})
+
+	t.Run("Should ask again after an invalid type", func(t *testing.T) {
+		dir := CreateTempFiles(t, dummyBatchKey, []string{"notes.csv"})
+		var out bytes.Buffer
+		err := ResolveUnsupportedFiles(dir, dummyBatchKey, []string{"/1802/notes.csv"}, strings.NewReader("debits\ndebit\n"), &out)
+		if assert.NoError(t, err) {
+			assert.Contains(t, out.String(), "type de fichier inconnu : debits")
+			overrides, _ := ReadBatchOverrides(path.Join(dir, dummyBatchKey.String()))
+			assert.Equal(t, map[string]ValidFileType{"notes.csv": debit}, overrides.Types)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package prepareimport
+
+import (
+	"prepare-import/createfilter"
+)
+
+// resolve converts the options into the rules applied when generating the filter of a batch.
+// Unités légales are compared to date_fin, i.e. the one of the params or the one derived from the batch key.
+// Unités légales are only excluded if a sireneUL file is provided, and closed establishments can only be
+// ignored if the batch (or its parent) includes a sirene file.
+func (rules SireneRuleOptions) resolve(pathname string, batchKey BatchKey, params ParamOptions, filesProperty FilesProperty, sireneULFile BatchFile, cacheDir string) (createfilter.SireneRules, error) {
+	resolved := createfilter.SireneRules{ExcludeCessees: rules.ExcludeCessees, CacheDir: cacheDir}
+	if sireneULFile != nil {
+		resolved.UniteLegaleFile = sireneULFile.AbsolutePath(pathname)
+	}
+	if rules.ExcludeCreatedAfterDateFin {
+		resolved.ExcludeCreatedAfter = batchKey.Date()
+		if !params.DateFin.IsZero() {
+			resolved.ExcludeCreatedAfter = params.DateFin
+		}
+	}
+	if rules.IgnoreClosedEtablissements {
+		sireneFile, _ := filesProperty.GetSireneFile()
+		if sireneFile == nil && batchKey.IsSubBatch() {
+			parentFilesProperty, _, err := PopulateFilesProperty(pathname, batchKey.Parent())
+			if err != nil {
+				return resolved, err
+			}
+			sireneFile, _ = parentFilesProperty.GetSireneFile()
+		}
+		if sireneFile == nil {
+			println("Warning: no sirene file found, closed establishments will not be ignored by the filter")
+		} else {
+			println("Ignoring closed establishments of " + sireneFile.Name() + " in the filter ...")
+			resolved.EtablissementFile = sireneFile.AbsolutePath(pathname)
+		}
+	}
+	return resolved, nil
+}
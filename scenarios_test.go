@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"prepare-import/createfilter"
+	"prepare-import/prepareimport"
+	"prepare-import/synthetic"
+)
+
+var updateGoldenFiles = flag.Bool("update", false, "Update the expected test values in golden files")
+
+// scenario describes batches generated from synthetic data, and the batch which import is prepared.
+type scenario struct {
+	name            string
+	batchKey        string
+	dateFinEffectif string // provided as a parameter, if not empty
+	batches         func(g *synthetic.Generator, data synthetic.DataSet) ([]synthetic.Batch, error)
+	opts            []prepareimport.Option
+}
+
+// batchOf returns a function which generates a single batch, with a file of each of the given types.
+func batchOf(key string, fileTypes ...string) func(g *synthetic.Generator, data synthetic.DataSet) ([]synthetic.Batch, error) {
+	return func(g *synthetic.Generator, data synthetic.DataSet) ([]synthetic.Batch, error) {
+		batch, err := g.NewBatch(key, data, fileTypes...)
+		return []synthetic.Batch{batch}, err
+	}
+}
+
+func allTypesBut(excluded string) []string {
+	fileTypes := []string{}
+	for _, fileType := range synthetic.FileTypes() {
+		if fileType != excluded {
+			fileTypes = append(fileTypes, fileType)
+		}
+	}
+	return fileTypes
+}
+
+var scenarios = []scenario{
+	{name: "every_type", batchKey: "1802", batches: batchOf("1802", allTypesBut("filter")...)},
+	{name: "provided_filter", batchKey: "1802", dateFinEffectif: "2020-01-01", batches: batchOf("1802", "filter", "debit", "cotisation", "apconso")},
+	{name: "sub_batch", batchKey: "1802_01", batches: func(g *synthetic.Generator, data synthetic.DataSet) ([]synthetic.Batch, error) {
+		parent, err := g.NewBatch("1802", data, "effectif", "sirene_ul", "debit")
+		return []synthetic.Batch{parent, {Key: "1802_01"}}, err
+	}},
+	{name: "missing_sub_batch", batchKey: "1802_02", batches: batchOf("1802", "effectif", "sirene_ul")},
+	{name: "missing_effectif", batchKey: "1802", batches: batchOf("1802", "debit")},
+	{name: "missing_sirene_ul", batchKey: "1802", batches: batchOf("1802", "effectif", "debit")},
+	{name: "effectif_ent_only", batchKey: "1802", batches: batchOf("1802", "effectif_ent", "sirene_ul", "debit")},
+	{name: "sirene_rules", batchKey: "1802", batches: batchOf("1802", "effectif", "sirene_ul", "sirene"), opts: []prepareimport.Option{prepareimport.WithSireneRules(prepareimport.SireneRuleOptions{
+		ExcludeCessees:             true,
+		IgnoreClosedEtablissements: true,
+	})}},
+	{name: "canonical_names", batchKey: "1802", batches: batchOf("1802", "effectif", "sirene_ul", "debit", "bdf"), opts: []prepareimport.Option{prepareimport.WithCanonicalNames()}},
+	{name: "complete_gzipped_files", batchKey: "1802", batches: func(g *synthetic.Generator, data synthetic.DataSet) ([]synthetic.Batch, error) {
+		batch, err := g.NewBatch("1802", data, "effectif", "sirene_ul")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range []struct {
+			fileType string
+			minSize  int
+		}{{"procol", 1700000}, {"delai", 1700000}, {"debit", 1}} {
+			filename, content, err := g.GzippedFile(data, file.fileType, file.minSize)
+			if err != nil {
+				return nil, err
+			}
+			batch.Files[filename] = content
+		}
+		return []synthetic.Batch{batch}, nil
+	}},
+}
+
+// TestScenarios prepares the import of batches generated from synthetic data, and compares the admin object,
+// the error and the generated filter with the golden files of testdata/scenarios.
+// Run `make test-update` to update these golden files.
+func TestScenarios(t *testing.T) {
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			g := synthetic.New(42)
+			data := g.DataSet(30)
+			batches, err := sc.batches(g, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root := synthetic.WriteTemp(t, batches...)
+
+			adminObject, err := prepare(root, sc.batchKey, sc.dateFinEffectif, sc.opts...)
+			var output bytes.Buffer
+			jsonData, _ := json.MarshalIndent(adminObject, "", "  ")
+			output.Write(jsonData)
+			output.WriteString("\n")
+			if err != nil {
+				output.WriteString("error: " + err.Error() + "\n")
+			}
+			filter := readGeneratedFilter(t, root)
+			output.WriteString(filter)
+
+			goldenFile := filepath.Join("testdata", "scenarios", sc.name+".golden")
+			expected := createfilter.DiffWithGoldenFile(goldenFile, *updateGoldenFiles, output)
+			assert.Equal(t, string(expected), output.String())
+
+			if sc.name == "every_type" {
+				assert.Equal(t, data.Perimeter(), strings.Fields(filter)[1:])
+			}
+		})
+	}
+}
+
+// readGeneratedFilter returns the content of the filter file generated in a batch, or in a sub-batch, of root.
+func readGeneratedFilter(t *testing.T, root string) string {
+	filenames, _ := filepath.Glob(filepath.Join(root, "*", "filter_siren_*.csv"))
+	subBatchFilenames, _ := filepath.Glob(filepath.Join(root, "*", "*", "filter_siren_*.csv"))
+	filenames = append(filenames, subBatchFilenames...)
+	sort.Strings(filenames)
+	var filter strings.Builder
+	for _, filename := range filenames {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter.Write(content)
+	}
+	return filter.String()
+}
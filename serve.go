@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"prepare-import/prepareimport"
+	"prepare-import/server"
+)
+
+// Implementation of the "serve" sub-command: prepare-import serve -path /data -addr :3000
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	var path = flags.String("path", ".", "Chemin d'accès au répertoire des batches")
+	var addr = flags.String("addr", ":3000", "Adresse d'écoute du serveur HTTP")
+	var strictDateFinEffectif = flags.Bool(
+		"strict-date-fin-effectif",
+		false,
+		"Échoue si les différentes sources de date_fin_effectif (paramètre, fichiers effectif, batch précédent) sont incohérentes",
+	)
+	var sireneULCache = flags.String("sireneUL-cache", "", sireneULCacheUsage)
+	_ = flags.Parse(args)
+
+	opts := []prepareimport.Option{}
+	if *strictDateFinEffectif {
+		opts = append(opts, prepareimport.WithStrictDateFinEffectif())
+	}
+	if *sireneULCache != "" {
+		opts = append(opts, prepareimport.WithSireneULCache(*sireneULCache))
+	}
+	log.Fatal(server.ListenAndServe(*addr, *path, opts...))
+}
@@ -0,0 +1,218 @@
+// Package server exposes the preparation of batches through a REST API.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"prepare-import/prepareimport"
+)
+
+// Server handles the following routes:
+//
+//	GET  /batches                 lists the batches found in the data directory
+//	GET  /batches/{key}/files     returns the detected type of each file of the batch
+//	GET  /batches/{key}/filter    downloads the filter file of the batch
+//	POST /batches/{key}/prepare   prepares the batch and returns its Admin object
+type Server struct {
+	root    string // data directory, containing a sub-directory per batch
+	options []prepareimport.Option
+
+	mu      sync.Mutex
+	running map[string]bool // keys of the main batches being prepared
+}
+
+// New creates a Server serving the batches found in root.
+// options are passed to every call to PrepareImport.
+func New(root string, options ...prepareimport.Option) *Server {
+	return &Server{root: root, options: options, running: map[string]bool{}}
+}
+
+// ListenAndServe serves the batches found in root on the TCP address addr.
+func ListenAndServe(addr, root string, options ...prepareimport.Option) error {
+	log.Printf("Serving batches of %s on %s", root, addr)
+	return http.ListenAndServe(addr, New(root, options...))
+}
+
+// PrepareRequest is the optional body of a POST /batches/{key}/prepare request.
+type PrepareRequest struct {
+	DateFinEffectif string `json:"date_fin_effectif"`
+}
+
+// FilesResponse is the body of the response to GET /batches/{key}/files.
+type FilesResponse struct {
+	Files            map[prepareimport.ValidFileType][]string `json:"files"`
+	UnsupportedFiles []string                                 `json:"unsupported_files"`
+}
+
+// ErrorResponse is the body of an error response.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "batches" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, "route not found: "+r.URL.Path)
+		return
+	}
+	if len(parts) == 1 {
+		s.handle(w, r, http.MethodGet, s.listBatches)
+		return
+	}
+	batchKey, err := prepareimport.NewBatchKey(parts[1])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	switch action {
+	case "files":
+		s.handle(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.listFiles(w, batchKey) })
+	case "filter":
+		s.handle(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.downloadFilter(w, r, batchKey) })
+	case "prepare":
+		s.handle(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { s.prepare(w, r, batchKey) })
+	default:
+		writeError(w, http.StatusNotFound, "route not found: "+r.URL.Path)
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, method string, handler http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	handler(w, r)
+}
+
+func (s *Server) listBatches(w http.ResponseWriter, r *http.Request) {
+	batches, err := prepareimport.ListBatches(s.root)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, batches)
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, batchKey prepareimport.BatchKey) {
+	if !s.batchExists(batchKey) {
+		writeError(w, http.StatusNotFound, "batch not found: "+batchKey.String())
+		return
+	}
+	filesProperty, unsupportedFiles, err := prepareimport.PopulateFilesProperty(s.root, batchKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	files := map[prepareimport.ValidFileType][]string{}
+	for fileType, batchFiles := range filesProperty {
+		for _, batchFile := range batchFiles {
+			files[fileType] = append(files[fileType], batchFile.Path())
+		}
+	}
+	writeJSON(w, http.StatusOK, FilesResponse{Files: files, UnsupportedFiles: unsupportedFiles})
+}
+
+// downloadFilter sends the filter file as is, i.e. gzipped filters are not decompressed.
+func (s *Server) downloadFilter(w http.ResponseWriter, r *http.Request, batchKey prepareimport.BatchKey) {
+	if !s.batchExists(batchKey) {
+		writeError(w, http.StatusNotFound, "batch not found: "+batchKey.String())
+		return
+	}
+	filesProperty, _, err := prepareimport.PopulateFilesProperty(s.root, batchKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	filterFile, err := filesProperty.GetFilterFile()
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	file, err := filterFile.DataFile().Open()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer file.Close()
+	if filterFile.GetGzippedSize() > 0 {
+		w.Header().Set("Content-Type", "application/gzip")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filterFile.Name()))
+	if _, err := io.Copy(w, file); err != nil {
+		log.Println("Error while sending filter file: " + err.Error())
+	}
+}
+
+func (s *Server) prepare(w http.ResponseWriter, r *http.Request, batchKey prepareimport.BatchKey) {
+	var request PrepareRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	}
+	// a sub-batch may generate or copy the filter of its parent batch => they share the same lock
+	if !s.lock(batchKey.Parent()) {
+		writeError(w, http.StatusConflict, "batch "+batchKey.GetParentBatch()+" is already being prepared")
+		return
+	}
+	defer s.unlock(batchKey.Parent())
+
+	adminObject, err := prepareimport.PrepareImport(s.root, batchKey, request.DateFinEffectif, s.options...)
+	var unsupportedFilesError prepareimport.UnsupportedFilesError
+	if errors.As(err, &unsupportedFilesError) {
+		w.Header().Set("X-Unsupported-Files", strings.Join(unsupportedFilesError.UnsupportedFiles, ", "))
+	} else if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, adminObject)
+}
+
+func (s *Server) lock(batchKey prepareimport.BatchKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[batchKey.String()] {
+		return false
+	}
+	s.running[batchKey.String()] = true
+	return true
+}
+
+func (s *Server) unlock(batchKey prepareimport.BatchKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, batchKey.String())
+}
+
+func (s *Server) batchExists(batchKey prepareimport.BatchKey) bool {
+	info, err := os.Stat(prepareimport.BatchDir(s.root, batchKey))
+	return err == nil && info.IsDir()
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("Error while sending response: " + err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{message})
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"prepare-import/prepareimport"
+)
+
+var batchKey, _ = prepareimport.NewBatchKey("1802")
+
+func request(s *Server, method, url, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return recorder
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Should list batches and sub-batches", func(t *testing.T) {
+		dir := prepareimport.CreateTempFiles(t, batchKey, []string{})
+		for _, dirName := range []string{"1801", "1802/1802_01", "not_a_batch"} {
+			_ = os.MkdirAll(filepath.Join(dir, dirName), 0777)
+		}
+		res := request(New(dir), http.MethodGet, "/batches", "")
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.JSONEq(t, `["1801", "1802", "1802_01"]`, res.Body.String())
+	})
+
+	t.Run("Should reject an invalid batch key", func(t *testing.T) {
+		res := request(New(t.TempDir()), http.MethodGet, "/batches/1813/files", "")
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Contains(t, res.Body.String(), "le mois de la clé du batch doit être compris entre 01 et 12")
+	})
+
+	t.Run("Should return the detected type of each file", func(t *testing.T) {
+		dir := prepareimport.CreateTempFiles(t, batchKey, []string{"sigfaible_debits.csv", "unsupported.csv"})
+		res := request(New(dir), http.MethodGet, "/batches/1802/files", "")
+		assert.Equal(t, http.StatusOK, res.Code)
+		var body FilesResponse
+		if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &body)) {
+			assert.Equal(t, []string{"/1802/sigfaible_debits.csv"}, body.Files["debit"])
+			assert.Equal(t, []string{"/1802/unsupported.csv"}, body.UnsupportedFiles)
+		}
+	})
+
+	t.Run("Should return the files of a sub-batch, from the directory of its parent batch", func(t *testing.T) {
+		dir := prepareimport.CreateTempFiles(t, batchKey, []string{})
+		_ = os.MkdirAll(filepath.Join(dir, "1802", "1802_01"), 0777)
+		_ = os.WriteFile(filepath.Join(dir, "1802", "1802_01", "sigfaible_debits.csv"), []byte{}, 0666)
+		res := request(New(dir), http.MethodGet, "/batches/1802_01/files", "")
+		assert.Equal(t, http.StatusOK, res.Code)
+		var body FilesResponse
+		if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &body)) {
+			assert.Equal(t, []string{"/1802_01/sigfaible_debits.csv"}, body.Files["debit"])
+		}
+	})
+
+	t.Run("Should return 404 for an unknown batch", func(t *testing.T) {
+		for _, route := range []string{"/batches/1802/files", "/batches/1802/filter"} {
+			res := request(New(t.TempDir()), http.MethodGet, route, "")
+			assert.Equal(t, http.StatusNotFound, res.Code, route)
+			assert.Contains(t, res.Body.String(), "batch not found: 1802", route)
+		}
+	})
+
+	t.Run("Should prepare a batch", func(t *testing.T) {
+		dir := prepareimport.CreateTempFiles(t, batchKey, []string{"filter_2002.csv"})
+		res := request(New(dir), http.MethodPost, "/batches/1802/prepare", `{"date_fin_effectif": "2014-01-01"}`)
+		assert.Equal(t, http.StatusOK, res.Code)
+		var adminObject prepareimport.AdminObject
+		if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &adminObject)) {
+			assert.Equal(t, batchKey, adminObject.ID.Key)
+			assert.Equal(t, []string{"/1802/filter_2002.csv"}, adminObject.Files["filter"])
+		}
+	})
+
+	t.Run("Should only accept POST to prepare a batch", func(t *testing.T) {
+		res := request(New(t.TempDir()), http.MethodGet, "/batches/1802/prepare", "")
+		assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	})
+
+	t.Run("Should report a failed preparation", func(t *testing.T) {
+		dir := prepareimport.CreateTempFiles(t, batchKey, []string{"sigfaible_debits.csv"})
+		res := request(New(dir), http.MethodPost, "/batches/1802/prepare", "")
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+		assert.Contains(t, res.Body.String(), "filter is missing")
+	})
+
+	t.Run("Should refuse to prepare a batch which is already being prepared", func(t *testing.T) {
+		dir := prepareimport.CreateTempFiles(t, batchKey, []string{"filter_2002.csv"})
+		s := New(dir)
+		subBatchKey, _ := prepareimport.NewBatchKey("1802_01")
+		assert.True(t, s.lock(subBatchKey.Parent()))
+		res := request(s, http.MethodPost, "/batches/1802/prepare", "")
+		assert.Equal(t, http.StatusConflict, res.Code)
+		s.unlock(subBatchKey.Parent())
+		res = request(s, http.MethodPost, "/batches/1802/prepare", `{"date_fin_effectif": "2014-01-01"}`)
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("Should download the filter file", func(t *testing.T) {
+		dir := prepareimport.CreateTempFilesWithContent(t, batchKey, map[string][]byte{
+			"filter_siren_1802.csv": []byte("siren\n111111111\n"),
+		})
+		res := request(New(dir), http.MethodGet, "/batches/1802/filter", "")
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "siren\n111111111\n", res.Body.String())
+		assert.Equal(t, "text/csv", res.Header().Get("Content-Type"))
+	})
+
+	t.Run("Should download a gzipped filter file as is", func(t *testing.T) {
+		gzippedFilter, _ := prepareimport.GzipString("siren\n111111111\n")
+		dir := prepareimport.CreateTempFilesWithContent(t, batchKey, map[string][]byte{
+			"filter_siren_1802.csv.gz": gzippedFilter,
+		})
+		res := request(New(dir), http.MethodGet, "/batches/1802/filter", "")
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, gzippedFilter, res.Body.Bytes())
+		assert.Equal(t, "application/gzip", res.Header().Get("Content-Type"))
+	})
+}
@@ -0,0 +1,94 @@
+// Package siret validates the identifiers of companies (SIREN) and of their establishments (SIRET).
+package siret
+
+import (
+	"errors"
+	"strings"
+)
+
+// SirenLaPoste is the SIREN of La Poste, which SIRETs don't follow the Luhn algorithm.
+const SirenLaPoste = "356000000"
+
+// ErrFormat is returned for identifiers that don't have the expected number of digits.
+var ErrFormat = errors.New("format invalide")
+
+// ErrChecksum is returned for identifiers which key is wrong.
+var ErrChecksum = errors.New("clé de contrôle invalide")
+
+// CheckSiren returns an error if siren is not made of 9 digits, or if its Luhn key is wrong.
+func CheckSiren(siren string) error {
+	if !isDigits(siren, 9) {
+		return ErrFormat
+	}
+	if !luhn(siren) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// CheckSiret returns an error if siret is not made of 14 digits, or if its Luhn key is wrong.
+// The SIRETs of La Poste are valid if the sum of their digits is a multiple of 5.
+func CheckSiret(siret string) error {
+	if !isDigits(siret, 14) {
+		return ErrFormat
+	}
+	if err := CheckSiren(siret[0:9]); err != nil {
+		return err
+	}
+	if strings.HasPrefix(siret, SirenLaPoste) && !luhn(siret) {
+		if digitSum(siret)%5 != 0 {
+			return ErrChecksum
+		}
+		return nil
+	}
+	if !luhn(siret) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// IsValidSiren tells whether siren is valid.
+func IsValidSiren(siren string) bool {
+	return CheckSiren(siren) == nil
+}
+
+// IsValidSiret tells whether siret is valid.
+func IsValidSiret(siret string) bool {
+	return CheckSiret(siret) == nil
+}
+
+func isDigits(identifier string, length int) bool {
+	if len(identifier) != length {
+		return false
+	}
+	for _, c := range identifier {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// luhn tells whether the key of a string of digits is valid, according to the Luhn algorithm.
+func luhn(digits string) bool {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		digit := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+func digitSum(digits string) int {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		sum += int(digits[i] - '0')
+	}
+	return sum
+}
@@ -0,0 +1,35 @@
+package siret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSiren(t *testing.T) {
+	assert.NoError(t, CheckSiren("732829320"))
+	assert.NoError(t, CheckSiren(SirenLaPoste))
+	assert.Equal(t, ErrChecksum, CheckSiren("732829321"))
+	assert.Equal(t, ErrFormat, CheckSiren("73282932"))
+	assert.Equal(t, ErrFormat, CheckSiren("73282932A"))
+}
+
+func TestCheckSiret(t *testing.T) {
+	cases := []struct {
+		siret    string
+		expected error
+	}{
+		{"73282932000074", nil},
+		{"73282932000075", ErrChecksum},
+		{"73282932100074", ErrChecksum}, // invalid siren
+		{"7328293200007", ErrFormat},
+		{"7328293200007A", ErrFormat},
+		{" 3282932000074", ErrFormat},
+		{"35600000000048", nil}, // La Poste, valid according to Luhn
+		{"35600000012341", nil}, // La Poste, sum of digits is a multiple of 5
+		{"35600000012342", ErrChecksum},
+	}
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.expected, CheckSiret(testCase.siret), testCase.siret)
+	}
+}
@@ -0,0 +1,73 @@
+package synthetic
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// overridesFilename is the name of the file which provides the type of files that are not recognized by their name
+// (cf prepareimport.OverridesFilename).
+const overridesFilename = "batch-overrides.json"
+
+// Batch describes the files of a batch, by filename.
+type Batch struct {
+	Key   string // e.g. "1802", or "1802_01" for a sub-batch
+	Files map[string][]byte
+}
+
+// NewBatch generates a batch with a file of each of the given types, from the companies of data.
+// The type of "bdf" files is provided by an overrides file, since they are not recognized by their name.
+func (g *Generator) NewBatch(key string, data DataSet, fileTypes ...string) (Batch, error) {
+	batch := Batch{Key: key, Files: map[string][]byte{}}
+	for _, fileType := range fileTypes {
+		filename, content, err := g.File(data, fileType)
+		if err != nil {
+			return Batch{}, err
+		}
+		batch.Files[filename] = content
+		if fileType == "bdf" {
+			overrides, _ := json.MarshalIndent(map[string]interface{}{"types": map[string]string{filename: fileType}}, "", "  ")
+			batch.Files[overridesFilename] = overrides
+		}
+	}
+	return batch, nil
+}
+
+// Dir returns the directory of the batch, relative to the directory of the batches.
+// Sub-batches are located in the directory of their parent batch.
+func (batch Batch) Dir() string {
+	if parent, _, isSubBatch := strings.Cut(batch.Key, "_"); isSubBatch {
+		return filepath.Join(parent, batch.Key)
+	}
+	return batch.Key
+}
+
+// Write writes the files of batches into their directory, in root.
+func Write(root string, batches ...Batch) error {
+	for _, batch := range batches {
+		batchDir := filepath.Join(root, batch.Dir())
+		if err := os.MkdirAll(batchDir, 0755); err != nil {
+			return err
+		}
+		for filename, content := range batch.Files {
+			if err := os.WriteFile(filepath.Join(batchDir, filename), content, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteTemp writes the files of batches into a temporary directory, which is removed at the end of the test,
+// and returns the path of this directory.
+func WriteTemp(t testing.TB, batches ...Batch) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := Write(root, batches...); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
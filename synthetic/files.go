@@ -0,0 +1,406 @@
+package synthetic
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signaux-faibles/goSirene"
+
+	"prepare-import/periode"
+)
+
+// fileLayout describes how the file of a type is generated.
+type fileLayout struct {
+	filename string // usual name of the files of the type
+	comma    rune
+	header   []string
+	// rows generates the rows of the file. Rounds after the first one generate additional rows,
+	// e.g. for later periods, or nil if the file can't have more rows. Rows of establishments are
+	// sampled, so a round may generate no row at all.
+	rows func(g *Generator, data DataSet, round int) [][]string
+}
+
+// layouts of the files of each type, by name of type (cf prepareimport.ValidFileType)
+var layouts = map[string]fileLayout{
+	"admin_urssaf": {"sigfaible_etablissement_utf8.csv", ';', []string{"num_compte", "siret", "date_crea_siret", "date_disparition_siret", "ape", "code_postal"}, adminUrssafRows},
+	"apconso":      {"consommation_ap.csv", ',', []string{"ID_DA", "ETAB_SIRET", "AP_CONSO_DATE", "HEURES", "MONTANTS", "EFFECTIFS"}, apconsoRows},
+	"apdemande":    {"demande_ap.csv", ',', []string{"ID_DA", "ETAB_SIRET", "EFF_ENT", "EFF_ETAB", "DATE_STATUT", "DATE_DEB", "DATE_FIN", "HTA", "MTA", "EFF_AUTO", "MOTIF_RECOURS_SE"}, apdemandeRows},
+	"bdf":          {"bdf.csv", ';', []string{"siren", "annee_bdf", "arrete_bilan_bdf", "raison_sociale", "secteur", "poids_frng", "taux_marge", "delai_fournisseur", "dette_fiscale", "financier_court_terme", "frais_financier"}, bdfRows},
+	"ccsf":         {"sigfaible_ccsf.csv", ';', []string{"Compte", "Date_traitement", "Stade", "Action"}, ccsfRows},
+	"cotisation":   {"sigfaible_cotisdues.csv", ';', []string{"Compte", "Periode", "Cotis_due", "Mer"}, cotisationRows},
+	"debit":        {"sigfaible_debits.csv", ';', []string{"num_cpte", "Siren", "Dt_immat", "Etat_cpte", "Cd_pro_col", "Cd_cat", "Periode", "Num_Ecn", "Num_Hist_Ecn", "Dt_trt_ecn", "Mt_PO", "Mt_PP", "Cd_op_ecn", "Motif_ecart_negatif", "Recours_en_cours"}, debitRows},
+	"delai":        {"sigfaible_delais.csv", ';', []string{"Numero_compte_externe", "Numero_structure", "Date_creation", "Date_echeance", "Duree_delai", "Denomination", "Montant_echeancier", "Stade", "Action"}, delaiRows},
+	"diane":        {"diane_req.csv", ';', []string{"Raison sociale", "Numéro Siren", "Année", "Chiffre d'affaires", "Résultat net", "Effectif"}, dianeRows},
+	"effectif":     {"sigfaible_effectif_siret.csv", ';', nil, nil},      // cf effectifFile
+	"effectif_ent": {"sigfaible_effectif_siren.csv", ';', nil, nil},      // cf effectifFile
+	"ellisphere":   {"Ellisphère-Tête de groupe-2020.xlsx", 0, nil, nil}, // cf ellisphereFile
+	"filter":       {"filter_siren.csv", ',', []string{"siren"}, filterRows},
+	"paydex":       {"E_202001010000_Retro-Paydex_20200101.csv", ';', []string{"SIREN", "NB_JOURS", "NB_JOURS_LIB", "DATE_VALEUR"}, paydexRows},
+	"procol":       {"sigfaible_pcoll.csv", ';', []string{"Siret", "Dt_effet", "Action_procol", "Stade_procol"}, procolRows},
+	"sirene":       {"StockEtablissement_utf8_geo.csv", ',', goSirene.GeoSireneHeaders, sireneRows},
+	"sirene_ul":    {"sireneUL.csv", ',', goSirene.SireneULHeaders, sireneULRows},
+}
+
+// FileTypes lists the types of files which can be generated, in alphabetical order.
+// The files of the "bdf" type are only recognized if their type is provided by an overrides file.
+func FileTypes() []string {
+	fileTypes := make([]string, 0, len(layouts))
+	for fileType := range layouts {
+		fileTypes = append(fileTypes, fileType)
+	}
+	sort.Strings(fileTypes)
+	return fileTypes
+}
+
+// Filename returns the usual name of the files of a type.
+func Filename(fileType string) string {
+	return layouts[fileType].filename
+}
+
+// File generates the file of a type, from the companies of data, and returns it with its usual name.
+func (g *Generator) File(data DataSet, fileType string) (filename string, content []byte, err error) {
+	layout, ok := layouts[fileType]
+	if !ok {
+		return "", nil, errors.New("unknown file type: " + fileType)
+	}
+	switch fileType {
+	case "effectif", "effectif_ent":
+		return layout.filename, g.effectifFile(data, fileType == "effectif_ent"), nil
+	case "ellisphere":
+		return layout.filename, ellisphereFile(), nil
+	}
+	var buf bytes.Buffer
+	w := newCsvWriter(&buf, layout.comma)
+	w.Write(layout.header)
+	w.WriteAll(layout.rows(g, data, 0))
+	return layout.filename, buf.Bytes(), w.Error()
+}
+
+// GzippedFile generates the file of a type, like File, then compresses it. Rows are added to the
+// file until the size of the compressed file reaches minSize bytes, e.g. to exceed the threshold
+// above which a file is considered "complete". The name of the file is suffixed by ".gz".
+func (g *Generator) GzippedFile(data DataSet, fileType string, minSize int) (filename string, content []byte, err error) {
+	filename, content, err = g.File(data, fileType)
+	if err != nil {
+		return "", nil, err
+	}
+	layout := layouts[fileType]
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.NoCompression) // so that the size of the file follows the size of its content
+	zw.Write(content)
+	zw.Flush()
+	for round := 1; buf.Len() < minSize; round++ {
+		var rows [][]string
+		if layout.rows != nil {
+			rows = layout.rows(g, data, round)
+		}
+		if rows == nil {
+			return "", nil, fmt.Errorf("%s files can't reach %d bytes", fileType, minSize)
+		}
+		var more bytes.Buffer
+		w := newCsvWriter(&more, layout.comma)
+		w.WriteAll(rows)
+		zw.Write(more.Bytes())
+		zw.Flush()
+	}
+	if err := zw.Close(); err != nil {
+		return "", nil, err
+	}
+	return filename + ".gz", buf.Bytes(), nil
+}
+
+// Gzip compresses data, e.g. to provide a gzipped file of a type which can't reach a given size.
+func Gzip(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func newCsvWriter(buf *bytes.Buffer, comma rune) *csv.Writer {
+	w := csv.NewWriter(buf)
+	w.Comma = comma
+	return w
+}
+
+// Perimeter returns the sirens that a filter generated from data must contain, in the default perimeter
+// mode: companies which establishments employ at least 10 people, except those excluded by their
+// categorie juridique or their activity. The optional Sirene rules (e.g. on cessées companies or closed
+// establishments) are not applied.
+func (data DataSet) Perimeter() []string {
+	sirens := []string{}
+	for _, company := range data.Companies {
+		if company.Effectif >= 10 && !contains(excludedCategoriesJuridiques, company.CategorieJuridique) && !contains(excludedActivites, company.Activite) {
+			sirens = append(sirens, company.Siren)
+		}
+	}
+	sort.Strings(sirens)
+	return sirens
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// effectifFile generates an effectif file, with one line per establishment, or an effectif_ent file,
+// with one line per company. Effectifs vary by one around the usual effectif of each establishment,
+// so that they never cross the threshold of 10 employees unless the usual effectif does.
+func (g *Generator) effectifFile(data DataSet, perCompany bool) []byte {
+	header := []string{"compte", "siret", "rais_soc", "ape_ins", "dep"}
+	if perCompany {
+		header = []string{"siren", "rais_soc"}
+	}
+	for i := data.NbPeriods - 1; i >= 0; i-- {
+		period := data.LastPeriod.AddDate(0, -i, 0)
+		code, _ := periode.Month(period.Year(), period.Month()).Format()
+		header = append(header, "eff"+code)
+	}
+	if !perCompany {
+		header = append(header, "base", "UR_EMET")
+	}
+	var buf bytes.Buffer
+	w := newCsvWriter(&buf, ';')
+	w.Write(header)
+	for _, company := range data.Companies {
+		if perCompany {
+			w.Write(append([]string{company.Siren, "ENTREPRISE"}, g.effectifs(company.Effectif*len(company.Sirets), data.NbPeriods)...))
+			continue
+		}
+		for i, siret := range company.Sirets {
+			record := []string{company.Comptes[i], siret, "ENTREPRISE", strings.ReplaceAll(company.Activite, ".", ""), fmt.Sprintf("%02d", 1+g.rand.Intn(95))}
+			record = append(record, g.effectifs(company.Effectif, data.NbPeriods)...)
+			w.Write(append(record, "116", "075077"))
+		}
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+func (g *Generator) effectifs(usual int, nbPeriods int) []string {
+	values := make([]string, nbPeriods)
+	for i := range values {
+		effectif := usual + g.rand.Intn(3) - 1
+		if effectif < 0 || (effectif >= 10) != (usual >= 10) {
+			effectif = usual
+		}
+		values[i] = strconv.Itoa(effectif)
+	}
+	return values
+}
+
+// ellisphereFile returns an empty xlsx archive: only the name of Ellisphère files matters to prepare-import.
+func ellisphereFile() []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// forEachEtablissement generates the rows of each establishment, with its siret and URSSAF account.
+func forEachEtablissement(data DataSet, row func(company Company, siret string, compte string) []string) [][]string {
+	rows := [][]string{}
+	for _, company := range data.Companies {
+		for i, siret := range company.Sirets {
+			if r := row(company, siret, company.Comptes[i]); r != nil {
+				rows = append(rows, r)
+			}
+		}
+	}
+	return rows
+}
+
+// roundPeriod returns the month of data covered by a round, starting from the last period of data.
+func roundPeriod(data DataSet, round int) time.Time {
+	return data.LastPeriod.AddDate(0, round, 0)
+}
+
+func urssafPeriod(month time.Time) string {
+	code, _ := periode.Month(month.Year(), month.Month()).Format()
+	return code
+}
+
+func adminUrssafRows(g *Generator, data DataSet, round int) [][]string {
+	if round > 0 {
+		return nil
+	}
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		return []string{compte, siret, company.DateCreation.Format("2006-01-02"), "", strings.ReplaceAll(company.Activite, ".", ""), g.digits(5)}
+	})
+}
+
+func apconsoRows(g *Generator, data DataSet, round int) [][]string {
+	month := roundPeriod(data, round)
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		if g.rand.Intn(4) > 0 {
+			return nil // most establishments don't use activité partielle
+		}
+		return []string{"S" + g.digits(9), siret, month.Format("2006-01-02"), strconv.Itoa(g.rand.Intn(200)), g.amount(5000), strconv.Itoa(1 + g.rand.Intn(company.Effectif+1))}
+	})
+}
+
+func apdemandeRows(g *Generator, data DataSet, round int) [][]string {
+	month := roundPeriod(data, round)
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		if g.rand.Intn(4) > 0 {
+			return nil
+		}
+		effectif := strconv.Itoa(company.Effectif)
+		return []string{"S" + g.digits(9), siret, strconv.Itoa(company.Effectif * len(company.Sirets)), effectif, g.date(month, 28), month.Format("2006-01-02"), month.AddDate(0, 3, -1).Format("2006-01-02"), strconv.Itoa(g.rand.Intn(1000)), g.amount(20000), effectif, strconv.Itoa(1 + g.rand.Intn(6))}
+	})
+}
+
+func bdfRows(g *Generator, data DataSet, round int) [][]string {
+	year := data.LastPeriod.Year() - 1 - round
+	rows := [][]string{}
+	for _, company := range data.Companies {
+		rows = append(rows, []string{company.Siren, strconv.Itoa(year), fmt.Sprintf("%d-12-31", year), "ENTREPRISE", company.Activite[0:2], g.amount(100), g.amount(50), g.amount(90), g.amount(10), g.amount(20), g.amount(5)})
+	}
+	return rows
+}
+
+func ccsfRows(g *Generator, data DataSet, round int) [][]string {
+	month := roundPeriod(data, round)
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		if g.rand.Intn(10) > 0 {
+			return nil
+		}
+		return []string{compte, g.date(month, 28), pick(g, []string{"01", "02", "03"}), pick(g, []string{"CCSF", "RESIL"})}
+	})
+}
+
+func cotisationRows(g *Generator, data DataSet, round int) [][]string {
+	period := urssafPeriod(roundPeriod(data, round))
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		return []string{compte, period, g.amount(company.Effectif*800 + 100), g.amount(company.Effectif*800 + 100)}
+	})
+}
+
+func debitRows(g *Generator, data DataSet, round int) [][]string {
+	month := roundPeriod(data, round)
+	period := urssafPeriod(month)
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		return []string{compte, company.Siren, company.DateCreation.Format("2006-01-02"), "1", "", pick(g, []string{"0", "1", "2"}), period, g.digits(3), strconv.Itoa(g.rand.Intn(5)), g.date(month, 60), g.amount(company.Effectif*500 + 100), g.amount(company.Effectif*100 + 100), pick(g, []string{"1", "2", "3"}), "", "false"}
+	})
+}
+
+func delaiRows(g *Generator, data DataSet, round int) [][]string {
+	month := roundPeriod(data, round)
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		if g.rand.Intn(5) > 0 {
+			return nil
+		}
+		duree := 1 + g.rand.Intn(12)
+		return []string{compte, g.digits(6), month.Format("2006-01-02"), month.AddDate(0, duree, 0).Format("2006-01-02"), strconv.Itoa(duree * 30), "ENTREPRISE", g.amount(50000), pick(g, []string{"APPROBATION", "PROPOSITION"}), pick(g, []string{"SOLDE", "EN COURS"})}
+	})
+}
+
+func dianeRows(g *Generator, data DataSet, round int) [][]string {
+	year := data.LastPeriod.Year() - 1 - round
+	rows := [][]string{}
+	for _, company := range data.Companies {
+		rows = append(rows, []string{"ENTREPRISE", company.Siren, strconv.Itoa(year), g.amount(company.Effectif*100000 + 10000), g.amount(company.Effectif * 5000), strconv.Itoa(company.Effectif * len(company.Sirets))})
+	}
+	return rows
+}
+
+func filterRows(g *Generator, data DataSet, round int) [][]string {
+	if round > 0 {
+		return nil
+	}
+	rows := [][]string{}
+	for _, siren := range data.Perimeter() {
+		rows = append(rows, []string{siren})
+	}
+	return rows
+}
+
+func paydexRows(g *Generator, data DataSet, round int) [][]string {
+	month := roundPeriod(data, round)
+	rows := [][]string{}
+	for _, company := range data.Companies {
+		days := g.rand.Intn(90)
+		rows = append(rows, []string{company.Siren, strconv.Itoa(days), fmt.Sprintf("%d jours", days), month.Format("02/01/2006")})
+	}
+	return rows
+}
+
+func procolRows(g *Generator, data DataSet, round int) [][]string {
+	month := roundPeriod(data, round)
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		if g.rand.Intn(20) > 0 {
+			return nil
+		}
+		return []string{siret, g.date(month, 28), pick(g, []string{"Redressement", "Liquidation", "Sauvegarde"}), pick(g, []string{"Ouverture", "Plan_continuation", "Fin_procedure"})}
+	})
+}
+
+func sireneRows(g *Generator, data DataSet, round int) [][]string {
+	if round > 0 {
+		return nil
+	}
+	columns := goSirene.GeoSireneMap
+	return forEachEtablissement(data, func(company Company, siret string, compte string) []string {
+		row := make([]string, len(goSirene.GeoSireneHeaders))
+		row[columns["siren"]] = company.Siren
+		row[columns["nic"]] = siret[9:]
+		row[columns["siret"]] = siret
+		row[columns["dateCreationEtablissement"]] = company.DateCreation.Format("2006-01-02")
+		row[columns["codePostalEtablissement"]] = g.digits(5)
+		row[columns["etatAdministratifEtablissement"]] = "A"
+		for i, s := range company.Sirets {
+			if s == siret && company.Closed[i] {
+				row[columns["etatAdministratifEtablissement"]] = "F"
+			}
+		}
+		row[columns["activitePrincipaleEtablissement"]] = company.Activite
+		row[columns["nomenclatureActivitePrincipaleEtablissement"]] = "NAFRev2"
+		return row
+	})
+}
+
+func sireneULRows(g *Generator, data DataSet, round int) [][]string {
+	if round > 0 {
+		return nil
+	}
+	columns := map[string]int{}
+	for i, colName := range goSirene.SireneULHeaders {
+		columns[colName] = i
+	}
+	rows := [][]string{}
+	for _, company := range data.Companies {
+		row := make([]string, len(goSirene.SireneULHeaders))
+		row[columns["siren"]] = company.Siren
+		row[columns["statutDiffusionUniteLegale"]] = "O"
+		row[columns["dateCreationUniteLegale"]] = company.DateCreation.Format("2006-01-02")
+		row[columns["dateDernierTraitementUniteLegale"]] = "2019-01-01T00:00:00"
+		row[columns["nombrePeriodesUniteLegale"]] = "1"
+		row[columns["categorieEntreprise"]] = "PME"
+		row[columns["dateDebut"]] = company.DateCreation.Format("2006-01-02")
+		row[columns["etatAdministratifUniteLegale"]] = "A"
+		if company.Cessee {
+			row[columns["etatAdministratifUniteLegale"]] = "C"
+		}
+		row[columns["denominationUniteLegale"]] = "ENTREPRISE"
+		row[columns["categorieJuridiqueUniteLegale"]] = company.CategorieJuridique
+		row[columns["activitePrincipaleUniteLegale"]] = company.Activite
+		row[columns["nomenclatureActivitePrincipaleUniteLegale"]] = "NAFRev2"
+		row[columns["nicSiegeUniteLegale"]] = company.Sirets[0][9:]
+		row[columns["caractereEmployeurUniteLegale"]] = "O"
+		rows = append(rows, row)
+	}
+	return rows
+}
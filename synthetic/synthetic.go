@@ -0,0 +1,157 @@
+// Package synthetic generates realistic data files and batches, for the tests of prepare-import.
+// Data is random, but deterministic for a given seed, so that outputs can be compared with golden files.
+package synthetic
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"prepare-import/siret"
+)
+
+// Generator generates synthetic data, from a seed.
+type Generator struct {
+	rand *rand.Rand
+}
+
+// New returns a generator which always generates the same data for the same seed.
+func New(seed int64) *Generator {
+	return &Generator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Company is a synthetic company, with its establishments.
+type Company struct {
+	Siren              string
+	Sirets             []string // the establishments of the company
+	Comptes            []string // the URSSAF account of each establishment
+	Effectif           int      // usual effectif of each establishment
+	CategorieJuridique string
+	Activite           string // main activity (code NAF)
+	DateCreation       time.Time
+	Cessee             bool   // the unité légale is "cessée"
+	Closed             []bool // whether each establishment is closed
+}
+
+// DataSet is a set of companies from which files of every type can be generated, consistently.
+type DataSet struct {
+	Companies  []Company
+	LastPeriod time.Time // the last period of effectif files, i.e. their date_fin_effectif
+	NbPeriods  int       // number of monthly periods of effectif files
+}
+
+// Sirens returns the sirens of the companies.
+func (data DataSet) Sirens() []string {
+	sirens := make([]string, len(data.Companies))
+	for i, company := range data.Companies {
+		sirens[i] = company.Siren
+	}
+	return sirens
+}
+
+// Sirets returns the sirets of the establishments of the companies.
+func (data DataSet) Sirets() []string {
+	sirets := []string{}
+	for _, company := range data.Companies {
+		sirets = append(sirets, company.Sirets...)
+	}
+	return sirets
+}
+
+var usualEffectifs = []int{1, 3, 5, 8, 12, 25, 60, 150}
+var keptCategoriesJuridiques = []string{"5499", "5710", "5720", "1000", "6540"}
+var excludedCategoriesJuridiques = []string{"7490", "7210", "4110"}
+var keptActivites = []string{"25.62A", "47.11B", "56.10A", "62.01Z", "43.21A"}
+var excludedActivites = []string{"84.11Z", "85.20Z"}
+
+// DataSet generates nbCompanies companies, with one to three establishments each. About one company
+// out of ten has a categorie juridique, and one out of twenty has an activity, excluded from the filter.
+// About one company out of fifteen is cessée, and one establishment out of ten is closed.
+// Effectif files cover the 24 months before January 2020.
+func (g *Generator) DataSet(nbCompanies int) DataSet {
+	data := DataSet{LastPeriod: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), NbPeriods: 24}
+	sirens := g.Sirens(nbCompanies)
+	for _, siren := range sirens {
+		company := Company{
+			Siren:              siren,
+			Effectif:           pick(g, usualEffectifs),
+			CategorieJuridique: pick(g, keptCategoriesJuridiques),
+			Activite:           pick(g, keptActivites),
+			DateCreation:       time.Date(1980+g.rand.Intn(38), time.Month(1+g.rand.Intn(12)), 1+g.rand.Intn(28), 0, 0, 0, 0, time.UTC),
+		}
+		if g.rand.Intn(10) == 0 {
+			company.CategorieJuridique = pick(g, excludedCategoriesJuridiques)
+		} else if g.rand.Intn(20) == 0 {
+			company.Activite = pick(g, excludedActivites)
+		}
+		company.Cessee = g.rand.Intn(15) == 0
+		for i := 1 + g.rand.Intn(3); i > 0; i-- {
+			company.Sirets = append(company.Sirets, g.Siret(siren))
+			company.Comptes = append(company.Comptes, g.digits(18))
+			company.Closed = append(company.Closed, g.rand.Intn(10) == 0)
+		}
+		data.Companies = append(data.Companies, company)
+	}
+	return data
+}
+
+// Sirens generates n distinct sirens, which key is valid.
+func (g *Generator) Sirens(n int) []string {
+	sirens := []string{}
+	generated := map[string]bool{}
+	for len(sirens) < n {
+		siren := g.Siren()
+		if !generated[siren] {
+			generated[siren] = true
+			sirens = append(sirens, siren)
+		}
+	}
+	return sirens
+}
+
+// Siren generates a siren which key is valid.
+func (g *Generator) Siren() string {
+	for {
+		digits := g.digits(8)
+		if digits == "35600000" {
+			continue // La Poste, which sirets follow another rule
+		}
+		for key := 0; key < 10; key++ {
+			if siren := digits + strconv.Itoa(key); siret.IsValidSiren(siren) {
+				return siren
+			}
+		}
+	}
+}
+
+// Siret generates the siret of an establishment of a company, which key is valid.
+func (g *Generator) Siret(siren string) string {
+	nic := g.digits(4)
+	for key := 0; key < 10; key++ {
+		if siretNumber := siren + nic + strconv.Itoa(key); siret.IsValidSiret(siretNumber) {
+			return siretNumber
+		}
+	}
+	panic("no valid key for siret " + siren + nic)
+}
+
+func (g *Generator) digits(n int) string {
+	digits := make([]byte, n)
+	for i := range digits {
+		digits[i] = byte('0' + g.rand.Intn(10))
+	}
+	return string(digits)
+}
+
+func pick[T any](g *Generator, values []T) T {
+	return values[g.rand.Intn(len(values))]
+}
+
+func (g *Generator) date(from time.Time, days int) string {
+	return from.AddDate(0, 0, g.rand.Intn(days)).Format("2006-01-02")
+}
+
+func (g *Generator) amount(max int) string {
+	return fmt.Sprintf("%d.%02d", g.rand.Intn(max), g.rand.Intn(100))
+}
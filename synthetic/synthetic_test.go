@@ -0,0 +1,114 @@
+package synthetic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"prepare-import/prepareimport"
+	"prepare-import/siret"
+)
+
+func TestDataSet(t *testing.T) {
+	t.Run("generates the same companies for the same seed", func(t *testing.T) {
+		assert.Equal(t, New(1).DataSet(20), New(1).DataSet(20))
+		assert.NotEqual(t, New(1).DataSet(20), New(2).DataSet(20))
+	})
+
+	t.Run("generates identifiers which key is valid", func(t *testing.T) {
+		data := New(1).DataSet(50)
+		assert.Len(t, data.Sirens(), 50)
+		for _, company := range data.Companies {
+			assert.True(t, siret.IsValidSiren(company.Siren), company.Siren)
+			for _, siretNumber := range company.Sirets {
+				assert.True(t, siret.IsValidSiret(siretNumber), siretNumber)
+				assert.Equal(t, company.Siren, siretNumber[0:9])
+			}
+		}
+	})
+}
+
+func TestFile(t *testing.T) {
+	g := New(1)
+	data := g.DataSet(20)
+
+	t.Run("names each file so that its type is recognized", func(t *testing.T) {
+		for _, fileType := range FileTypes() {
+			filename, content, err := g.File(data, fileType)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			assert.NotEmpty(t, content)
+			if fileType != "bdf" {
+				assert.Equal(t, prepareimport.ValidFileType(fileType), prepareimport.ExtractFileTypeFromFilename(filename), filename)
+			}
+		}
+	})
+
+	t.Run("generates an effectif file with a column per period", func(t *testing.T) {
+		_, content, _ := g.File(data, "effectif")
+		r := csv.NewReader(bytes.NewReader(content))
+		r.Comma = ';'
+		records, err := r.ReadAll()
+		if assert.NoError(t, err) {
+			assert.Len(t, records, 1+len(data.Sirets()))
+			assert.Equal(t, "eff201812", records[0][5])                  // février 2018
+			assert.Equal(t, "eff202011", records[0][5+data.NbPeriods-1]) // janvier 2020
+			assert.Len(t, records[0], 5+data.NbPeriods+2)
+		}
+	})
+
+	t.Run("fails on an unknown type", func(t *testing.T) {
+		_, _, err := g.File(data, "unknown")
+		assert.Error(t, err)
+	})
+}
+
+func TestGzippedFile(t *testing.T) {
+	g := New(1)
+	data := g.DataSet(20)
+
+	t.Run("adds rows until the compressed file reaches the requested size", func(t *testing.T) {
+		filename, content, err := g.GzippedFile(data, "debit", 100000)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "sigfaible_debits.csv.gz", filename)
+		assert.GreaterOrEqual(t, len(content), 100000)
+		zr, err := gzip.NewReader(bytes.NewReader(content))
+		if assert.NoError(t, err) {
+			data, _ := io.ReadAll(zr)
+			assert.True(t, strings.HasPrefix(string(data), "num_cpte;Siren;"))
+		}
+	})
+
+	t.Run("fails if the file can't have more rows", func(t *testing.T) {
+		_, _, err := g.GzippedFile(data, "sirene_ul", 10000000)
+		assert.ErrorContains(t, err, "sirene_ul files can't reach 10000000 bytes")
+	})
+}
+
+func TestWrite(t *testing.T) {
+	g := New(1)
+	data := g.DataSet(5)
+	batch, err := g.NewBatch("1802", data, "effectif", "bdf")
+	if !assert.NoError(t, err) {
+		return
+	}
+	root := WriteTemp(t, batch, Batch{Key: "1802_01", Files: map[string][]byte{"sigfaible_debits.csv": nil}})
+	for _, path := range []string{"1802/sigfaible_effectif_siret.csv", "1802/bdf.csv", "1802/batch-overrides.json", "1802/1802_01/sigfaible_debits.csv"} {
+		_, err := os.Stat(filepath.Join(root, path))
+		assert.NoError(t, err, path)
+	}
+	overrides, err := prepareimport.ReadBatchOverrides(filepath.Join(root, "1802"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, prepareimport.ValidFileType("bdf"), overrides.Types["bdf.csv"])
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"prepare-import/prepareimport"
+	"prepare-import/watcher"
+)
+
+const defaultStableFor = 5 * time.Minute
+const defaultPollInterval = time.Minute
+
+// Implementation of the "watch" sub-command: prepare-import watch -path /data -configDir /configs
+func watch(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	var path = flags.String("path", ".", "Chemin d'accès au répertoire des batches")
+	var required = flags.String("required", "effectif,sirene_ul", "Types de fichiers qui doivent être présents avant de préparer un batch, séparés par des virgules")
+	var stableFor = flags.Duration("stable-for", defaultStableFor, "Durée pendant laquelle la taille des fichiers d'un batch ne doit pas changer avant de le préparer")
+	var pollInterval = flags.Duration("interval", defaultPollInterval, "Intervalle entre deux examens du répertoire des batches")
+	var stateFile = flags.String("stateFile", "./prepare-import-state.json", "Chemin du fichier où sont enregistrés les batches déjà traités")
+	var configDir = flags.String("configDir", ".", "Répertoire où est écrite la configuration de chaque batch, dans un fichier <batch>.json")
+	var sireneULCache = flags.String("sireneUL-cache", "", sireneULCacheUsage)
+	_ = flags.Parse(args)
+
+	requiredTypes, err := prepareimport.ParseValidFileTypes(*required)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := []prepareimport.Option{}
+	if *sireneULCache != "" {
+		opts = append(opts, prepareimport.WithSireneULCache(*sireneULCache))
+	}
+	w, err := watcher.New(watcher.Config{
+		Root:          *path,
+		RequiredTypes: requiredTypes,
+		StableFor:     *stableFor,
+		PollInterval:  *pollInterval,
+		StateFile:     *stateFile,
+		ConfigDir:     *configDir,
+		Options:       opts,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	log.Printf("Watching batches of %s ...", *path)
+	if err := w.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package watcher prepares batches automatically, as soon as their deliveries are complete.
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"prepare-import/prepareimport"
+)
+
+// Config configures a Watcher.
+type Config struct {
+	Root          string                        // data directory, containing a sub-directory per batch
+	RequiredTypes []prepareimport.ValidFileType // types that must be present before preparing a batch (not a sub-batch)
+	StableFor     time.Duration                 // minimum duration during which the files of a batch must not change
+	PollInterval  time.Duration                 // duration between two scans of Root
+	StateFile     string                        // file in which the batches already processed are stored
+	ConfigDir     string                        // directory in which the Admin objects are written, as <batch>.json
+	Options       []prepareimport.Option        // passed to every call to PrepareImport
+}
+
+// BatchState records the outcome of the preparation of a batch.
+type BatchState struct {
+	PreparedAt  time.Time `json:"prepared_at"`
+	ConfigFile  string    `json:"config_file,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Fingerprint string    `json:"fingerprint"` // identifies the files that were present during the preparation
+}
+
+// State lists the batches already processed, by batch key.
+type State map[string]BatchState
+
+// Watcher monitors the main batches of a data directory.
+// A batch is prepared once, when all required types are present and its files are stable.
+// A batch which preparation failed is retried when its files change.
+type Watcher struct {
+	config       Config
+	state        State
+	observations map[string]observation // by file path
+}
+
+// observation is the last known size and modification time of a file.
+type observation struct {
+	size    uint64
+	modTime time.Time
+	since   time.Time // since when size and modTime haven't changed
+}
+
+// New creates a Watcher, loading the state of previous executions from config.StateFile.
+func New(config Config) (*Watcher, error) {
+	if config.PollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %s", config.PollInterval)
+	}
+	state, err := readState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{config: config, state: state, observations: map[string]observation{}}, nil
+}
+
+// Run scans the data directory every PollInterval, until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Poll(time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll scans the data directory once, prepares the batches which are ready, and returns their keys.
+func (w *Watcher) Poll(now time.Time) ([]prepareimport.BatchKey, error) {
+	batches, err := prepareimport.ListBatches(w.config.Root)
+	if err != nil {
+		return nil, err
+	}
+	prepared := []prepareimport.BatchKey{}
+	for _, batchKey := range batches {
+		fingerprint, stable, err := w.observe(batchKey, now)
+		if err != nil {
+			// e.g. a file was renamed or removed during the scan => the batch is observed again at the next scan
+			log.Println("Warning: could not observe the files of batch " + batchKey.String() + ": " + err.Error())
+			continue
+		}
+		if previous, processed := w.state[batchKey.String()]; processed && (previous.Error == "" || previous.Fingerprint == fingerprint) {
+			continue
+		}
+		if !stable || !w.isReady(batchKey) {
+			continue
+		}
+		w.state[batchKey.String()] = w.prepare(batchKey, fingerprint, now)
+		if err := writeState(w.config.StateFile, w.state); err != nil {
+			return prepared, err
+		}
+		prepared = append(prepared, batchKey)
+	}
+	return prepared, nil
+}
+
+// observe records the size of the files of a batch, and tells whether they have been stable for long enough.
+func (w *Watcher) observe(batchKey prepareimport.BatchKey, now time.Time) (fingerprint string, stable bool, err error) {
+	batchDir := prepareimport.BatchDir(w.config.Root, batchKey)
+	filenames, err := prepareimport.ReadFilenames(batchDir)
+	if err != nil {
+		return "", false, err
+	}
+	sort.Strings(filenames)
+	hash := sha256.New()
+	stable = true
+	for _, filename := range filenames {
+		filePath := path.Join(batchDir, filename)
+		info, err := prepareimport.NewDataFile(filename, batchDir).Stat()
+		if err != nil {
+			return "", false, err
+		}
+		size, modTime := info.Size, info.ModTime
+		fmt.Fprintf(hash, "%s:%d:%d\n", filename, size, modTime.UnixNano())
+		previous, known := w.observations[filePath]
+		if !known || previous.size != size || !previous.modTime.Equal(modTime) {
+			previous = observation{size: size, modTime: modTime, since: now}
+			w.observations[filePath] = previous
+		}
+		if now.Sub(previous.since) < w.config.StableFor {
+			stable = false
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), stable, nil
+}
+
+// isReady tells whether a batch contains all the required types. A sub-batch only needs to contain
+// a supported file, and is prepared once its parent batch was prepared successfully.
+func (w *Watcher) isReady(batchKey prepareimport.BatchKey) bool {
+	filesProperty, _, err := prepareimport.PopulateFilesProperty(w.config.Root, batchKey)
+	if err != nil {
+		log.Println("Warning: " + err.Error())
+		return false
+	}
+	if batchKey.IsSubBatch() {
+		parentState, processed := w.state[batchKey.Parent().String()]
+		return len(filesProperty) > 0 && processed && parentState.Error == ""
+	}
+	for _, fileType := range w.config.RequiredTypes {
+		if len(filesProperty[fileType]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// prepare records the outcome of the preparation of a batch, including a panic, so that a bad delivery
+// doesn't stop the watcher.
+func (w *Watcher) prepare(batchKey prepareimport.BatchKey, fingerprint string, now time.Time) (state BatchState) {
+	log.Println("Preparing batch " + batchKey.String() + " ...")
+	state = BatchState{PreparedAt: now, Fingerprint: fingerprint}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Error: could not prepare batch %s: %v", batchKey.String(), r)
+			state = BatchState{PreparedAt: now, Fingerprint: fingerprint, Error: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+	adminObject, err := prepareimport.PrepareImport(w.config.Root, batchKey, "", w.config.Options...)
+	var unsupportedFilesError prepareimport.UnsupportedFilesError
+	if errors.As(err, &unsupportedFilesError) {
+		log.Println("Warning: " + err.Error())
+	} else if err != nil {
+		log.Println("Error: could not prepare batch " + batchKey.String() + ": " + err.Error())
+		state.Error = err.Error()
+		return state
+	}
+	state.ConfigFile = path.Join(w.config.ConfigDir, batchKey.String()+".json")
+	if err := prepareimport.SaveToFile(adminObject, state.ConfigFile); err != nil {
+		state.Error = err.Error()
+		state.ConfigFile = ""
+		return state
+	}
+	log.Println("Configuration of batch " + batchKey.String() + " written to " + state.ConfigFile)
+	return state
+}
+
+func readState(stateFile string) (State, error) {
+	state := State{}
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", stateFile, err)
+	}
+	return state, nil
+}
+
+func writeState(stateFile string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(stateFile, data, 0644)
+}
@@ -0,0 +1,172 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"prepare-import/prepareimport"
+)
+
+var batchKey, _ = prepareimport.NewBatchKey("1802")
+
+func newTestWatcher(t *testing.T, root string, requiredTypes string) (*Watcher, Config) {
+	fileTypes, err := prepareimport.ParseValidFileTypes(requiredTypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Root:          root,
+		RequiredTypes: fileTypes,
+		StableFor:     time.Minute,
+		PollInterval:  time.Minute,
+		StateFile:     filepath.Join(t.TempDir(), "state.json"),
+		ConfigDir:     t.TempDir(),
+	}
+	w, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, config
+}
+
+func TestWatcher(t *testing.T) {
+	start := time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Should wait until files are stable, then prepare the batch once", func(t *testing.T) {
+		root := prepareimport.CreateTempFilesWithContent(t, batchKey, map[string][]byte{
+			"filter_2002.csv":              {},
+			"sigfaible_effectif_siren.csv": []byte("siren;eff201011\n111111111;12\n"),
+		})
+		w, config := newTestWatcher(t, root, "filter,effectif_ent")
+
+		prepared, err := w.Poll(start)
+		assert.NoError(t, err)
+		assert.Empty(t, prepared, "files were just discovered")
+
+		prepared, err = w.Poll(start.Add(2 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []prepareimport.BatchKey{batchKey}, prepared)
+		assert.FileExists(t, filepath.Join(config.ConfigDir, "1802.json"))
+
+		prepared, err = w.Poll(start.Add(4 * time.Minute))
+		assert.NoError(t, err)
+		assert.Empty(t, prepared, "the batch was already prepared")
+	})
+
+	t.Run("Should observe again a batch which files changed during the scan", func(t *testing.T) {
+		root := prepareimport.CreateTempFiles(t, batchKey, []string{"filter_2002.csv"})
+		removedFile := filepath.Join(root, "1802", "sigfaible_debits.csv")
+		_ = os.Symlink("removed_during_the_scan.csv", removedFile)
+		w, _ := newTestWatcher(t, root, "filter")
+
+		prepared, err := w.Poll(start)
+		assert.NoError(t, err)
+		assert.Empty(t, prepared)
+
+		prepared, err = w.Poll(start.Add(2 * time.Minute))
+		assert.NoError(t, err)
+		assert.Empty(t, prepared, "the batch can't be observed")
+
+		_ = os.Remove(removedFile)
+		prepared, err = w.Poll(start.Add(3 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []prepareimport.BatchKey{batchKey}, prepared)
+	})
+
+	t.Run("Should wait until all required types are present", func(t *testing.T) {
+		root := prepareimport.CreateTempFiles(t, batchKey, []string{"filter_2002.csv"})
+		w, _ := newTestWatcher(t, root, "filter,debit")
+		_, _ = w.Poll(start)
+		prepared, err := w.Poll(start.Add(2 * time.Minute))
+		assert.NoError(t, err)
+		assert.Empty(t, prepared)
+	})
+
+	t.Run("Should wait until a growing file is stable", func(t *testing.T) {
+		root := prepareimport.CreateTempFiles(t, batchKey, []string{"filter_2002.csv"})
+		w, _ := newTestWatcher(t, root, "filter")
+		_, _ = w.Poll(start)
+		if err := os.WriteFile(filepath.Join(root, "1802", "filter_2002.csv"), []byte("siren\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		prepared, _ := w.Poll(start.Add(2 * time.Minute))
+		assert.Empty(t, prepared)
+	})
+
+	t.Run("Should not process again the batches listed in the state file", func(t *testing.T) {
+		root := prepareimport.CreateTempFiles(t, batchKey, []string{"filter_2002.csv"})
+		w, config := newTestWatcher(t, root, "filter")
+		w.state["1802"] = BatchState{PreparedAt: start, ConfigFile: "1802.json"}
+		if err := writeState(config.StateFile, w.state); err != nil {
+			t.Fatal(err)
+		}
+		w, err := New(config)
+		if assert.NoError(t, err) {
+			_, _ = w.Poll(start)
+			prepared, _ := w.Poll(start.Add(2 * time.Minute))
+			assert.Empty(t, prepared)
+		}
+	})
+
+	t.Run("Should prepare a sub-batch once its parent batch was prepared", func(t *testing.T) {
+		root := prepareimport.CreateTempFiles(t, batchKey, []string{"filter_2002.csv"})
+		subBatchKey, _ := prepareimport.NewBatchKey("1802_01")
+		subBatchDir := prepareimport.BatchDir(root, subBatchKey)
+		_ = os.Mkdir(subBatchDir, 0777)
+		_ = os.WriteFile(filepath.Join(subBatchDir, "sigfaible_debits.csv"), []byte{}, 0666)
+		w, config := newTestWatcher(t, root, "filter,effectif_ent")
+
+		_, _ = w.Poll(start)
+		prepared, err := w.Poll(start.Add(2 * time.Minute))
+		assert.NoError(t, err)
+		assert.Empty(t, prepared, "the parent batch is incomplete")
+
+		_ = os.WriteFile(filepath.Join(root, "1802", "sigfaible_effectif_siren.csv"), []byte("siren;eff201011\n111111111;12\n"), 0666)
+		_, _ = w.Poll(start.Add(3 * time.Minute))
+		prepared, err = w.Poll(start.Add(5 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []prepareimport.BatchKey{batchKey, subBatchKey}, prepared)
+		assert.FileExists(t, filepath.Join(config.ConfigDir, "1802_01.json"))
+	})
+
+	t.Run("Should record a failed preparation in the state file", func(t *testing.T) {
+		root := prepareimport.CreateTempFiles(t, batchKey, []string{"sigfaible_debits.csv"})
+		w, config := newTestWatcher(t, root, "debit")
+		_, _ = w.Poll(start)
+		prepared, err := w.Poll(start.Add(2 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []prepareimport.BatchKey{batchKey}, prepared)
+		state, err := readState(config.StateFile)
+		if assert.NoError(t, err) {
+			assert.Contains(t, state["1802"].Error, "filter is missing")
+		}
+		prepared, _ = w.Poll(start.Add(4 * time.Minute))
+		assert.Empty(t, prepared, "files did not change since the failure")
+	})
+	t.Run("Should record a panic of the preparation in the state file, and keep watching", func(t *testing.T) {
+		root := prepareimport.CreateTempFilesWithContent(t, batchKey, map[string][]byte{
+			"filter_2002.csv":              {},
+			"sigfaible_effectif_siren.csv": []byte("siren;eff201011\n111111111;12\n"),
+			"sigfaible_debits.csv":         {},
+			"sigfaible_debits2.csv":        {},
+		})
+		w, config := newTestWatcher(t, root, "filter,effectif_ent")
+		_, _ = w.Poll(start)
+		prepared, err := w.Poll(start.Add(2 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []prepareimport.BatchKey{batchKey}, prepared)
+		state, err := readState(config.StateFile)
+		if assert.NoError(t, err) {
+			assert.Contains(t, state["1802"].Error, "panic: 'complete' file detection can only work if there is only 1 file per type")
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{StateFile: filepath.Join(t.TempDir(), "state.json")})
+	assert.EqualError(t, err, "poll interval must be positive, got 0s")
+}